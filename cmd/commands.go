@@ -0,0 +1,326 @@
+package main
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/database"
+	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/middleware"
+	"WST_lab6_server/internal/models"
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Коды завершения команд
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// Ограничение времени административных запросов к базе данных
+const commandTimeout = 30 * time.Second
+
+const usage = `Usage: server [-config file] [command]
+
+Commands:
+  serve                               start the HTTP server (default)
+  migrate                             apply database migrations
+  seed [-reset]                       insert generalServer.persons from the config;
+                                      -reset deletes all persons first
+  user add -username NAME [-role R]   create an API user (admin, editor, viewer);
+                                      password is read from stdin
+  user passwd -username NAME          change the password of a user created by user add
+  config validate                     check the config file, including unknown keys
+  db check                            check connectivity, pool and schema
+
+Flags:
+  -config file    config file (default config/pc.yaml, config/vm.yaml on test-XWPC)
+`
+
+/*
+Функция разбора аргументов и запуска команды, возвращает код завершения
+*/
+func run(args []string) int {
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	configFile := flags.String("config", "", "config file")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	path := *configFile
+	if path == "" {
+		path = config.DefaultPath()
+	}
+	command, rest := "serve", []string(nil)
+	if flags.NArg() > 0 {
+		command, rest = flags.Arg(0), flags.Args()[1:]
+	}
+	//Проверка конфигурации не должна зависеть от ее успешной загрузки
+	if command == "config" {
+		return configCommand(path, rest)
+	}
+	if command == "help" {
+		fmt.Fprint(os.Stdout, usage)
+		return exitOK
+	}
+	if err := config.Load(path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	//Журнал по настройкам из конфигурации
+	if err := logging.InitializeLogger(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	defer logging.Sync()
+
+	switch command {
+	case "serve":
+		return serve(rest)
+	case "migrate":
+		return migrateCommand(rest)
+	case "seed":
+		return seedCommand(rest)
+	case "user":
+		return userCommand(rest)
+	case "db":
+		return dbCommand(rest)
+	}
+	return usageFailure(fmt.Sprintf("unknown command %q", command))
+}
+
+/*
+Функция вывода ошибки использования
+*/
+func usageFailure(message string) int {
+	fmt.Fprintf(os.Stderr, "%s\n\n%s", message, usage)
+	return exitUsage
+}
+
+/*
+Функция вывода ошибки выполнения команды
+*/
+func failure(err error) int {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	return exitFailure
+}
+
+/*
+Функция подключения к базе данных для административных команд.
+Соединение закрывается вызовом возвращаемой функции.
+*/
+func openDatabase() (*gorm.DB, func(), error) {
+	db, err := postgres.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}, nil
+}
+
+/*
+Команда migrate: применение миграций схемы
+*/
+func migrateCommand(args []string) int {
+	if len(args) != 0 {
+		return usageFailure("migrate takes no arguments")
+	}
+	db, closeDB, err := openDatabase()
+	if err != nil {
+		return failure(err)
+	}
+	defer closeDB()
+	if err := postgres.Migrate(db); err != nil {
+		return failure(err)
+	}
+	fmt.Println("migrations applied")
+	return exitOK
+}
+
+/*
+Команда seed: заполнение таблицы people из конфигурации
+*/
+func seedCommand(args []string) int {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	reset := flags.Bool("reset", false, "delete all persons before seeding")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return usageFailure("usage: seed [-reset]")
+	}
+	db, closeDB, err := openDatabase()
+	if err != nil {
+		return failure(err)
+	}
+	defer closeDB()
+	//Таблица должна существовать, миграция идемпотентна
+	if err := postgres.Migrate(db); err != nil {
+		return failure(err)
+	}
+	created, err := postgres.Seed(db, *reset)
+	if err != nil {
+		return failure(err)
+	}
+	fmt.Printf("%d of %d persons created\n", created, len(config.GeneralServerSetting.DataSet))
+	return exitOK
+}
+
+/*
+Команда user: управление пользователями API в таблице users
+*/
+func userCommand(args []string) int {
+	if len(args) == 0 {
+		return usageFailure("usage: user add|passwd -username NAME")
+	}
+	action := args[0]
+	flags := flag.NewFlagSet("user "+action, flag.ContinueOnError)
+	username := flags.String("username", "", "user name")
+	role := flags.String("role", middleware.RoleViewer, "admin, editor or viewer")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 0 || *username == "" {
+		return usageFailure("usage: user add|passwd -username NAME [-role ROLE]")
+	}
+	if action != "add" && action != "passwd" {
+		return usageFailure(fmt.Sprintf("unknown user command %q", action))
+	}
+	if !slices.Contains([]string{middleware.RoleAdmin, middleware.RoleEditor, middleware.RoleViewer}, *role) {
+		return usageFailure(fmt.Sprintf("unknown role %q", *role))
+	}
+	//Пользователи из конфигурации имеют приоритет, запись в таблице для них не действовала бы
+	for _, user := range config.AuthSetting.Users {
+		if user.Username == *username {
+			return failure(fmt.Errorf("user %q is defined in the config file (auth.users)", *username))
+		}
+	}
+	password, err := readPassword()
+	if err != nil {
+		return failure(err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return failure(err)
+	}
+
+	db, closeDB, err := openDatabase()
+	if err != nil {
+		return failure(err)
+	}
+	defer closeDB()
+	if err := postgres.Migrate(db); err != nil {
+		return failure(err)
+	}
+	storage := &postgres.Storage{DB: db}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	switch action {
+	case "add":
+		err = storage.AddUser(ctx, &models.User{Username: *username, PasswordHash: string(hash), Role: *role})
+		if errors.Is(err, database.ErrUserExists) {
+			return failure(fmt.Errorf("user %q already exists, use user passwd", *username))
+		}
+	case "passwd":
+		err = storage.SetUserPassword(ctx, *username, string(hash))
+		if errors.Is(err, database.ErrUserNotFound) {
+			return failure(fmt.Errorf("user %q not found", *username))
+		}
+	}
+	if err != nil {
+		return failure(err)
+	}
+	fmt.Printf("user %q saved\n", *username)
+	return exitOK
+}
+
+/*
+Функция чтения пароля из первой строки стандартного ввода
+*/
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	fmt.Fprintln(os.Stderr)
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("empty password")
+	}
+	return password, nil
+}
+
+/*
+Команда config validate: проверка файла конфигурации
+*/
+func configCommand(path string, args []string) int {
+	if len(args) != 1 || args[0] != "validate" {
+		return usageFailure("usage: config validate")
+	}
+	problems := config.Check(path)
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, problem)
+	}
+	if len(problems) > 0 {
+		return exitFailure
+	}
+	fmt.Printf("%s: ok\n", path)
+	return exitOK
+}
+
+/*
+Команда db check: одна попытка подключения, состояние пула и наличие таблиц
+*/
+func dbCommand(args []string) int {
+	if len(args) != 1 || args[0] != "check" {
+		return usageFailure("usage: db check")
+	}
+	//Проверка не должна ждать повторных попыток подключения
+	config.DatabaseSetting.Connect.Attempts = 1
+	db, closeDB, err := openDatabase()
+	if err != nil {
+		return failure(err)
+	}
+	defer closeDB()
+	storage := &postgres.Storage{DB: db}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	status := exitOK
+	start := time.Now()
+	stats, err := storage.HealthCheck(ctx)
+	if err != nil {
+		return failure(err)
+	}
+	fmt.Printf("connection: ok (%s)\n", time.Since(start).Round(time.Millisecond))
+	fmt.Printf("pool: %+v\n", stats)
+	for _, table := range postgres.Tables {
+		statement := &gorm.Statement{DB: db}
+		if err := statement.Parse(table); err != nil {
+			return failure(err)
+		}
+		name := statement.Schema.Table
+		if db.WithContext(ctx).Migrator().HasTable(table) {
+			fmt.Printf("table %s: ok\n", name)
+			continue
+		}
+		fmt.Printf("table %s: missing, run migrate\n", name)
+		status = exitFailure
+	}
+	if count, err := storage.CountPersons(ctx); err == nil {
+		fmt.Printf("persons: %d\n", count)
+	}
+	return status
+}
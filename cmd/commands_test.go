@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+Функция создания файла конфигурации из config/pc.yaml: база данных недоступна (порт 1),
+одна попытка подключения, журнал во временном каталоге; replacements - дополнительные замены
+*/
+func writeConfig(t *testing.T, replacements ...string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "config", "pc.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	//Замены из аргументов проверяются первыми
+	replacements = append(replacements, []string{
+		"host: 192.168.253.229", "host: 127.0.0.1",
+		"port: 5432", "port: 1",
+		"attempts: 10", "attempts: 1",
+		`path: "log.json"`, `path: "` + filepath.Join(dir, "log.json") + `"`,
+		`path: "stdout"`, `path: "stderr"`,
+	}...)
+	text := strings.NewReplacer(replacements...).Replace(string(data))
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+/*
+Функция запуска команды с подменой стандартных потоков: код завершения, stdout и stderr
+*/
+func runCommand(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	files := make([]*os.File, 3)
+	for i, name := range []string{"stdin", "stdout", "stderr"} {
+		file, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		files[i] = file
+	}
+	if _, err := files[0].WriteString(stdin); err != nil {
+		t.Fatal(err)
+	}
+	files[0].Seek(0, io.SeekStart)
+	savedIn, savedOut, savedErr := os.Stdin, os.Stdout, os.Stderr
+	os.Stdin, os.Stdout, os.Stderr = files[0], files[1], files[2]
+	code := run(args)
+	os.Stdin, os.Stdout, os.Stderr = savedIn, savedOut, savedErr
+	stdout, _ := os.ReadFile(files[1].Name())
+	stderr, _ := os.ReadFile(files[2].Name())
+	return code, string(stdout), string(stderr)
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		replacements []string
+		code         int
+		message      string
+	}{
+		{"valid", nil, exitOK, ": ok"},
+		{"unknown key", []string{"  runMode:", "  runMod:"}, exitFailure, "field runMod not found"},
+		{"invalid value", []string{`runMode: "debug"`, `runMode: "fast"`}, exitFailure, `httpServer.runMode "fast"`},
+		{"unknown role", []string{`role: "admin" #`, `role: "owner" #`}, exitFailure, "owner"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeConfig(t, test.replacements...)
+			code, stdout, stderr := runCommand(t, "", "-config", path, "config", "validate")
+			if code != test.code || !strings.Contains(stdout+stderr, test.message) {
+				t.Fatalf("exit %d, want %d\nstdout: %s\nstderr: %s", code, test.code, stdout, stderr)
+			}
+		})
+	}
+	if code, _, _ := runCommand(t, "", "-config", writeConfig(t), "config", "check"); code != exitUsage {
+		t.Errorf("config check: exit %d, want %d", code, exitUsage)
+	}
+	if code, _, _ := runCommand(t, "", "-config", filepath.Join(t.TempDir(), "missing.yaml"), "config", "validate"); code != exitFailure {
+		t.Errorf("missing file: exit %d, want %d", code, exitFailure)
+	}
+}
+
+func TestUserAdd(t *testing.T) {
+	path := writeConfig(t)
+	tests := []struct {
+		name    string
+		stdin   string
+		args    []string
+		code    int
+		message string
+	}{
+		{"missing username", "secret\n", []string{"user", "add"}, exitUsage, "usage: user add"},
+		{"unknown action", "secret\n", []string{"user", "remove", "-username", "ops"}, exitUsage, `unknown user command "remove"`},
+		{"unknown role", "secret\n", []string{"user", "add", "-username", "ops", "-role", "owner"}, exitUsage, `unknown role "owner"`},
+		{"config user", "secret\n", []string{"user", "add", "-username", "root"}, exitFailure, "auth.users"},
+		{"empty password", "\n", []string{"user", "add", "-username", "ops"}, exitFailure, "empty password"},
+		{"database unavailable", "secret\n", []string{"user", "add", "-username", "ops", "-role", "editor"}, exitFailure, "error:"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, stdout, stderr := runCommand(t, test.stdin, append([]string{"-config", path}, test.args...)...)
+			if code != test.code || !strings.Contains(stderr, test.message) {
+				t.Fatalf("exit %d, want %d\nstdout: %s\nstderr: %s", code, test.code, stdout, stderr)
+			}
+		})
+	}
+}
+
+func TestDBCheck(t *testing.T) {
+	path := writeConfig(t, "attempts: 10", "attempts: 5")
+	if code, _, stderr := runCommand(t, "", "-config", path, "db", "status"); code != exitUsage || !strings.Contains(stderr, "usage: db check") {
+		t.Errorf("db status: exit %d, want %d: %s", code, exitUsage, stderr)
+	}
+	//db check выполняет одну попытку подключения независимо от database.connect.attempts
+	code, stdout, stderr := runCommand(t, "", "-config", path, "db", "check")
+	if code != exitFailure || !strings.Contains(stderr, "error:") || strings.Contains(stdout, "connection: ok") {
+		t.Fatalf("exit %d, want %d\nstdout: %s\nstderr: %s", code, exitFailure, stdout, stderr)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	if code, _, stderr := runCommand(t, "", "-config", writeConfig(t), "deploy"); code != exitUsage || !strings.Contains(stderr, `unknown command "deploy"`) {
+		t.Errorf("exit %d, want %d: %s", code, exitUsage, stderr)
+	}
+}
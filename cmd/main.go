@@ -2,24 +2,232 @@ package main
 
 import (
 	"WST_lab6_server/config"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"WST_lab6_server/internal/cache"
 	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/events"
+	"WST_lab6_server/internal/grpcserver"
+	"WST_lab6_server/internal/health"
 	"WST_lab6_server/internal/httpserver/routes"
-	"fmt"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/metrics"
+	"WST_lab6_server/internal/middleware"
+	"WST_lab6_server/internal/outbox"
+	"WST_lab6_server/internal/tracing"
+	"WST_lab6_server/internal/webhooks"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// Значения по умолчанию для параметров HTTP сервера
+const (
+	defaultBindAddr        = ":8095"
+	defaultShutdownTimeout = 30 * time.Second
 )
 
 func main() {
-	config.Init()
-	postgres.Init()
-	httpServer := gin.Default()
+	os.Exit(run(os.Args[1:]))
+}
+
+/*
+Команда serve: запуск HTTP сервера (выполняется и без указания команды)
+*/
+func serve(args []string) int {
+	if len(args) != 0 {
+		return usageFailure("serve takes no arguments")
+	}
+	//Трассировка OpenTelemetry
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		logging.Logger.Error("error initializing tracing", zap.Error(err))
+		return exitFailure
+	}
+	//Подключение к БД
+	db := postgres.Init()
+	//Лента изменений записей для SSE и WebSocket подписчиков
+	storage := &postgres.Storage{
+		DB:     db,
+		Events: events.NewBroker(config.EventsSetting.LogSize, config.EventsSetting.SubscriberBuffer),
+	}
+	//Кэш чтения записей по id и результатов поиска
+	if config.CacheSetting.Enabled {
+		storage.Cache = cache.NewLRU(config.CacheSetting.MaxEntries)
+	}
+	//Пользователи, созданные командой user add
+	middleware.SetUserStore(storage)
+	//Проверки состояния зависимостей для /readyz, /health и /admin/health
+	health.Register("config", config.HealthCheck)
+	health.Register("database", storage.HealthCheck)
+	health.Register("migrations", storage.MigrationsCheck)
+	//Метрика общего количества записей
+	metrics.RegisterPersonsCount(storage.CountPersons)
+	metrics.RegisterOutboxPending(storage.CountPendingOutboxEvents)
+	//Отправитель webhook и диспетчер outbox, передающий события ленте изменений и webhook
+	var webhookWorker *webhooks.Worker
+	if config.WebhooksSetting.Enabled {
+		webhookWorker = webhooks.NewWorker(storage)
+	}
+	dispatcher := outbox.NewDispatcher(storage, outboxSinks(storage, webhookWorker)...)
+	storage.OutboxWritten = dispatcher.Notify
+
+	if config.HTTPServerSetting.RunMode != "" {
+		gin.SetMode(config.HTTPServerSetting.RunMode)
+	}
+	httpServer := gin.New()
 
-	routes.Init(httpServer)
+	routes.Init(httpServer, storage)
 
 	httpServer.StaticFile("/favicon.ico", "./favicon.ico")
-	err := httpServer.Run(":8095")
-	if err != nil {
-		fmt.Println(err)
-		return
+
+	bindAddr := config.HTTPServerSetting.BindAddr
+	if bindAddr == "" {
+		bindAddr = defaultBindAddr
+	}
+	server := &http.Server{
+		Addr:         bindAddr,
+		Handler:      httpServer,
+		ReadTimeout:  config.HTTPServerSetting.ReadTimeout,
+		WriteTimeout: config.HTTPServerSetting.WriteTimeout,
+	}
+	//Ожидаем сигнал остановки
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	//Запускаем сервер в отдельной горутине
+	serverErr := make(chan error, 2)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	//gRPC сервер на отдельном порту
+	var grpcServer *grpc.Server
+	if config.GRPCServerSetting.Enabled {
+		listener, err := net.Listen("tcp", config.GRPCServerSetting.BindAddr)
+		if err != nil {
+			logging.Logger.Error("error starting grpc server", zap.String("addr", config.GRPCServerSetting.BindAddr), zap.Error(err))
+			return exitFailure
+		}
+		grpcServer = grpcserver.New(storage)
+		logging.Logger.Info("grpc server started", zap.String("addr", listener.Addr().String()))
+		go func() {
+			serverErr <- grpcServer.Serve(listener)
+		}()
+	}
+	//Фоновые задачи работают до завершения запросов, чтобы события последних изменений были доставлены
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	var background sync.WaitGroup
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		dispatcher.Run(backgroundCtx)
+	}()
+	if webhookWorker != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			webhookWorker.Run(backgroundCtx)
+		}()
+	}
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, grpc.ErrServerStopped) {
+			logging.Logger.Error("server stopped with error", zap.Error(err))
+			return exitFailure
+		}
+		return exitOK
+	case <-ctx.Done():
+	}
+	//Снимаем готовность и даем балансировщику время заметить это
+	health.SetShuttingDown()
+	logging.Logger.Info("shutdown started", zap.Duration("delay", config.HTTPServerSetting.ShutdownDelay))
+	time.Sleep(config.HTTPServerSetting.ShutdownDelay)
+	//Дожидаемся завершения активных запросов
+	shutdownTimeout := config.HTTPServerSetting.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	//Завершаем потоки событий: иначе открытые подписки задержат остановку до истечения времени
+	storage.Events.Close()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logging.Logger.Error("graceful shutdown failed", zap.Error(err))
+	}
+	if grpcServer != nil {
+		stopGRPC(shutdownCtx, grpcServer)
+	}
+	//Останавливаем диспетчер outbox и отправитель webhook: начатые доставки завершаются,
+	//остальные события и доставки останутся в базе данных до следующего запуска
+	stopBackground()
+	backgroundDone := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(backgroundDone)
+	}()
+	select {
+	case <-backgroundDone:
+	case <-shutdownCtx.Done():
+	}
+	//Закрываем соединения с БД
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+	//Выгружаем накопленные спаны
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logging.Logger.Error("tracing shutdown failed", zap.Error(err))
+	}
+	logging.Logger.Info("server stopped")
+	return exitOK
+}
+
+/*
+Функция остановки gRPC сервера: дожидаемся завершения активных вызовов,
+по истечении времени остановки разрываем оставшиеся соединения
+*/
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		logging.Logger.Error("grpc graceful shutdown timed out")
+		server.Stop()
+	}
+}
+
+/*
+Функция выбора получателей событий outbox по конфигурации (outbox.sinks, по умолчанию events и webhooks).
+Получатель webhooks подключается только при включенной доставке webhook.
+*/
+func outboxSinks(storage *postgres.Storage, webhookWorker *webhooks.Worker) []outbox.Sink {
+	names := config.OutboxSetting.Sinks
+	if len(names) == 0 {
+		names = []string{"events", "webhooks"}
+	}
+	var sinks []outbox.Sink
+	for _, name := range names {
+		switch name {
+		case "events":
+			sinks = append(sinks, outbox.BrokerSink{Broker: storage.Events})
+		case "webhooks":
+			if webhookWorker != nil {
+				sinks = append(sinks, outbox.WebhookSink{Queue: webhookWorker})
+			}
+		case "log":
+			sinks = append(sinks, outbox.LogSink{})
+		}
 	}
+	return sinks
 }
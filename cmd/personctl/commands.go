@@ -0,0 +1,352 @@
+package main
+
+import (
+	"WST_lab6_server/pkg/client"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+func (c *command) list(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return usageError("list takes no arguments")
+	}
+	persons, err := c.client.List(ctx)
+	if err != nil {
+		return err
+	}
+	return printPersons(c.stdout, c.output, persons)
+}
+
+func (c *command) search(ctx context.Context, args []string) error {
+	if len(args) != 1 || args[0] == "" {
+		return usageError("search requires a query argument")
+	}
+	persons, err := c.client.Search(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return printPersons(c.stdout, c.output, persons)
+}
+
+func (c *command) get(ctx context.Context, args []string) error {
+	id, err := parseID(args)
+	if err != nil {
+		return err
+	}
+	person, err := c.client.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return printPersons(c.stdout, c.output, []client.Person{*person})
+}
+
+/*
+Флаги полей записи для add и update
+*/
+type personFlags struct {
+	name, surname, email, telephone *string
+	age                             *int
+}
+
+func newPersonFlags(flags *flag.FlagSet) personFlags {
+	return personFlags{
+		name:      flags.String("name", "", "name"),
+		surname:   flags.String("surname", "", "surname"),
+		age:       flags.Int("age", -1, "age"),
+		email:     flags.String("email", "", "email"),
+		telephone: flags.String("telephone", "", "telephone, +7XXXXXXXXXX"),
+	}
+}
+
+/*
+Метод переноса указанных флагов в запись (неуказанные поля не меняются)
+*/
+func (pf personFlags) apply(flags *flag.FlagSet, person *client.Person) {
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			person.Name = *pf.name
+		case "surname":
+			person.Surname = *pf.surname
+		case "age":
+			person.Age = *pf.age
+		case "email":
+			person.Email = *pf.email
+		case "telephone":
+			person.Telephone = *pf.telephone
+		}
+	})
+}
+
+func (c *command) add(ctx context.Context, args []string) error {
+	flags := newFlagSet("add")
+	fields := newPersonFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return usageError("add takes only flags")
+	}
+	var person client.Person
+	fields.apply(flags, &person)
+	//Проверку значений выполняет сервер
+	id, err := c.client.Create(ctx, &person)
+	if err != nil {
+		return err
+	}
+	return printValue(c.stdout, c.output, "id", id)
+}
+
+/*
+Команда update: текущая запись читается с сервера и изменяются только указанные поля,
+так как сервер требует полную запись.
+Если сервер скрыл email или телефон для роли пользователя (pii.redaction), маску нельзя
+отправить обратно вместо настоящего значения: команда отказывается, пока поле не указано флагом.
+*/
+func (c *command) update(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return usageError("update requires an id argument")
+	}
+	id, err := parseID(args[:1])
+	if err != nil {
+		return err
+	}
+	flags := newFlagSet("update")
+	fields := newPersonFlags(flags)
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NFlag() == 0 {
+		return usageError("update requires at least one field flag")
+	}
+	person, err := c.client.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var missing []string
+	for _, field := range redactedFields(person) {
+		if !set[field] {
+			missing = append(missing, "-"+field)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("person %d is returned with masked personal data for this user; pass %s explicitly or use a user allowed to see it",
+			id, strings.Join(missing, " and "))
+	}
+	fields.apply(flags, person)
+	if err := c.client.Update(ctx, id, person); err != nil {
+		return err
+	}
+	return printValue(c.stdout, c.output, "message", "Person updated successfully!")
+}
+
+/*
+Функция определения полей, скрытых сервером (o***@mail.com, +7*******576).
+Телефон со звездочками не проходит проверку формата, поэтому не может быть настоящим значением.
+*/
+func redactedFields(person *client.Person) []string {
+	var fields []string
+	if strings.Contains(person.Email, "***@") {
+		fields = append(fields, "email")
+	}
+	if strings.Contains(person.Telephone, "*") {
+		fields = append(fields, "telephone")
+	}
+	return fields
+}
+
+func (c *command) delete(ctx context.Context, args []string) error {
+	id, err := parseID(args)
+	if err != nil {
+		return err
+	}
+	if err := c.client.Delete(ctx, id); err != nil {
+		return err
+	}
+	return printValue(c.stdout, c.output, "message", "Deleted Successfully")
+}
+
+/*
+Команда import: создает записи из файла.
+Продолжает после ошибок отдельных записей и возвращает первую ошибку для кода завершения.
+*/
+func (c *command) importPersons(ctx context.Context, args []string) error {
+	flags := newFlagSet("import")
+	format := flags.String("format", "", "json, yaml, csv, ndjson (default by file extension)")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return usageError("import requires a file argument (- for stdin)")
+	}
+	path := flags.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	var reader io.Reader = c.stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+	persons, err := readPersons(reader, *format)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	created := 0
+	for i := range persons {
+		id, err := c.client.Create(ctx, &persons[i])
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintf(c.stderr, "record %d (%s): %v\n", i+1, persons[i].Email, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		persons[i].ID = id
+		created++
+	}
+	fmt.Fprintf(c.stderr, "imported %d of %d\n", created, len(persons))
+	if firstErr != nil {
+		return fmt.Errorf("%d records failed: %w", len(persons)-created, firstErr)
+	}
+	return nil
+}
+
+/*
+Функция чтения записей из файла в формате json (массив), ndjson, yaml или csv (с заголовком)
+*/
+func readPersons(reader io.Reader, format string) ([]client.Person, error) {
+	var persons []client.Person
+	switch format {
+	case "json", "-", "":
+		if err := json.NewDecoder(reader).Decode(&persons); err != nil {
+			return nil, fmt.Errorf("decode json: %w", err)
+		}
+	case "ndjson", "jsonl":
+		scanner := bufio.NewScanner(reader)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var person client.Person
+			if err := json.Unmarshal(scanner.Bytes(), &person); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			persons = append(persons, person)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	case "yaml", "yml":
+		if err := yaml.NewDecoder(reader).Decode(&persons); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("decode yaml: %w", err)
+		}
+	case "csv":
+		return readCSV(reader)
+	default:
+		return nil, usageError(fmt.Sprintf("unknown import format %q", format))
+	}
+	return persons, nil
+}
+
+/*
+Функция чтения CSV в формате выгрузки сервера (id,name,surname,age,email,telephone); столбец id не обязателен.
+Апостроф, которым сервер защищает значения от выполнения как формулы, удаляется.
+*/
+func readCSV(reader io.Reader) ([]client.Person, error) {
+	records, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("decode csv: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"name", "surname", "age", "email", "telephone"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv: column %q is missing", name)
+		}
+	}
+	persons := make([]client.Person, 0, len(records)-1)
+	for line, record := range records[1:] {
+		age, err := strconv.Atoi(record[columns["age"]])
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: invalid age %q", line+2, record[columns["age"]])
+		}
+		persons = append(persons, client.Person{
+			Name:      unescapeFormula(record[columns["name"]]),
+			Surname:   unescapeFormula(record[columns["surname"]]),
+			Age:       age,
+			Email:     unescapeFormula(record[columns["email"]]),
+			Telephone: unescapeFormula(record[columns["telephone"]]),
+		})
+	}
+	return persons, nil
+}
+
+/*
+Функция удаления апострофа перед значением, начинающимся с символа формулы (=, +, -, @, табуляция, перевод строки)
+*/
+func unescapeFormula(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune("=+-@\t\r", rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+/*
+Команда export: выгрузка в формате сервера в файл или stdout
+*/
+func (c *command) export(ctx context.Context, args []string) error {
+	flags := newFlagSet("export")
+	format := flags.String("format", "json", "json, csv, xlsx, ndjson, yaml")
+	out := flags.String("out", "", "output file (default stdout)")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return usageError("export takes only flags")
+	}
+	if *out == "" {
+		return c.client.Export(ctx, *format, c.stdout)
+	}
+	//Пишем во временный файл, чтобы не оставить обрезанную выгрузку при ошибке
+	file, err := os.CreateTemp(filepath.Dir(*out), ".personctl-export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if err := c.client.Export(ctx, *format, file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), *out)
+}
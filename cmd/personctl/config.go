@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Настройки подключения к серверу.
+Читаются из файла (~/.personctl.yaml или PERSONCTL_CONFIG), затем переопределяются переменными окружения и флагами.
+*/
+type ctlConfig struct {
+	Server   string `yaml:"server"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`
+	APIKey   string `yaml:"apiKey"`
+	Output   string `yaml:"output"`
+}
+
+// Адрес сервера по умолчанию (совпадает с bindAddr сервера)
+const defaultServer = "http://localhost:8095"
+
+/*
+Функция определения пути к файлу настроек
+*/
+func configPath(flagPath string) string {
+	if flagPath != "" {
+		return flagPath
+	}
+	if path := os.Getenv("PERSONCTL_CONFIG"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".personctl.yaml")
+}
+
+/*
+Функция загрузки настроек.
+Отсутствие файла по умолчанию не является ошибкой, явно указанный файл должен существовать.
+*/
+func loadConfig(flagPath string) (*ctlConfig, error) {
+	cfg := &ctlConfig{Server: defaultServer, Output: "table"}
+	path := configPath(flagPath)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := yaml.Unmarshal(data, cfg); err != nil {
+				return nil, fmt.Errorf("config %s: %w", path, err)
+			}
+		case errors.Is(err, os.ErrNotExist) && flagPath == "" && os.Getenv("PERSONCTL_CONFIG") == "":
+		default:
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	//Переменные окружения имеют приоритет над файлом
+	overrideFromEnv(&cfg.Server, "PERSONCTL_SERVER")
+	overrideFromEnv(&cfg.Username, "PERSONCTL_USERNAME")
+	overrideFromEnv(&cfg.Password, "PERSONCTL_PASSWORD")
+	overrideFromEnv(&cfg.Token, "PERSONCTL_TOKEN")
+	overrideFromEnv(&cfg.APIKey, "PERSONCTL_API_KEY")
+	overrideFromEnv(&cfg.Output, "PERSONCTL_OUTPUT")
+	return cfg, nil
+}
+
+func overrideFromEnv(value *string, name string) {
+	if env, ok := os.LookupEnv(name); ok {
+		*value = env
+	}
+}
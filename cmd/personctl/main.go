@@ -0,0 +1,234 @@
+/*
+personctl - консольный клиент для управления записями о персонах через API сервера.
+
+	personctl [-config file] [-server url] [-o table|json|yaml] <command> [flags] [args]
+*/
+package main
+
+import (
+	"WST_lab6_server/pkg/client"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+)
+
+/*
+Коды завершения
+*/
+const (
+	exitOK          = 0
+	exitError       = 1 // прочие ошибки
+	exitUsage       = 2 // неверные аргументы
+	exitNotFound    = 3 // 404
+	exitAuth        = 4 // 401, 403
+	exitConflict    = 5 // 409
+	exitInvalid     = 6 // 400
+	exitServer      = 7 // 5xx, 429
+	exitUnreachable = 8 // сервер недоступен
+)
+
+const usage = `Usage: personctl [global flags] <command> [flags] [args]
+
+Commands:
+  list                     all persons
+  search <query>           search persons by any field
+  get <id>                 person by id
+  add -name .. -surname .. -age .. -email .. -telephone ..
+  update <id> [-name ..] [-surname ..] [-age ..] [-email ..] [-telephone ..]
+  delete <id>              delete person
+  import [-format json|yaml|csv|ndjson] <file|->
+  export [-format json|csv|xlsx|ndjson|yaml] [-out file]
+
+Global flags:
+  -config file    config file (default ~/.personctl.yaml, env PERSONCTL_CONFIG)
+  -server url     server address (env PERSONCTL_SERVER, default http://localhost:8095)
+  -o format       output: table, json, yaml (env PERSONCTL_OUTPUT)
+
+Credentials: username/password, token or apiKey in the config file,
+or PERSONCTL_USERNAME, PERSONCTL_PASSWORD, PERSONCTL_TOKEN, PERSONCTL_API_KEY.
+
+Exit codes: 0 ok, 1 error, 2 usage, 3 not found, 4 unauthorized/forbidden,
+5 conflict, 6 invalid request, 7 server error, 8 server unreachable.
+`
+
+// Ошибка в аргументах командной строки
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+/*
+Окружение выполнения команды
+*/
+type command struct {
+	client *client.Client
+	output string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+/*
+Функция разбора глобальных флагов и запуска команды, возвращает код завершения
+*/
+func run(args []string) int {
+	global := flag.NewFlagSet("personctl", flag.ContinueOnError)
+	global.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	configFile := global.String("config", "", "config file")
+	server := global.String("server", "", "server address")
+	output := global.String("o", "", "output format")
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if global.NArg() == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "personctl:", err)
+		return exitUsage
+	}
+	//Флаги имеют приоритет над файлом и окружением
+	if *server != "" {
+		cfg.Server = *server
+	}
+	if *output != "" {
+		cfg.Output = *output
+	}
+	if cfg.Output != "table" && cfg.Output != "json" && cfg.Output != "yaml" {
+		fmt.Fprintf(os.Stderr, "personctl: unknown output format %q (table, json, yaml)\n", cfg.Output)
+		return exitUsage
+	}
+
+	var options []client.Option
+	switch {
+	case cfg.Token != "":
+		options = append(options, client.WithBearerToken(cfg.Token))
+	case cfg.APIKey != "":
+		options = append(options, client.WithAPIKey("", cfg.APIKey))
+	case cfg.Username != "":
+		options = append(options, client.WithBasicAuth(cfg.Username, cfg.Password))
+	}
+	apiClient, err := client.New(cfg.Server, options...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "personctl:", err)
+		return exitUsage
+	}
+	cmd := &command{client: apiClient, output: cfg.Output, stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+
+	//Ctrl+C прерывает текущий запрос
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = cmd.dispatch(ctx, global.Arg(0), global.Args()[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "personctl:", err)
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) {
+			for _, violation := range apiErr.Violations() {
+				fmt.Fprintf(os.Stderr, "  %s %s: %s\n", violation.In, violation.Name, violation.Message)
+			}
+		}
+	}
+	return exitCode(err)
+}
+
+/*
+Функция выбора кода завершения по ошибке (коды HTTP ответа сервера)
+*/
+func exitCode(err error) int {
+	var usageErr usageError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.Is(err, client.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, client.ErrUnauthorized), errors.Is(err, client.ErrForbidden):
+		return exitAuth
+	case errors.Is(err, client.ErrConflict):
+		return exitConflict
+	case errors.Is(err, client.ErrBadRequest):
+		return exitInvalid
+	case errors.Is(err, client.ErrServer), errors.Is(err, client.ErrUnavailable),
+		errors.Is(err, client.ErrTimeout), errors.Is(err, client.ErrRateLimited):
+		return exitServer
+	case errors.As(err, &netErr):
+		return exitUnreachable
+	}
+	return exitError
+}
+
+/*
+Метод выбора команды
+*/
+func (c *command) dispatch(ctx context.Context, name string, args []string) error {
+	switch name {
+	case "list":
+		return c.list(ctx, args)
+	case "search":
+		return c.search(ctx, args)
+	case "get":
+		return c.get(ctx, args)
+	case "add":
+		return c.add(ctx, args)
+	case "update":
+		return c.update(ctx, args)
+	case "delete":
+		return c.delete(ctx, args)
+	case "import":
+		return c.importPersons(ctx, args)
+	case "export":
+		return c.export(ctx, args)
+	case "help":
+		fmt.Fprint(c.stdout, usage)
+		return nil
+	}
+	return usageError(fmt.Sprintf("unknown command %q, see personctl help", name))
+}
+
+/*
+Функция разбора id из аргумента
+*/
+func parseID(args []string) (uint, error) {
+	if len(args) != 1 {
+		return 0, usageError("exactly one id argument is required")
+	}
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil || id == 0 {
+		return 0, usageError(fmt.Sprintf("invalid id %q", args[0]))
+	}
+	return uint(id), nil
+}
+
+/*
+Функция создания набора флагов команды с ошибкой использования вместо выхода
+*/
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return flags
+}
+
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return usageError(fmt.Sprintf("%s: %v", flags.Name(), err))
+	}
+	return nil
+}
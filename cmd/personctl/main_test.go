@@ -0,0 +1,304 @@
+package main
+
+import (
+	"WST_lab6_server/pkg/client"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+/*
+Тестовый сервер API: запросы записываются, ответ выбирается обработчиком
+*/
+type testServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+	bodies   []string
+}
+
+func newTestServer(t *testing.T, handler http.HandlerFunc) *testServer {
+	t.Helper()
+	server := &testServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		server.mu.Lock()
+		server.requests = append(server.requests, r.Method+" "+r.URL.Path)
+		server.bodies = append(server.bodies, string(body))
+		server.mu.Unlock()
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+/*
+Функция запуска personctl с файлом настроек для сервера serverURL: код завершения, stdout и stderr
+*/
+func runCtl(t *testing.T, serverURL string, args ...string) (int, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "personctl.yaml")
+	if err := os.WriteFile(configFile, []byte("server: "+serverURL+"\nusername: root\npassword: password\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	files := make([]*os.File, 2)
+	for i, name := range []string{"stdout", "stderr"} {
+		file, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		files[i] = file
+	}
+	savedOut, savedErr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = files[0], files[1]
+	code := run(append([]string{"-config", configFile}, args...))
+	os.Stdout, os.Stderr = savedOut, savedErr
+	stdout, _ := os.ReadFile(files[0].Name())
+	stderr, _ := os.ReadFile(files[1].Name())
+	return code, string(stdout), string(stderr)
+}
+
+func writeProblem(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(client.Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Errors: []client.Violation{{In: "body", Name: "/telephone", Message: "invalid"}},
+	})
+}
+
+func TestExitCodes(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/person/1":
+			w.Write([]byte(`{"id":1,"name":"Olga","surname":"Ditr","age":34,"email":"olga@mail.com","telephone":"+70011234576"}`))
+		case "/api/v1/person/2":
+			writeProblem(w, http.StatusNotFound)
+		case "/api/v1/person/3":
+			writeProblem(w, http.StatusUnauthorized)
+		case "/api/v1/person/4":
+			writeProblem(w, http.StatusForbidden)
+		case "/api/v1/person/5":
+			writeProblem(w, http.StatusConflict)
+		case "/api/v1/person/6":
+			writeProblem(w, http.StatusBadRequest)
+		default:
+			writeProblem(w, http.StatusInternalServerError)
+		}
+	})
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"get", "1"}, exitOK},
+		{[]string{"get", "2"}, exitNotFound},
+		{[]string{"get", "3"}, exitAuth},
+		{[]string{"delete", "4"}, exitAuth},
+		{[]string{"delete", "5"}, exitConflict},
+		{[]string{"delete", "6"}, exitInvalid},
+		{[]string{"get", "7"}, exitServer},
+		{[]string{}, exitUsage},
+		{[]string{"deploy"}, exitUsage},
+		{[]string{"get", "abc"}, exitUsage},
+		{[]string{"get", "0"}, exitUsage},
+		{[]string{"update", "1"}, exitUsage},
+		{[]string{"list", "extra"}, exitUsage},
+		{[]string{"-o", "xml", "list"}, exitUsage},
+		{[]string{"import", "-format", "xml", "-"}, exitUsage},
+	}
+	for _, test := range tests {
+		code, stdout, stderr := runCtl(t, server.URL, test.args...)
+		if code != test.code {
+			t.Errorf("%v: exit %d, want %d\nstdout: %s\nstderr: %s", test.args, code, test.code, stdout, stderr)
+		}
+	}
+	//Нарушения из ответа 400 выводятся построчно
+	if _, _, stderr := runCtl(t, server.URL, "delete", "6"); !strings.Contains(stderr, "body /telephone: invalid") {
+		t.Errorf("violations not printed: %s", stderr)
+	}
+	if code, stdout, _ := runCtl(t, server.URL, "-o", "json", "get", "1"); code != exitOK || !strings.Contains(stdout, `"email": "olga@mail.com"`) {
+		t.Errorf("get -o json: exit %d: %s", code, stdout)
+	}
+}
+
+func TestExitCodeUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	if code, _, stderr := runCtl(t, server.URL, "get", "1"); code != exitUnreachable {
+		t.Errorf("exit %d, want %d: %s", code, exitUnreachable, stderr)
+	}
+}
+
+func TestUpdateMaskedPerson(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"id":1,"name":"Olga","surname":"Ditr","age":34,"email":"o***@mail.com","telephone":"+7*******576"}`))
+			return
+		}
+		w.Write([]byte(`{"message":"Person updated successfully!"}`))
+	})
+	code, _, stderr := runCtl(t, server.URL, "update", "1", "-surname", "Berig", "-email", "olga@mail.com")
+	if code != exitError || !strings.Contains(stderr, "pass -telephone explicitly") {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if len(server.requests) != 1 || server.requests[0] != "GET /api/v1/person/1" {
+		t.Fatalf("requests %v", server.requests)
+	}
+	//Скрытые поля указаны флагами: отправляются значения из флагов
+	code, _, stderr = runCtl(t, server.URL, "update", "1", "-surname", "Berig", "-email", "olga@mail.com", "-telephone", "+70011234576")
+	if code != exitOK || server.requests[2] != "PUT /api/v1/person/1" {
+		t.Fatalf("exit %d, requests %v: %s", code, server.requests, stderr)
+	}
+	var sent client.Person
+	if err := json.Unmarshal([]byte(server.bodies[2]), &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent != (client.Person{Name: "Olga", Surname: "Berig", Age: 34, Email: "olga@mail.com", Telephone: "+70011234576"}) {
+		t.Errorf("sent %+v", sent)
+	}
+}
+
+func TestUpdateKeepsOtherFields(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"id":1,"name":"Olga","surname":"Ditr","age":34,"email":"olga@mail.com","telephone":"+70011234576"}`))
+			return
+		}
+		w.Write([]byte(`{"message":"Person updated successfully!"}`))
+	})
+	if code, _, stderr := runCtl(t, server.URL, "update", "1", "-age", "35"); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	var sent client.Person
+	if err := json.Unmarshal([]byte(server.bodies[1]), &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent != (client.Person{Name: "Olga", Surname: "Ditr", Age: 35, Email: "olga@mail.com", Telephone: "+70011234576"}) {
+		t.Errorf("sent %+v", sent)
+	}
+}
+
+func TestReadPersons(t *testing.T) {
+	want := client.Person{Name: "Olga", Surname: "Ditr", Age: 34, Email: "olga@mail.com", Telephone: "+70011234576"}
+	inputs := map[string]string{
+		"json":   `[{"name":"Olga","surname":"Ditr","age":34,"email":"olga@mail.com","telephone":"+70011234576"}]`,
+		"ndjson": "\n{\"name\":\"Olga\",\"surname\":\"Ditr\",\"age\":34,\"email\":\"olga@mail.com\",\"telephone\":\"+70011234576\"}\n\n",
+		"yaml":   "- name: Olga\n  surname: Ditr\n  age: 34\n  email: olga@mail.com\n  telephone: \"+70011234576\"\n",
+		"csv":    "id,name,surname,age,email,telephone\n7,Olga,Ditr,34,olga@mail.com,+70011234576\n",
+		//Порядок столбцов произвольный, id не обязателен
+		"csv columns": "Telephone, email ,age,surname,name\n+70011234576,olga@mail.com,34,Ditr,Olga\n",
+	}
+	for name, input := range inputs {
+		format, _, _ := strings.Cut(name, " ")
+		persons, err := readPersons(strings.NewReader(input), format)
+		if err != nil || len(persons) != 1 || persons[0] != want {
+			t.Errorf("%s: %+v, %v", name, persons, err)
+		}
+	}
+	//Значения, защищенные сервером от выполнения как формулы, восстанавливаются
+	persons, err := readPersons(strings.NewReader("name,surname,age,email,telephone\n'=1+2,'-Ditr,34,'@mail,+70011234576\n"), "csv")
+	if err != nil || persons[0].Name != "=1+2" || persons[0].Surname != "-Ditr" || persons[0].Email != "@mail" {
+		t.Errorf("csv formulas: %+v, %v", persons, err)
+	}
+	if persons, err := readPersons(strings.NewReader(""), "yaml"); err != nil || len(persons) != 0 {
+		t.Errorf("empty yaml: %+v, %v", persons, err)
+	}
+	failures := map[string]string{
+		"json":   `{"name":"Olga"}`,
+		"ndjson": "{\"name\":\"Olga\"}\n{broken\n",
+		"csv":    "name,surname,age,email\nOlga,Ditr,34,olga@mail.com\n",
+		"yaml":   "name: [",
+	}
+	for format, input := range failures {
+		if _, err := readPersons(strings.NewReader(input), format); err == nil {
+			t.Errorf("%s: invalid input accepted", format)
+		}
+	}
+	if _, err := readPersons(strings.NewReader("name,surname,age,email,telephone\nOlga,Ditr,old,olga@mail.com,+70011234576\n"), "csv"); err == nil ||
+		!strings.Contains(err.Error(), `line 2: invalid age "old"`) {
+		t.Errorf("csv age: %v", err)
+	}
+	var usageErr usageError
+	if _, err := readPersons(strings.NewReader(""), "xml"); !errors.As(err, &usageErr) {
+		t.Errorf("unknown format: %v", err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":10}`))
+	})
+	path := filepath.Join(t.TempDir(), "persons.csv")
+	os.WriteFile(path, []byte("name,surname,age,email,telephone\nOlga,Ditr,34,olga@mail.com,+70011234576\nIvan,Ivanov,30,ivan@mail.com,+79990000001\n"), 0o600)
+	code, _, stderr := runCtl(t, server.URL, "import", path)
+	if code != exitOK || !strings.Contains(stderr, "imported 2 of 2") || len(server.requests) != 2 || server.requests[0] != "POST /api/v1/persons" {
+		t.Fatalf("exit %d, requests %v: %s", code, server.requests, stderr)
+	}
+	var sent client.Person
+	if err := json.Unmarshal([]byte(server.bodies[1]), &sent); err != nil || sent.Email != "ivan@mail.com" || sent.Age != 30 {
+		t.Errorf("sent %+v, %v", sent, err)
+	}
+}
+
+func TestImportPartialFailure(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":10}`))
+	})
+	conflict := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, http.StatusConflict)
+	})
+	path := filepath.Join(t.TempDir(), "persons.json")
+	os.WriteFile(path, []byte(`[{"name":"Olga","email":"olga@mail.com"},{"name":"Ivan","email":"ivan@mail.com"}]`), 0o600)
+	if code, _, stderr := runCtl(t, server.URL, "import", path); code != exitOK || !strings.Contains(stderr, "imported 2 of 2") {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	//Ошибки отдельных записей не прерывают импорт, код завершения - по первой ошибке
+	code, _, stderr := runCtl(t, conflict.URL, "import", path)
+	if code != exitConflict || !strings.Contains(stderr, "record 2 (ivan@mail.com)") || !strings.Contains(stderr, "imported 0 of 2") || len(conflict.requests) != 2 {
+		t.Fatalf("exit %d, requests %v: %s", code, conflict.requests, stderr)
+	}
+}
+
+func TestExport(t *testing.T) {
+	const body = "id,name\n1,Olga\n"
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "csv" {
+			writeProblem(w, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte(body))
+	})
+	if code, stdout, stderr := runCtl(t, server.URL, "export", "-format", "csv"); code != exitOK || stdout != body {
+		t.Fatalf("stdout: exit %d, %q: %s", code, stdout, stderr)
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "persons.csv")
+	if code, _, stderr := runCtl(t, server.URL, "export", "-format", "csv", "-out", out); code != exitOK {
+		t.Fatalf("file: exit %d: %s", code, stderr)
+	}
+	if data, err := os.ReadFile(out); err != nil || string(data) != body {
+		t.Fatalf("file %q, %v", data, err)
+	}
+	//При ошибке файл не создается и временный файл удаляется
+	failed := filepath.Join(dir, "failed.xml")
+	if code, _, _ := runCtl(t, server.URL, "export", "-format", "xml", "-out", failed); code != exitInvalid {
+		t.Errorf("invalid format: exit %d", code)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("files left in output directory: %v", entries)
+	}
+}
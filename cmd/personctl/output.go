@@ -0,0 +1,47 @@
+package main
+
+import (
+	"WST_lab6_server/pkg/client"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Функция вывода записей в выбранном формате: table, json или yaml
+*/
+func printPersons(w io.Writer, output string, persons []client.Person) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(persons)
+	case "yaml":
+		return yaml.NewEncoder(w).Encode(persons)
+	case "table":
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "ID\tNAME\tSURNAME\tAGE\tEMAIL\tTELEPHONE")
+		for _, p := range persons {
+			fmt.Fprintf(table, "%d\t%s\t%s\t%d\t%s\t%s\n", p.ID, p.Name, p.Surname, p.Age, p.Email, p.Telephone)
+		}
+		return table.Flush()
+	}
+	return usageError(fmt.Sprintf("unknown output format %q (table, json, yaml)", output))
+}
+
+/*
+Функция вывода одного значения (id, сообщение) в выбранном формате
+*/
+func printValue(w io.Writer, output string, key string, value any) error {
+	switch output {
+	case "json":
+		return json.NewEncoder(w).Encode(map[string]any{key: value})
+	case "yaml":
+		return yaml.NewEncoder(w).Encode(map[string]any{key: value})
+	}
+	_, err := fmt.Fprintln(w, value)
+	return err
+}
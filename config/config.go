@@ -2,12 +2,14 @@ package config
 
 import (
 	"WST_lab6_server/internal/models"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sync/atomic"
 	"time"
 
-	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 )
 
@@ -15,7 +17,18 @@ import (
 type Config struct {
 	GeneralServer GeneralServerConfig `yaml:"generalServer"`
 	HTTPServer    HTTPServerConfig    `yaml:"httpServer"`
+	GRPCServer    GRPCServerConfig    `yaml:"grpcServer"`
+	GraphQL       GraphQLConfig       `yaml:"graphql"`
+	Events        EventsConfig        `yaml:"events"`
+	Webhooks      WebhooksConfig      `yaml:"webhooks"`
+	Outbox        OutboxConfig        `yaml:"outbox"`
+	Cache         CacheConfig         `yaml:"cache"`
+	Compression   CompressionConfig   `yaml:"compression"`
 	Database      DatabaseConfig      `yaml:"database"`
+	Tracing       TracingConfig       `yaml:"tracing"`
+	Logging       LoggingConfig       `yaml:"logging"`
+	Auth          AuthConfig          `yaml:"auth"`
+	PII           PIIConfig           `yaml:"pii"`
 }
 
 // Структура конфигурации сервера
@@ -31,6 +44,114 @@ type HTTPServerConfig struct {
 	BindAddr     string        `yaml:"bindAddr"`
 	ReadTimeout  time.Duration `yaml:"readTimeout"`
 	WriteTimeout time.Duration `yaml:"writeTimeout"`
+	//Пауза между снятием готовности и остановкой сервера
+	ShutdownDelay time.Duration `yaml:"shutdownDelay"`
+	//Ограничение времени завершения активных запросов при остановке
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	//Ограничение времени одной проверки состояния
+	HealthCheckTimeout time.Duration `yaml:"healthCheckTimeout"`
+	//Заголовок Cache-Control успешных ответов на GET по шаблону маршрута gin ("/api/v1/person/:id")
+	CacheControl map[string]string `yaml:"cacheControl"`
+	//Наибольший размер тела запроса в байтах и ограничения по шаблону маршрута gin
+	MaxBodySize int64            `yaml:"maxBodySize"`
+	BodyLimits  map[string]int64 `yaml:"bodyLimits"`
+	//Наибольшее количество строк выгрузки XLSX: книга собирается целиком перед отправкой (0 - 100000)
+	MaxXLSXRows int `yaml:"maxXLSXRows"`
+}
+
+// Структура конфигурации gRPC сервера
+type GRPCServerConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	BindAddr string `yaml:"bindAddr"`
+	//Описание сервисов для grpcurl и других клиентов без .proto файлов
+	Reflection bool `yaml:"reflection"`
+	//Размер страницы List и Search (0 - 100 и 1000), все записи без страниц выдает ListStream
+	DefaultPageSize int `yaml:"defaultPageSize"`
+	MaxPageSize     int `yaml:"maxPageSize"`
+}
+
+// Структура ограничений GraphQL запросов (0 - значение по умолчанию)
+type GraphQLConfig struct {
+	//Максимальная вложенность полей
+	MaxDepth int `yaml:"maxDepth"`
+	//Максимальная оценка стоимости запроса: поле стоит 1, поля списков умножаются на размер страницы
+	MaxComplexity   int `yaml:"maxComplexity"`
+	DefaultPageSize int `yaml:"defaultPageSize"`
+	MaxPageSize     int `yaml:"maxPageSize"`
+}
+
+// Структура ленты изменений (SSE и WebSocket, 0 - значение по умолчанию)
+// Лента изменений хранится в памяти процесса и рассчитана на один экземпляр сервера
+type EventsConfig struct {
+	//Количество последних событий для продолжения по Last-Event-ID
+	LogSize int `yaml:"logSize"`
+	//Очередь событий подписчика; при переполнении медленный подписчик отключается
+	SubscriberBuffer int `yaml:"subscriberBuffer"`
+	//Интервал комментариев SSE и ping WebSocket для поддержания соединения
+	HeartbeatInterval time.Duration `yaml:"heartbeatInterval"`
+}
+
+// Структура доставки webhook (0 - значение по умолчанию)
+type WebhooksConfig struct {
+	Enabled bool `yaml:"enabled"`
+	//Количество попыток, после которого доставка переходит в состояние dead
+	MaxAttempts int `yaml:"maxAttempts"`
+	//Пауза перед повтором: initialBackoff * 2^(попытка-1), не более maxBackoff
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+	//Ограничение времени одного запроса к получателю
+	Timeout time.Duration `yaml:"timeout"`
+	//Количество одновременных отправок
+	Workers int `yaml:"workers"`
+	//Интервал проверки очереди доставок
+	PollInterval time.Duration `yaml:"pollInterval"`
+	//Роль, по правилам pii.redaction которой скрываются email и телефон в теле доставки (по умолчанию viewer)
+	PayloadRole string `yaml:"payloadRole"`
+	//Разрешить получателей в loopback, частных и link-local сетях (только для разработки)
+	AllowPrivateTargets bool `yaml:"allowPrivateTargets"`
+}
+
+// Структура диспетчера outbox: доставка событий из таблицы outbox_events (0 - значение по умолчанию)
+type OutboxConfig struct {
+	//Интервал проверки таблицы; после записи диспетчер пробуждается сразу
+	PollInterval time.Duration `yaml:"pollInterval"`
+	//Количество событий, выбираемых за один запрос
+	BatchSize int `yaml:"batchSize"`
+	//Время, на которое выбранные события закрепляются за экземпляром сервера
+	Lease time.Duration `yaml:"lease"`
+	//Пауза перед повтором после ошибки получателя: initialBackoff * 2^(попытка-1), не более maxBackoff
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+	//Количество попыток, после которого событие отмечается dead и не задерживает следующие события записи
+	MaxAttempts int `yaml:"maxAttempts"`
+	//Срок хранения доставленных событий
+	Retention time.Duration `yaml:"retention"`
+	//Получатели событий: events (лента изменений), webhooks, log
+	Sinks []string `yaml:"sinks"`
+}
+
+// Структура кэша чтения записей (0 - значение по умолчанию)
+type CacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+	//Хранилище кэша: memory (LRU в памяти процесса)
+	Backend string `yaml:"backend"`
+	//Максимальное количество значений в памяти
+	MaxEntries int `yaml:"maxEntries"`
+	//Время жизни значения; ограничивает устаревание при изменениях другими экземплярами сервера
+	TTL time.Duration `yaml:"ttl"`
+	//Результаты поиска с большим количеством записей не кэшируются
+	MaxSearchResults int `yaml:"maxSearchResults"`
+}
+
+// Структура сжатия ответов и распаковки тел запросов (0 - значение по умолчанию)
+type CompressionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	//Ответы меньше minSize байт передаются без сжатия
+	MinSize int `yaml:"minSize"`
+	//Сжимаемые типы содержимого ("text/*" - все текстовые)
+	ContentTypes []string `yaml:"contentTypes"`
+	//Ограничение размера распакованного тела запроса (Content-Encoding)
+	MaxDecompressedSize int64 `yaml:"maxDecompressedSize"`
 }
 
 // Структура конфигурации подключения к базе данных
@@ -41,48 +162,182 @@ type DatabaseConfig struct {
 	Name     string `yaml:"name"`
 	Port     int    `yaml:"port"`
 	SSLMode  string `yaml:"sslMode"`
+	//Размер порции при потоковой выдаче записей
+	StreamBatchSize int `yaml:"streamBatchSize"`
+	//Очистить таблицу people и заполнить ее из generalServer.persons при запуске
+	SeedOnStart bool `yaml:"seedOnStart"`
+	//Ограничения времени выполнения запросов
+	Timeouts QueryTimeoutConfig `yaml:"timeouts"`
+	//Настройки пула соединений
+	Pool PoolConfig `yaml:"pool"`
+	//Повторные попытки подключения при старте
+	Connect ConnectRetryConfig `yaml:"connect"`
+}
+
+// Структура настроек пула соединений (0 - значение по умолчанию database/sql)
+type PoolConfig struct {
+	MaxOpenConns    int           `yaml:"maxOpenConns"`
+	MaxIdleConns    int           `yaml:"maxIdleConns"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"connMaxIdleTime"`
+}
+
+// Структура настроек повторного подключения к базе данных
+type ConnectRetryConfig struct {
+	Attempts     int           `yaml:"attempts"`
+	InitialDelay time.Duration `yaml:"initialDelay"`
+	MaxDelay     time.Duration `yaml:"maxDelay"`
+}
+
+// Структура ограничений времени выполнения запросов по типам операций (0 - без ограничения)
+type QueryTimeoutConfig struct {
+	Read   time.Duration `yaml:"read"`
+	Write  time.Duration `yaml:"write"`
+	Search time.Duration `yaml:"search"`
+	Stream time.Duration `yaml:"stream"`
+}
+
+// Структура конфигурации трассировки OpenTelemetry
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	ServiceName string  `yaml:"serviceName"`
+	Exporter    string  `yaml:"exporter"` // otlp-grpc, otlp-http, stdout, file, none
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	FilePath    string  `yaml:"filePath"`
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
+// Структура конфигурации журнала (уровень задается в generalServer.logLevel)
+type LoggingConfig struct {
+	Outputs  []LogOutputConfig `yaml:"outputs"`
+	Rotation LogRotationConfig `yaml:"rotation"`
+	//Порог медленного SQL запроса для журнала GORM
+	SlowQueryThreshold time.Duration `yaml:"slowQueryThreshold"`
+}
+
+// Структура вывода журнала: stdout, stderr или путь к файлу
+type LogOutputConfig struct {
+	Path   string `yaml:"path"`
+	Format string `yaml:"format"` // json, console
+}
+
+// Структура ротации файлов журнала
+type LogRotationConfig struct {
+	//Размер файла, после которого начинается новый (0 - 100 МБ, значение по умолчанию lumberjack)
+	MaxSizeMB int `yaml:"maxSizeMB"`
+	//Срок хранения и количество старых файлов (0 - без ограничения)
+	MaxAgeDays int  `yaml:"maxAgeDays"`
+	MaxBackups int  `yaml:"maxBackups"`
+	Compress   bool `yaml:"compress"`
+}
+
+// Структура конфигурации аутентификации
+type AuthConfig struct {
+	Users []UserConfig `yaml:"users"`
+	//Роль запросов чтения без учетных данных
+	AnonymousRole string `yaml:"anonymousRole"`
+}
+
+// Структура пользователя: имя, bcrypt хеш пароля и роль (admin, editor, viewer)
+type UserConfig struct {
+	Username     string `yaml:"username"`
+	PasswordHash string `yaml:"passwordHash"`
+	Role         string `yaml:"role"`
+}
+
+// Структура политики персональных данных
+type PIIConfig struct {
+	//Маскировать email и телефоны в журнале
+	MaskLogs bool `yaml:"maskLogs"`
+	//Скрываемые в ответах поля по ролям (email, telephone)
+	Redaction map[string][]string `yaml:"redaction"`
 }
 
 // Переменные конфигурации
 var (
 	config               Config
+	loaded               atomic.Bool
 	GeneralServerSetting = &GeneralServerConfig{}
 	HTTPServerSetting    = &HTTPServerConfig{}
+	GRPCServerSetting    = &GRPCServerConfig{}
+	GraphQLSetting       = &GraphQLConfig{}
+	EventsSetting        = &EventsConfig{}
+	WebhooksSetting      = &WebhooksConfig{}
+	OutboxSetting        = &OutboxConfig{}
+	CacheSetting         = &CacheConfig{}
+	CompressionSetting   = &CompressionConfig{}
 	DatabaseSetting      = &DatabaseConfig{}
+	TracingSetting       = &TracingConfig{}
+	LoggingSetting       = &LoggingConfig{}
+	AuthSetting          = &AuthConfig{}
+	PIISetting           = &PIIConfig{}
 )
 
 // Функция инициализации конфигурации
 func Init() {
-	var pathConfigFile string
+	if err := Load(DefaultPath()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/*
+Функция выбора файла конфигурации по имени компьютера
+*/
+func DefaultPath() string {
 	hostname, err := os.Hostname()
 	if err != nil {
 		fmt.Println(err)
 	}
 	//Проверяем hostname для загрузки нужной конфигурации
 	if hostname == "test-XWPC" {
-		pathConfigFile = "config/vm.yaml"
-	} else {
-		pathConfigFile = "config/pc.yaml"
+		return "config/vm.yaml"
 	}
+	return "config/pc.yaml"
+}
+
+/*
+Функция загрузки конфигурации из файла
+*/
+func Load(pathConfigFile string) error {
 	//Открываем файл конфигурации
 	file, err := os.Open(pathConfigFile)
 	if err != nil {
-		log.Fatal("error opening file config", zap.Error(err))
+		return fmt.Errorf("error opening file config: %w", err)
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			log.Fatal("error closing file config", zap.Error(err))
-		}
-	}(file)
+	defer file.Close()
 	//Читаем файл конфигурации
 	decoder := yaml.NewDecoder(file)
 	//Привязываем переменные конфигурации
-	if err := decoder.Decode(&config); err != nil {
-		log.Fatal("error decoding file config", zap.Error(err))
+	var cfg Config
+	if err := decoder.Decode(&cfg); err != nil {
+		return fmt.Errorf("error decoding file config %s: %w", pathConfigFile, err)
 	}
+	config = cfg
 	*GeneralServerSetting = config.GeneralServer
 	*HTTPServerSetting = config.HTTPServer
+	*GRPCServerSetting = config.GRPCServer
+	*GraphQLSetting = config.GraphQL
+	*EventsSetting = config.Events
+	*WebhooksSetting = config.Webhooks
+	*OutboxSetting = config.Outbox
+	*CacheSetting = config.Cache
+	*CompressionSetting = config.Compression
 	*DatabaseSetting = config.Database
+	*TracingSetting = config.Tracing
+	*LoggingSetting = config.Logging
+	*AuthSetting = config.Auth
+	*PIISetting = config.PII
+	loaded.Store(true)
+	return nil
+}
 
+/*
+Функция проверки загрузки конфигурации для отчета о состоянии
+*/
+func HealthCheck(ctx context.Context) (any, error) {
+	if !loaded.Load() {
+		return nil, errors.New("config not loaded")
+	}
+	return map[string]string{"env": GeneralServerSetting.Env}, nil
 }
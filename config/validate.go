@@ -0,0 +1,221 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Допустимые значения (роли совпадают с константами пакета middleware)
+var (
+	validRunModes  = []string{"", "debug", "release", "test"}
+	validLogLevels = []string{"", "debug", "info", "warn", "error", "fatal"}
+	validExporters = []string{"", "none", "otlp", "otlp-grpc", "otlp-http", "stdout", "file"}
+	validFormats   = []string{"", "json", "console"}
+	validRoles     = []string{"admin", "editor", "viewer"}
+	validPIIFields = []string{"email", "telephone"}
+)
+
+/*
+Функция проверки файла конфигурации без применения.
+В отличие от Load неизвестные ключи считаются ошибкой, чтобы опечатки не оставались незамеченными.
+Возвращает список всех найденных проблем.
+*/
+func Check(pathConfigFile string) []error {
+	data, err := os.ReadFile(pathConfigFile)
+	if err != nil {
+		return []error{fmt.Errorf("error opening file config: %w", err)}
+	}
+	var cfg Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil {
+		return []error{fmt.Errorf("error decoding file config %s: %w", pathConfigFile, err)}
+	}
+	return Validate(&cfg)
+}
+
+/*
+Функция проверки значений конфигурации
+*/
+func Validate(cfg *Config) []error {
+	var problems []error
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if cfg.GeneralServer.Env == "" {
+		add("generalServer.env is required")
+	}
+	if !slices.Contains(validLogLevels, cfg.GeneralServer.LogLevel) {
+		add("generalServer.logLevel %q is not one of %v", cfg.GeneralServer.LogLevel, validLogLevels[1:])
+	}
+	for i, person := range cfg.GeneralServer.DataSet {
+		if person.Name == "" || person.Surname == "" || person.Email == "" {
+			add("generalServer.persons[%d]: name, surname and email are required", i)
+		}
+	}
+
+	if !slices.Contains(validRunModes, cfg.HTTPServer.RunMode) {
+		add("httpServer.runMode %q is not one of %v", cfg.HTTPServer.RunMode, validRunModes[1:])
+	}
+	if cfg.HTTPServer.BindAddr != "" {
+		if _, _, err := net.SplitHostPort(cfg.HTTPServer.BindAddr); err != nil {
+			add("httpServer.bindAddr: %v", err)
+		}
+	}
+	if cfg.HTTPServer.ReadTimeout < 0 || cfg.HTTPServer.WriteTimeout < 0 || cfg.HTTPServer.ShutdownDelay < 0 ||
+		cfg.HTTPServer.ShutdownTimeout < 0 || cfg.HTTPServer.HealthCheckTimeout < 0 {
+		add("httpServer: durations must not be negative")
+	}
+	if cfg.HTTPServer.MaxBodySize < 0 {
+		add("httpServer.maxBodySize must not be negative")
+	}
+	if cfg.HTTPServer.MaxXLSXRows < 0 {
+		add("httpServer.maxXLSXRows must not be negative")
+	}
+	for route, limit := range cfg.HTTPServer.BodyLimits {
+		if limit <= 0 {
+			add("httpServer.bodyLimits[%q] must be positive", route)
+		}
+	}
+
+	if cfg.GRPCServer.Enabled {
+		if _, _, err := net.SplitHostPort(cfg.GRPCServer.BindAddr); err != nil {
+			add("grpcServer.bindAddr: %v", err)
+		} else if cfg.GRPCServer.BindAddr == cfg.HTTPServer.BindAddr {
+			add("grpcServer.bindAddr must differ from httpServer.bindAddr")
+		}
+	}
+	if cfg.GRPCServer.DefaultPageSize < 0 || cfg.GRPCServer.MaxPageSize < 0 {
+		add("grpcServer: page sizes must not be negative")
+	}
+	if cfg.GRPCServer.MaxPageSize > 0 && cfg.GRPCServer.DefaultPageSize > cfg.GRPCServer.MaxPageSize {
+		add("grpcServer.defaultPageSize %d exceeds maxPageSize %d", cfg.GRPCServer.DefaultPageSize, cfg.GRPCServer.MaxPageSize)
+	}
+
+	graphql := cfg.GraphQL
+	if graphql.MaxDepth < 0 || graphql.MaxComplexity < 0 || graphql.DefaultPageSize < 0 || graphql.MaxPageSize < 0 {
+		add("graphql: limits must not be negative")
+	}
+	if graphql.MaxPageSize > 0 && graphql.DefaultPageSize > graphql.MaxPageSize {
+		add("graphql.defaultPageSize %d exceeds maxPageSize %d", graphql.DefaultPageSize, graphql.MaxPageSize)
+	}
+	if cfg.Events.LogSize < 0 || cfg.Events.SubscriberBuffer < 0 || cfg.Events.HeartbeatInterval < 0 {
+		add("events: sizes and heartbeatInterval must not be negative")
+	}
+	webhooks := cfg.Webhooks
+	if webhooks.MaxAttempts < 0 || webhooks.Workers < 0 || webhooks.InitialBackoff < 0 || webhooks.MaxBackoff < 0 || webhooks.Timeout < 0 || webhooks.PollInterval < 0 {
+		add("webhooks: limits must not be negative")
+	}
+	if webhooks.MaxBackoff > 0 && webhooks.InitialBackoff > webhooks.MaxBackoff {
+		add("webhooks.initialBackoff %s exceeds maxBackoff %s", webhooks.InitialBackoff, webhooks.MaxBackoff)
+	}
+	if webhooks.PayloadRole != "" && !slices.Contains(validRoles, webhooks.PayloadRole) {
+		add("webhooks.payloadRole %q is not one of %v", webhooks.PayloadRole, validRoles)
+	}
+	outbox := cfg.Outbox
+	if outbox.PollInterval < 0 || outbox.BatchSize < 0 || outbox.Lease < 0 || outbox.InitialBackoff < 0 || outbox.MaxBackoff < 0 || outbox.MaxAttempts < 0 || outbox.Retention < 0 {
+		add("outbox: limits must not be negative")
+	}
+	if outbox.MaxBackoff > 0 && outbox.InitialBackoff > outbox.MaxBackoff {
+		add("outbox.initialBackoff %s exceeds maxBackoff %s", outbox.InitialBackoff, outbox.MaxBackoff)
+	}
+	for _, sink := range outbox.Sinks {
+		if !slices.Contains([]string{"events", "webhooks", "log"}, sink) {
+			add("outbox.sinks: unknown sink %q (events, webhooks, log)", sink)
+		}
+	}
+	cache := cfg.Cache
+	if cache.MaxEntries < 0 || cache.TTL < 0 || cache.MaxSearchResults < 0 {
+		add("cache: limits must not be negative")
+	}
+	if cache.Backend != "" && cache.Backend != "memory" {
+		add("cache.backend %q is not supported (memory)", cache.Backend)
+	}
+	if cfg.Compression.MinSize < 0 || cfg.Compression.MaxDecompressedSize < 0 {
+		add("compression: sizes must not be negative")
+	}
+
+	if cfg.Database.Host == "" {
+		add("database.host is required")
+	}
+	if cfg.Database.Name == "" {
+		add("database.name is required")
+	}
+	if cfg.Database.Port <= 0 || cfg.Database.Port > 65535 {
+		add("database.port %d is out of range", cfg.Database.Port)
+	}
+	if cfg.Database.StreamBatchSize < 0 {
+		add("database.streamBatchSize must not be negative")
+	}
+	timeouts := cfg.Database.Timeouts
+	if timeouts.Read < 0 || timeouts.Write < 0 || timeouts.Search < 0 || timeouts.Stream < 0 {
+		add("database.timeouts must not be negative")
+	}
+	pool := cfg.Database.Pool
+	if pool.MaxOpenConns > 0 && pool.MaxIdleConns > pool.MaxOpenConns {
+		add("database.pool.maxIdleConns %d exceeds maxOpenConns %d", pool.MaxIdleConns, pool.MaxOpenConns)
+	}
+
+	exporter := strings.ToLower(cfg.Tracing.Exporter)
+	if !slices.Contains(validExporters, exporter) {
+		add("tracing.exporter %q is not one of %v", cfg.Tracing.Exporter, validExporters[1:])
+	}
+	if cfg.Tracing.Enabled && exporter == "file" && cfg.Tracing.FilePath == "" {
+		add("tracing.filePath is required for the file exporter")
+	}
+	if cfg.Tracing.Enabled && strings.HasPrefix(exporter, "otlp") && cfg.Tracing.Endpoint == "" {
+		add("tracing.endpoint is required for the %s exporter", exporter)
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		add("tracing.sampleRatio %v must be between 0 and 1", cfg.Tracing.SampleRatio)
+	}
+
+	for i, output := range cfg.Logging.Outputs {
+		if output.Path == "" {
+			add("logging.outputs[%d].path is required", i)
+		}
+		if !slices.Contains(validFormats, output.Format) {
+			add("logging.outputs[%d].format %q is not one of %v", i, output.Format, validFormats[1:])
+		}
+	}
+
+	if cfg.Auth.AnonymousRole != "" && !slices.Contains(validRoles, cfg.Auth.AnonymousRole) {
+		add("auth.anonymousRole %q is not one of %v", cfg.Auth.AnonymousRole, validRoles)
+	}
+	seen := map[string]bool{}
+	for i, user := range cfg.Auth.Users {
+		if user.Username == "" {
+			add("auth.users[%d].username is required", i)
+		}
+		if seen[user.Username] {
+			add("auth.users[%d]: duplicate username %q", i, user.Username)
+		}
+		seen[user.Username] = true
+		if user.Role != "" && !slices.Contains(validRoles, user.Role) {
+			add("auth.users[%d].role %q is not one of %v", i, user.Role, validRoles)
+		}
+		if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+			add("auth.users[%d].passwordHash is not a bcrypt hash: %v", i, err)
+		}
+	}
+
+	for role, fields := range cfg.PII.Redaction {
+		if !slices.Contains(validRoles, role) {
+			add("pii.redaction: unknown role %q", role)
+		}
+		for _, field := range fields {
+			if !slices.Contains(validPIIFields, field) {
+				add("pii.redaction.%s: unknown field %q", role, field)
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Ошибка отсутствия ключа (в Redis - ответ nil на GET)
+var ErrMiss = errors.New("cache: miss")
+
+/*
+Кэш значений по строковому ключу с временем жизни.
+Операции соответствуют командам Redis (GET, SET EX, DEL, SCAN MATCH prefix* + DEL),
+поэтому хранилище можно заменить на Redis без изменения вызывающего кода.
+*/
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+/*
+Функция чтения значения в JSON. Каждый вызов возвращает новую копию,
+поэтому изменение результата (например скрытие полей) не затрагивает кэш.
+*/
+func GetJSON(ctx context.Context, c Cache, key string, value any) error {
+	data, err := c.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+/*
+Функция записи значения в JSON
+*/
+func SetJSON(ctx context.Context, c Cache, key string, value any, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, key, data, ttl)
+}
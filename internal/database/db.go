@@ -3,10 +3,16 @@ package database
 import "errors"
 
 var (
-	ErrPersonNotFound = errors.New("person not found")
-	ErrPersonExists   = errors.New("person exists")
-	ErrInvalidInput   = errors.New("invalid input")
-	ErrEmptyQuery     = errors.New("empty query")
-	ErrQueryTooLong   = errors.New("query too long")
-	ErrEmailExists    = errors.New("email exists")
+	ErrPersonNotFound   = errors.New("person not found")
+	ErrPersonExists     = errors.New("person exists")
+	ErrInvalidInput     = errors.New("invalid input")
+	ErrEmptyQuery       = errors.New("empty query")
+	ErrQueryTooLong     = errors.New("query too long")
+	ErrEmailExists      = errors.New("email exists")
+	ErrQueryTimeout     = errors.New("query timeout")
+	ErrUnavailable      = errors.New("database unavailable")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrUserExists       = errors.New("user exists")
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
 )
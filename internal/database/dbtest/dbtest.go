@@ -0,0 +1,67 @@
+// Пакет тестовой базы данных для тестов хранилища и API
+package dbtest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Номер базы данных SQLite в памяти: у каждого теста своя база
+var sequence atomic.Int64
+
+/*
+Функция подключения к тестовой базе данных с созданием таблиц tables.
+При заданной переменной окружения WST_TEST_DSN используется PostgreSQL
+(например "host=127.0.0.1 user=postgres password=postgres dbname=wst_test sslmode=disable"),
+таблицы очищаются перед тестом. Иначе используется SQLite в памяти процесса:
+блокировки строк (SKIP LOCKED) в SQLite не выполняются, LIKE не различает регистр.
+*/
+func Open(t testing.TB, tables ...any) *gorm.DB {
+	t.Helper()
+	gormConfig := &gorm.Config{Logger: logger.Discard}
+	dsn := os.Getenv("WST_TEST_DSN")
+	var dialector gorm.Dialector
+	if dsn != "" {
+		dialector = postgres.Open(dsn)
+	} else {
+		dialector = sqlite.Open(fmt.Sprintf("file:wst_test_%d?mode=memory&cache=shared", sequence.Add(1)))
+	}
+	db, err := gorm.Open(dialector, gormConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if dsn == "" {
+		//Одно соединение: база в памяти существует, пока открыто хотя бы одно соединение
+		sqlDB.SetMaxOpenConns(1)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	if dsn != "" && len(tables) > 0 {
+		names := make([]string, len(tables))
+		for i, table := range tables {
+			statement := &gorm.Statement{DB: db}
+			if err := statement.Parse(table); err != nil {
+				t.Fatal(err)
+			}
+			names[i] = statement.Schema.Table
+		}
+		if err := db.Exec("TRUNCATE " + strings.Join(names, ", ") + " RESTART IDENTITY CASCADE").Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
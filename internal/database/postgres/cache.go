@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/cache"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/metrics"
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Префиксы ключей кэша
+const (
+	personKeyPrefix = "person:"
+	searchKeyPrefix = "search:"
+)
+
+// Количество записей в кэшируемом результате поиска по умолчанию
+const defaultMaxSearchResults = 1000
+
+/*
+Функция ключа записи по id
+*/
+func personKey(id uint) string {
+	return personKeyPrefix + strconv.FormatUint(uint64(id), 10)
+}
+
+/*
+Функция ключа результата поиска. Строка нормализуется так же, как в searchQuery:
+" 34" и "034" дают один поиск по возрасту, текст сравнивается без пробелов по краям.
+Поиск по тексту без скрытых полей hidden кэшируется отдельно.
+*/
+func searchKey(searchString string, hidden []string) string {
+	searchString = strings.TrimSpace(searchString)
+	if age, err := strconv.Atoi(searchString); err == nil {
+		return searchKeyPrefix + "age:" + strconv.Itoa(age)
+	}
+	if len(hidden) > 0 {
+		hidden = slices.Clone(hidden)
+		slices.Sort(hidden)
+		return searchKeyPrefix + "text-" + strings.Join(hidden, ",") + ":" + searchString
+	}
+	return searchKeyPrefix + "text:" + searchString
+}
+
+/*
+Метод чтения значения из кэша с учетом метрик. Ошибка хранилища кэша не прерывает запрос:
+данные читаются из базы данных.
+*/
+func (s *Storage) cacheGet(ctx context.Context, name string, key string, value any) bool {
+	if s.Cache == nil {
+		return false
+	}
+	err := cache.GetJSON(ctx, s.Cache, key, value)
+	if err == nil {
+		metrics.CacheRequests.WithLabelValues(name, "hit").Inc()
+		return true
+	}
+	metrics.CacheRequests.WithLabelValues(name, "miss").Inc()
+	if !errors.Is(err, cache.ErrMiss) {
+		logging.FromContext(ctx).Warn("cache read failed", zap.String("key", key), zap.Error(err))
+	}
+	return false
+}
+
+/*
+Метод записи значения в кэш. generation - номер поколения до чтения из базы данных:
+если за время чтения запись изменилась, устаревший результат не сохраняется.
+Проверка и запись выполняются под блокировкой: смена поколения в invalidateCache ждет
+начатые записи, поэтому устаревшее значение либо не записывается, либо удаляется после.
+*/
+func (s *Storage) cacheSet(ctx context.Context, generation uint64, key string, value any) {
+	if s.Cache == nil {
+		return
+	}
+	s.cacheLock.RLock()
+	defer s.cacheLock.RUnlock()
+	if s.cacheGeneration.Load() != generation {
+		return
+	}
+	if err := cache.SetJSON(ctx, s.Cache, key, value, config.CacheSetting.TTL); err != nil {
+		logging.FromContext(ctx).Warn("cache write failed", zap.String("key", key), zap.Error(err))
+	}
+}
+
+/*
+Метод сброса кэша после изменения записи: значение записи и все результаты поиска,
+в которые запись могла попасть или из которых могла исчезнуть
+*/
+func (s *Storage) invalidateCache(ctx context.Context, id uint) {
+	s.cacheLock.Lock()
+	s.cacheGeneration.Add(1)
+	s.cacheLock.Unlock()
+	if s.Cache == nil {
+		return
+	}
+	//Сброс выполняется и при отмене запроса: изменение уже зафиксировано
+	ctx = context.WithoutCancel(ctx)
+	if err := s.Cache.Delete(ctx, personKey(id)); err != nil {
+		logging.FromContext(ctx).Error("cache invalidation failed", zap.Uint("person_id", id), zap.Error(err))
+	}
+	if err := s.Cache.DeletePrefix(ctx, searchKeyPrefix); err != nil {
+		logging.FromContext(ctx).Error("cache invalidation failed", zap.String("prefix", searchKeyPrefix), zap.Error(err))
+	}
+}
+
+/*
+Функция ограничения размера кэшируемого результата поиска
+*/
+func maxSearchResults() int {
+	if config.CacheSetting.MaxSearchResults > 0 {
+		return config.CacheSetting.MaxSearchResults
+	}
+	return defaultMaxSearchResults
+}
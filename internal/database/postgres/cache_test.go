@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"WST_lab6_server/internal/cache"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+/*
+Кэш, запись в который останавливается до сигнала release
+*/
+type blockingCache struct {
+	cache.Cache
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	close(c.entered)
+	<-c.release
+	return c.Cache.Set(ctx, key, value, ttl)
+}
+
+func TestCacheSetStaleGeneration(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	storage := &Storage{Cache: cache.NewLRU(10)}
+	ctx := context.Background()
+	generation := storage.cacheGeneration.Load()
+	storage.invalidateCache(ctx, 1)
+	storage.cacheSet(ctx, generation, personKey(1), &models.Person{ID: 1, Name: "old"})
+	if _, err := storage.Cache.Get(ctx, personKey(1)); !errors.Is(err, cache.ErrMiss) {
+		t.Fatalf("value read before the change was cached: %v", err)
+	}
+	storage.cacheSet(ctx, storage.cacheGeneration.Load(), personKey(1), &models.Person{ID: 1, Name: "new"})
+	var person models.Person
+	if !storage.cacheGet(ctx, "person", personKey(1), &person) || person.Name != "new" {
+		t.Fatalf("current value was not cached: %+v", person)
+	}
+}
+
+/*
+Сброс кэша во время записи устаревшего значения: значение не должно остаться в кэше
+*/
+func TestCacheSetRacesInvalidation(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	blocking := &blockingCache{Cache: cache.NewLRU(10), entered: make(chan struct{}), release: make(chan struct{})}
+	storage := &Storage{Cache: blocking}
+	ctx := context.Background()
+	generation := storage.cacheGeneration.Load()
+	setDone := make(chan struct{})
+	go func() {
+		defer close(setDone)
+		storage.cacheSet(ctx, generation, personKey(1), &models.Person{ID: 1, Name: "old"})
+	}()
+	//Проверка поколения пройдена, запись начата
+	<-blocking.entered
+	invalidated := make(chan struct{})
+	go func() {
+		defer close(invalidated)
+		storage.invalidateCache(ctx, 1)
+	}()
+	select {
+	case <-invalidated:
+		t.Fatal("invalidation finished before the concurrent cache write")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(blocking.release)
+	<-setDone
+	<-invalidated
+	if _, err := blocking.Get(ctx, personKey(1)); !errors.Is(err, cache.ErrMiss) {
+		t.Fatalf("stale value survived invalidation: %v", err)
+	}
+}
+
+func TestSearchKeyNormalized(t *testing.T) {
+	for _, pair := range [][2]string{{" 34", "034"}, {"Ivan ", " Ivan"}} {
+		if searchKey(pair[0], nil) != searchKey(pair[1], nil) {
+			t.Errorf("searchKey(%q) != searchKey(%q)", pair[0], pair[1])
+		}
+	}
+	if searchKey("34", nil) == searchKey("Ivan", nil) || searchKey("ivan", nil) == searchKey("Ivan", nil) {
+		t.Error("different searches share a key")
+	}
+	//Поиск без скрытых полей не должен получать результат полного поиска из кэша
+	hidden := []string{"telephone", "email"}
+	if searchKey("mail", nil) == searchKey("mail", hidden) || searchKey("mail", []string{"email"}) == searchKey("mail", hidden) {
+		t.Error("searches with different hidden fields share a key")
+	}
+	if searchKey("mail", hidden) != searchKey("mail", []string{"email", "telephone"}) || searchKey("34", hidden) != searchKey("34", nil) {
+		t.Error("hidden field order or age search changes the key")
+	}
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/logging"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+/*
+Функция подмены настроек подключения на время теста
+*/
+func setDatabaseConfig(t *testing.T, setting config.DatabaseConfig) {
+	t.Helper()
+	saved := config.DatabaseSetting
+	t.Cleanup(func() { config.DatabaseSetting = saved })
+	config.DatabaseSetting = &setting
+}
+
+func TestRedactPassword(t *testing.T) {
+	setDatabaseConfig(t, config.DatabaseConfig{Password: "s3cret"})
+	err := redactPassword(errors.New("failed to connect: password=s3cret host=db, s3cret rejected"))
+	if strings.Contains(err.Error(), "s3cret") || strings.Count(err.Error(), "*****") != 2 {
+		t.Errorf("password not redacted: %v", err)
+	}
+	//Ошибка без пароля возвращается без изменений
+	original := errors.New("connection refused")
+	if redactPassword(original) != original || redactPassword(nil) != nil {
+		t.Error("unrelated error changed")
+	}
+	config.DatabaseSetting.Password = ""
+	if redactPassword(original) != original {
+		t.Error("error changed with empty password")
+	}
+}
+
+func TestConnectGivesUp(t *testing.T) {
+	setDatabaseConfig(t, config.DatabaseConfig{
+		Password: "s3cret",
+		Connect:  config.ConnectRetryConfig{Attempts: 3, InitialDelay: time.Millisecond, MaxDelay: 3 * time.Millisecond},
+	})
+	core, logs := observer.New(zapcore.WarnLevel)
+	logging.Logger = zap.New(core)
+	t.Cleanup(func() { logging.Logger = zap.NewNop() })
+	_, err := connect("host=127.0.0.1 port=1 user=test password=s3cret dbname=test sslmode=disable connect_timeout=5",
+		&gorm.Config{Logger: logger.Discard})
+	if err == nil || !strings.HasPrefix(err.Error(), "3 connection attempts failed") || strings.Contains(err.Error(), "s3cret") {
+		t.Fatalf("connect: %v", err)
+	}
+	//Перед последней попыткой предупреждения нет, пауза удваивается до MaxDelay
+	entries := logs.FilterMessage("database connection failed, retrying").All()
+	if len(entries) != 2 {
+		t.Fatalf("%d retry warnings, want 2", len(entries))
+	}
+	for i, want := range []time.Duration{time.Millisecond, 2 * time.Millisecond} {
+		fields := entries[i].ContextMap()
+		if fields["attempt"] != int64(i+1) || fields["delay"] != want || strings.Contains(fields["error"].(string), "s3cret") {
+			t.Errorf("warning %d: %v", i, fields)
+		}
+	}
+}
+
+func TestConfigurePool(t *testing.T) {
+	setDatabaseConfig(t, config.DatabaseConfig{Pool: config.PoolConfig{MaxOpenConns: 7, MaxIdleConns: 3, ConnMaxLifetime: time.Minute}})
+	db, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=test dbname=test sslmode=disable"), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := configurePool(db); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	defer sqlDB.Close()
+	if stats := sqlDB.Stats(); stats.MaxOpenConnections != 7 {
+		t.Errorf("max open connections %d, want 7", stats.MaxOpenConnections)
+	}
+	//Нулевые значения оставляют настройки database/sql по умолчанию
+	config.DatabaseSetting.Pool = config.PoolConfig{}
+	sqlDB.SetMaxOpenConns(0)
+	if err := configurePool(db); err != nil {
+		t.Fatal(err)
+	}
+	if stats := sqlDB.Stats(); stats.MaxOpenConnections != 0 {
+		t.Errorf("max open connections %d, want unlimited", stats.MaxOpenConnections)
+	}
+}
@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/database"
+	"WST_lab6_server/internal/models"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+func TestTranslateError(t *testing.T) {
+	//Настоящая ошибка тайм-аута pgconn: подключение с истекшим контекстом
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	_, pgTimeout := pgconn.Connect(ctx, "host=127.0.0.1 port=1 user=test dbname=test sslmode=disable")
+	if !pgconn.Timeout(pgTimeout) {
+		t.Fatalf("expected pgconn timeout, got %v", pgTimeout)
+	}
+	other := errors.New("syntax error")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"nil", nil, nil},
+		{"not found", gorm.ErrRecordNotFound, database.ErrPersonNotFound},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), database.ErrQueryTimeout},
+		{"pgconn timeout", pgTimeout, database.ErrQueryTimeout},
+		{"connect error", &pgconn.ConnectError{Config: &pgconn.Config{Host: "db"}}, database.ErrUnavailable},
+		{"bad conn", driver.ErrBadConn, database.ErrUnavailable},
+		{"conn done", sql.ErrConnDone, database.ErrUnavailable},
+		{"other", other, other},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := translateError(test.err)
+			if test.want == nil {
+				if got != nil {
+					t.Fatalf("got %v, want nil", got)
+				}
+				return
+			}
+			if !errors.Is(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			//Исходная ошибка сохраняется для журнала
+			if !errors.Is(got, test.err) && test.want != database.ErrPersonNotFound {
+				t.Errorf("original error lost: %v", got)
+			}
+		})
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	storage := &Storage{DB: dryRunDB(t)}
+	db, cancel := storage.withTimeout(context.Background(), time.Minute)
+	deadline, ok := db.Statement.Context.Deadline()
+	if !ok || time.Until(deadline) > time.Minute || time.Until(deadline) < 50*time.Second {
+		t.Errorf("deadline %v, %v", deadline, ok)
+	}
+	cancel()
+	if db.Statement.Context.Err() == nil {
+		t.Error("context not cancelled")
+	}
+	//Нулевой timeout: без срока, только отмена
+	db, cancel = storage.withTimeout(context.Background(), 0)
+	defer cancel()
+	if _, ok := db.Statement.Context.Deadline(); ok {
+		t.Error("unexpected deadline for zero timeout")
+	}
+}
+
+func TestQueryTimeoutPerOperation(t *testing.T) {
+	storage := openTestStorage(t)
+	saved := config.DatabaseSetting.Timeouts
+	t.Cleanup(func() { config.DatabaseSetting.Timeouts = saved })
+	ctx := context.Background()
+	id, err := storage.AddPerson(ctx, &models.Person{Name: "Ivan", Surname: "Ivanov", Age: 30, Email: "ivan@mail.com", Telephone: "+79990000001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Срок чтения истекает сразу, запись не ограничена
+	config.DatabaseSetting.Timeouts = config.QueryTimeoutConfig{Read: time.Nanosecond}
+	if err := storage.DeletePerson(ctx, &models.Person{ID: id}); err != nil {
+		t.Fatalf("write without timeout: %v", err)
+	}
+	if _, err := storage.GetPerson(ctx, id); !errors.Is(err, database.ErrQueryTimeout) {
+		t.Errorf("read: %v, want query timeout", err)
+	}
+	config.DatabaseSetting.Timeouts.Read = time.Minute
+	if _, err := storage.GetPerson(ctx, id); !errors.Is(err, database.ErrPersonNotFound) {
+		t.Errorf("read with longer timeout: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/models"
+	"context"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/*
+Функция записи события outbox в транзакции изменения (person nil - удаление)
+*/
+func addOutboxEvent(tx *gorm.DB, eventType string, personID uint, person *models.Person) error {
+	event := models.OutboxEvent{
+		Type:          eventType,
+		PersonID:      personID,
+		NextAttemptAt: time.Now(),
+	}
+	if person != nil {
+		payload, err := json.Marshal(person)
+		if err != nil {
+			return err
+		}
+		event.Payload = payload
+	}
+	return tx.Create(&event).Error
+}
+
+/*
+Метод уведомления диспетчера outbox о новом событии
+*/
+func (s *Storage) outboxWritten() {
+	if s.OutboxWritten != nil {
+		s.OutboxWritten()
+	}
+}
+
+/*
+Метод выбора событий outbox для доставки.
+Выбирается только самое раннее недоставленное событие каждой записи, поэтому события
+одной записи доставляются по порядку, в том числе несколькими экземплярами сервера.
+Выбранные события закрепляются на lease; если диспетчер остановится, не записав результат,
+событие будет выбрано снова (доставка "хотя бы один раз").
+*/
+func (s *Storage) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	var outboxEvents []models.OutboxEvent
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("dispatched_at IS NULL AND next_attempt_at <= ?", now).
+			Where(`NOT EXISTS (SELECT 1 FROM outbox_events earlier WHERE earlier.person_id = outbox_events.person_id
+				AND earlier.dispatched_at IS NULL AND earlier.id < outbox_events.id)`).
+			Order("id").Limit(limit).Find(&outboxEvents).Error
+		if err != nil || len(outboxEvents) == 0 {
+			return err
+		}
+		ids := make([]uint64, len(outboxEvents))
+		for i := range outboxEvents {
+			ids[i] = outboxEvents[i].ID
+		}
+		return tx.Model(&models.OutboxEvent{}).Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return outboxEvents, nil
+}
+
+/*
+Метод отметки события outbox доставленным всем получателям
+*/
+func (s *Storage) CompleteOutboxEvent(ctx context.Context, id uint64) error {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	return translateError(db.Model(&models.OutboxEvent{ID: id}).Updates(map[string]any{
+		"dispatched_at": time.Now(),
+		"last_error":    "",
+	}).Error)
+}
+
+/*
+Метод записи неудачной доставки: число попыток, время повтора, ошибка и принявшие событие получатели
+*/
+func (s *Storage) RetryOutboxEvent(ctx context.Context, event *models.OutboxEvent) error {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	return translateError(db.Model(&models.OutboxEvent{ID: event.ID}).
+		Select("Attempts", "NextAttemptAt", "LastError", "CompletedSinks").
+		Updates(event).Error)
+}
+
+/*
+Метод отказа от доставки события после последней попытки.
+Событие отмечается dead и обработанным, поэтому следующие события той же записи больше не ждут его.
+*/
+func (s *Storage) FailOutboxEvent(ctx context.Context, event *models.OutboxEvent) error {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	now := time.Now()
+	event.DispatchedAt = &now
+	event.Dead = true
+	return translateError(db.Model(&models.OutboxEvent{ID: event.ID}).
+		Select("Attempts", "LastError", "CompletedSinks", "DispatchedAt", "Dead").
+		Updates(event).Error)
+}
+
+/*
+Метод удаления обработанных (доставленных и dead) событий старше before
+*/
+func (s *Storage) PurgeOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	result := db.Where("dispatched_at < ?", before).Delete(&models.OutboxEvent{})
+	return result.RowsAffected, translateError(result.Error)
+}
+
+/*
+Метод подсчета недоставленных событий (метрика очереди outbox)
+*/
+func (s *Storage) CountPendingOutboxEvents(ctx context.Context) (int64, error) {
+	var count int64
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Read)
+	defer cancel()
+	err := db.Model(&models.OutboxEvent{}).Where("dispatched_at IS NULL").Count(&count).Error
+	return count, translateError(err)
+}
@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"WST_lab6_server/internal/models"
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+/*
+Функция добавления записи с событием outbox person.created
+*/
+func addTestPerson(t *testing.T, storage *Storage, email string) uint {
+	t.Helper()
+	id, err := storage.AddPerson(context.Background(), &models.Person{Name: "Ivan", Surname: "Ivanov", Age: 30, Email: email, Telephone: "+79990000001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func claimedIDs(outboxEvents []models.OutboxEvent) []uint64 {
+	ids := make([]uint64, len(outboxEvents))
+	for i := range outboxEvents {
+		ids[i] = outboxEvents[i].ID
+	}
+	return ids
+}
+
+func TestClaimOutboxEventsPerPersonOrder(t *testing.T) {
+	storage := openTestStorage(t)
+	ctx := context.Background()
+	first := addTestPerson(t, storage, "ivan@mail.com")
+	if err := storage.UpdatePerson(ctx, &models.Person{ID: first, Name: "Petr"}); err != nil {
+		t.Fatal(err)
+	}
+	addTestPerson(t, storage, "olga@mail.com")
+	//Выбираются первые события записей 1 и 2, изменение записи 1 ждет
+	claimed, err := storage.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if err != nil || !slices.Equal(claimedIDs(claimed), []uint64{1, 3}) {
+		t.Fatalf("claimed %v, %v", claimedIDs(claimed), err)
+	}
+	//Закрепленные события не выбираются повторно до истечения lease
+	if claimed, err := storage.ClaimOutboxEvents(ctx, 10, time.Minute); err != nil || len(claimed) != 0 {
+		t.Fatalf("claimed again %v, %v", claimedIDs(claimed), err)
+	}
+	if err := storage.CompleteOutboxEvent(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err = storage.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if err != nil || !slices.Equal(claimedIDs(claimed), []uint64{2}) || claimed[0].Type != "person.updated" {
+		t.Fatalf("after completing the first event: %+v, %v", claimed, err)
+	}
+	if count, err := storage.CountPendingOutboxEvents(ctx); err != nil || count != 2 {
+		t.Errorf("pending %d, %v", count, err)
+	}
+}
+
+func TestRetryOutboxEventKeepsCompletedSinks(t *testing.T) {
+	storage := openTestStorage(t)
+	ctx := context.Background()
+	id := addTestPerson(t, storage, "ivan@mail.com")
+	if err := storage.UpdatePerson(ctx, &models.Person{ID: id, Name: "Petr"}); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := storage.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("claimed %v, %v", claimedIDs(claimed), err)
+	}
+	event := claimed[0]
+	event.Attempts = 1
+	event.LastError = "webhooks: unavailable"
+	event.CompletedSinks = []string{"events"}
+	event.NextAttemptAt = time.Now().Add(-time.Second)
+	if err := storage.RetryOutboxEvent(ctx, &event); err != nil {
+		t.Fatal(err)
+	}
+	//Повтор возвращает то же событие с принявшими его получателями; следующее событие ждет
+	claimed, err = storage.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != event.ID {
+		t.Fatalf("claimed %v, %v", claimedIDs(claimed), err)
+	}
+	if !slices.Equal(claimed[0].CompletedSinks, []string{"events"}) || claimed[0].Attempts != 1 || claimed[0].LastError != event.LastError {
+		t.Fatalf("retried event %+v", claimed[0])
+	}
+	//Событие dead не задерживает следующее событие записи
+	if err := storage.FailOutboxEvent(ctx, &claimed[0]); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err = storage.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != event.ID+1 {
+		t.Fatalf("after dead event: %v, %v", claimedIDs(claimed), err)
+	}
+	var dead models.OutboxEvent
+	if err := storage.DB.First(&dead, event.ID).Error; err != nil || !dead.Dead || dead.DispatchedAt == nil {
+		t.Fatalf("dead event %+v, %v", dead, err)
+	}
+}
@@ -2,18 +2,32 @@ package postgres
 
 import (
 	"WST_lab6_server/config"
+	"WST_lab6_server/internal/cache"
 	"WST_lab6_server/internal/database"
+	"WST_lab6_server/internal/events"
 	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/metrics"
+	"WST_lab6_server/internal/tracing"
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"WST_lab6_server/internal/models"
 	"fmt"
 	"log"
 
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -21,16 +35,70 @@ import (
 
  */
 
+const (
+	// Размер порции при потоковом чтении по умолчанию
+	defaultStreamBatchSize = 500
+	// Пауза перед повторным подключением по умолчанию
+	defaultConnectDelay = time.Second
+)
+
+// Признак успешного применения миграций
+var migrated atomic.Bool
+
 type Storage struct {
 	DB *gorm.DB
+	//Лента изменений: события создания, изменения и удаления записей (nil - отключена).
+	//События публикуются диспетчером outbox после фиксации транзакции.
+	Events *events.Broker
+	//Вызывается после фиксации транзакции с событием outbox, чтобы диспетчер не ждал следующей проверки
+	OutboxWritten func()
+	//Кэш записей по id и результатов поиска (nil - отключен)
+	Cache cache.Cache
+	//Поколение данных: увеличивается при каждом изменении, чтобы не кэшировать устаревшее чтение
+	cacheGeneration atomic.Uint64
+	//Запись в кэш (чтение) и смена поколения (запись) исключают друг друга
+	cacheLock sync.RWMutex
 }
 
 /*
-Инициализация
+Инициализация: подключение, миграция и, при database.seedOnStart, заполнение таблицы из конфигурации
 */
 func Init() *gorm.DB {
-	logging.InitializeLogger()
-	var err error
+	db, err := Open()
+	if err != nil {
+		log.Fatalf("error connecting to database: %v", err)
+	}
+	//Миграция базы данных
+	if err := Migrate(db); err != nil {
+		log.Fatalf("error creating table: %v", err)
+	}
+	if config.DatabaseSetting.SeedOnStart {
+		//Очищаем таблицу и заполняем ее из фаила конфигурации
+		if _, err := Seed(db, true); err != nil {
+			log.Fatalf("error creating table: %v", err)
+		}
+	}
+	//Сводка по таблице одним запросом, без чтения записей
+	var content struct {
+		Quantity int64
+		IDMin    uint
+		IDMax    uint
+	}
+	if err := db.Model(&models.Person{}).Select("count(*) AS quantity, coalesce(min(id), 0) AS id_min, coalesce(max(id), 0) AS id_max").Scan(&content).Error; err != nil {
+		log.Fatalf("query failed: %v", err)
+	}
+	logging.Logger.Info("database content",
+		zap.Int64("quantity", content.Quantity),
+		zap.Uint("id_max", content.IDMax),
+		zap.Uint("id_min", content.IDMin))
+	//Возвращаем указатель на базу данных
+	return db
+}
+
+/*
+Функция подключения к базе данных с метриками и трассировкой запросов
+*/
+func Open() (*gorm.DB, error) {
 	//Уровень логирования из файла конфигурации
 	var logLevel logger.LogLevel
 	switch config.GeneralServerSetting.LogLevel {
@@ -53,105 +121,423 @@ func Init() *gorm.DB {
 		config.DatabaseSetting.Name,
 		config.DatabaseSetting.Port,
 		config.DatabaseSetting.SSLMode)
-	//Подключаемся к базе данных
-	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logLevel),
+	//Подключаемся к базе данных с повторными попытками
+	conn, err := connect(dsn, &gorm.Config{
+		Logger: logging.NewGormLogger(logLevel, config.LoggingSetting.SlowQueryThreshold),
 	})
 	if err != nil {
-		log.Fatalf("error connecting to database: %v", err)
+		return nil, err
 	}
 	//Выводим при удачном подключении
 	logging.Logger.Info("Database connection established successfully.")
-	//Миграция базы данных
-	db := conn
-	err = db.AutoMigrate(&models.Person{})
-	if err != nil {
-		log.Fatalf("error creating table: %v", err)
+	//Метрики времени выполнения запросов и пула соединений
+	if err := conn.Use(metrics.GormPlugin{}); err != nil {
+		return nil, fmt.Errorf("error registering metrics plugin: %w", err)
+	}
+	//Спаны трассировки для каждого SQL запроса
+	if err := conn.Use(tracing.GormPlugin{}); err != nil {
+		return nil, fmt.Errorf("error registering tracing plugin: %w", err)
+	}
+	if sqlDB, err := conn.DB(); err == nil {
+		metrics.RegisterDBStats(sqlDB, config.DatabaseSetting.Name)
+	}
+	return conn, nil
+}
+
+// Модели таблиц базы данных (миграция и проверка командой db check)
+var Tables = []any{
+	&models.Person{},
+	&models.User{},
+	&models.OutboxEvent{},
+	&models.TableVersion{},
+	&models.Webhook{},
+	&models.WebhookDelivery{},
+	&models.WebhookAttempt{},
+}
+
+/*
+Функция миграции схемы базы данных
+*/
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(Tables...); err != nil {
+		return err
 	}
+	migrated.Store(true)
 	logging.Logger.Info("Migration completed successfully.")
-	//Удаляем таблицу
-	db.Exec("DELETE FROM people")
-	//Заполняем таблицу из фаила конфигурации
-	result := db.Create(&config.GeneralServerSetting.DataSet)
-	if result.Error != nil {
-		log.Fatalf("error creating table: %v", result.Error)
-	}
-	//Выводим при удачном заполнениитаблицы
-	logging.Logger.Info("Database updated successfully.")
-	/*
-		//Debug: Запрос к базе и вывод всех данных
-	*/
-	var results []models.Person
-	if err := db.Find(&results).Error; err != nil {
-		log.Fatalf("query failed: %v", err)
+	return nil
+}
+
+/*
+Функция заполнения таблицы записями из файла конфигурации (generalServer.persons).
+При reset таблица предварительно очищается, иначе записи с уже существующим email пропускаются.
+Возвращает количество добавленных записей.
+*/
+func Seed(db *gorm.DB, reset bool) (int64, error) {
+	dataSet := make([]models.Person, len(config.GeneralServerSetting.DataSet))
+	copy(dataSet, config.GeneralServerSetting.DataSet)
+	if len(dataSet) == 0 && !reset {
+		return 0, nil
+	}
+	var created int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if reset {
+			//Удаляем все записи
+			if err := tx.Exec("DELETE FROM people").Error; err != nil {
+				return err
+			}
+		}
+		if len(dataSet) > 0 {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&dataSet)
+			if result.Error != nil {
+				return result.Error
+			}
+			created = result.RowsAffected
+		}
+		//Списки, полученные клиентами до заполнения, становятся устаревшими (ETag)
+		if reset || created > 0 {
+			return bumpVersion(tx, personsTable)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
-	for _, record := range results {
-		fmt.Println(record)
+	//Выводим при удачном заполнении таблицы
+	logging.Logger.Info("Database updated successfully.", zap.Int64("created", created), zap.Bool("reset", reset))
+	return created, nil
+}
 
+/*
+Функция подключения к базе данных.
+При неудаче попытка повторяется с экспоненциально растущей паузой (DatabaseSetting.Connect),
+после успешного подключения применяются настройки пула соединений (DatabaseSetting.Pool).
+*/
+func connect(dsn string, gormConfig *gorm.Config) (*gorm.DB, error) {
+	retry := config.DatabaseSetting.Connect
+	attempts := max(retry.Attempts, 1)
+	delay := retry.InitialDelay
+	if delay <= 0 {
+		delay = defaultConnectDelay
 	}
-	fmt.Println("database content in quantity:", len(results), "\n id max:", results[len(results)-1].ID, "id min:", results[0].ID)
-	/*
-		----
-	*/
-	//Возвращаем указатель на базу данных
-	return db
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var db *gorm.DB
+		db, err = gorm.Open(postgres.Open(dsn), gormConfig)
+		if err == nil {
+			err = configurePool(db)
+		}
+		if err == nil {
+			return db, nil
+		}
+		if attempt == attempts {
+			break
+		}
+		logging.Logger.Warn("database connection failed, retrying",
+			zap.Int("attempt", attempt),
+			zap.Int("attempts", attempts),
+			zap.Duration("delay", delay),
+			zap.Error(redactPassword(err)))
+		time.Sleep(delay)
+		//Увеличиваем паузу перед следующей попыткой
+		delay *= 2
+		if retry.MaxDelay > 0 && delay > retry.MaxDelay {
+			delay = retry.MaxDelay
+		}
+	}
+	return nil, fmt.Errorf("%d connection attempts failed: %w", attempts, redactPassword(err))
+}
+
+/*
+Функция удаления пароля подключения из текста ошибки, чтобы он не попал в журнал
+*/
+func redactPassword(err error) error {
+	password := config.DatabaseSetting.Password
+	if err == nil || password == "" || !strings.Contains(err.Error(), password) {
+		return err
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), password, "*****"))
+}
+
+/*
+Функция применения настроек пула соединений
+*/
+func configurePool(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	pool := config.DatabaseSetting.Pool
+	if pool.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(pool.MaxOpenConns)
+	}
+	if pool.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+	if pool.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+	if pool.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	}
+	return nil
+}
+
+/*
+Метод проверки базы данных для отчета о состоянии: доступность и статистика пула соединений
+*/
+func (s *Storage) HealthCheck(ctx context.Context) (any, error) {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return nil, err
+	}
+	err = sqlDB.PingContext(ctx)
+	stats := sqlDB.Stats()
+	return models.PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       stats.WaitDuration.String(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}, translateError(err)
+}
+
+/*
+Метод проверки применения миграций для отчета о состоянии
+*/
+func (s *Storage) MigrationsCheck(ctx context.Context) (any, error) {
+	if !migrated.Load() {
+		return nil, errors.New("migrations not applied")
+	}
+	return nil, nil
+}
+
+/*
+Метод подготовки запроса с контекстом и ограничением времени выполнения.
+Нулевой timeout означает ограничение только контекстом запроса.
+*/
+func (s *Storage) withTimeout(ctx context.Context, timeout time.Duration) (*gorm.DB, context.CancelFunc) {
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		return s.DB.WithContext(ctx), cancel
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return s.DB.WithContext(ctx), cancel
+}
+
+/*
+Функция преобразования ошибок драйвера в ошибки пакета database
+*/
+func translateError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return database.ErrPersonNotFound
+	case errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err):
+		//Запрос не уложился в отведенное время
+		return fmt.Errorf("%w: %w", database.ErrQueryTimeout, err)
+	}
+	//База данных недоступна (нет соединения или оно разорвано)
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("%w: %w", database.ErrUnavailable, err)
+	}
+	return err
 }
 
 /*
 //
-Метод поиска в базе данных по запросу
+Метод поиска в базе данных по запросу с постраничной выдачей.
+Возвращает не больше limit записей с id больше afterID по возрастанию id;
+пустая строка поиска означает все записи. Поля hidden (скрытые от роли пользователя,
+pii.HiddenFields) в поиске не участвуют. Страницы результатов поиска сохраняются в кэше.
 //
 */
-func (s *Storage) SearchPerson(searchString string) ([]models.Person, error) {
+func (s *Storage) SearchPerson(ctx context.Context, searchString string, hidden []string, afterID uint, limit int) ([]models.Person, error) {
 	var persons []models.Person
-	query := s.DB.Model(&models.Person{})
+	key := fmt.Sprintf("%s|after:%d|limit:%d", searchKey(searchString, hidden), afterID, limit)
+	if searchString != "" && s.cacheGet(ctx, "search", key, &persons) {
+		return persons, nil
+	}
+	generation := s.cacheGeneration.Load()
+	timeout := config.DatabaseSetting.Timeouts.Read
+	if searchString != "" {
+		timeout = config.DatabaseSetting.Timeouts.Search
+	}
+	db, cancel := s.withTimeout(ctx, timeout)
+	defer cancel()
+	query := db.Model(&models.Person{})
+	if searchString != "" {
+		query = searchQuery(db, searchString, hidden)
+	}
+	//Выполняем запрос и сохраняем результат в структуру
+	if err := query.Where("id > ?", afterID).Order("id").Limit(limit).Find(&persons).Error; err != nil {
+		return nil, translateError(err)
+	}
+	if searchString != "" {
+		s.cacheSet(ctx, generation, key, persons)
+	}
+	//Возвращаем результат
+	return persons, nil
+}
+
+// Строковые поля поиска
+var searchColumns = []string{"name", "surname", "email", "telephone"}
+
+/*
+Функция построения запроса поиска по строке без полей hidden
+*/
+func searchQuery(db *gorm.DB, searchString string, hidden []string) *gorm.DB {
+	query := db.Model(&models.Person{})
 	//Удаляем пробелы из строки поиска
 	searchString = strings.TrimSpace(searchString)
 	// Проверяем строка является числом, если число ищем по возрасту
 	if age, err := strconv.Atoi(searchString); err == nil {
-		query = query.Where("age = ?", age)
-	} else {
-		//Если строка не может быть конвертирована в число ищем по строковым полям
-		query = query.Where("name LIKE ? OR surname LIKE ? OR email LIKE ? OR telephone LIKE ?",
-			"%"+searchString+"%", "%"+searchString+"%", "%"+searchString+"%", "%"+searchString+"%")
+		return query.Where("age = ?", age)
 	}
-	//Выполняем запрос и сохраняем результат в структуру
-	if err := query.Find(&persons).Error; err != nil {
-		return nil, err
+	//Если строка не может быть конвертирована в число ищем по строковым полям
+	var conditions []string
+	var args []any
+	for _, column := range searchColumns {
+		if !slices.Contains(hidden, column) {
+			conditions = append(conditions, column+" LIKE ?")
+			args = append(args, "%"+searchString+"%")
+		}
 	}
-	//Возвращаем результат
-	return persons, nil
+	return query.Where(strings.Join(conditions, " OR "), args...)
+}
+
+/*
+Метод потокового обхода записей без загрузки всей выборки в память.
+Записи читаются порциями по DatabaseSetting.StreamBatchSize и по одной передаются в обработчик,
+обход прекращается при отмене контекста (например при отключении клиента).
+Пустая строка поиска означает обход всей таблицы, поля hidden в поиске не участвуют.
+Результаты поиска (не больше cache.maxSearchResults записей) сохраняются в кэше.
+*/
+func (s *Storage) EachPerson(ctx context.Context, searchString string, hidden []string, fn func(*models.Person) error) error {
+	if searchString != "" && s.Cache != nil {
+		return s.eachCachedPerson(ctx, searchString, hidden, fn)
+	}
+	return s.eachPerson(ctx, searchString, hidden, fn)
+}
+
+/*
+Метод обхода результата поиска через кэш: при промахе записи собираются во время чтения из базы данных
+*/
+func (s *Storage) eachCachedPerson(ctx context.Context, searchString string, hidden []string, fn func(*models.Person) error) error {
+	key := searchKey(searchString, hidden)
+	var persons []models.Person
+	if s.cacheGet(ctx, "search", key, &persons) {
+		for i := range persons {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(&persons[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	generation := s.cacheGeneration.Load()
+	limit := maxSearchResults()
+	collected := []models.Person{}
+	err := s.eachPerson(ctx, searchString, hidden, func(person *models.Person) error {
+		if collected != nil {
+			if len(collected) < limit {
+				//Копия до вызова обработчика: обработчик может скрыть поля записи
+				collected = append(collected, *person)
+			} else {
+				collected = nil
+			}
+		}
+		return fn(person)
+	})
+	if err == nil && collected != nil {
+		s.cacheSet(ctx, generation, key, collected)
+	}
+	return err
+}
+
+func (s *Storage) eachPerson(ctx context.Context, searchString string, hidden []string, fn func(*models.Person) error) error {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Stream)
+	defer cancel()
+	query := db.Model(&models.Person{})
+	if searchString != "" {
+		query = searchQuery(db, searchString, hidden)
+	}
+	batchSize := config.DatabaseSetting.StreamBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultStreamBatchSize
+	}
+	var batch []models.Person
+	//Читаем порции по первичному ключу, в памяти находится не больше одной порции
+	result := query.FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			//Проверяем что клиент еще ожидает данные
+			if err := tx.Statement.Context.Err(); err != nil {
+				return err
+			}
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return translateError(result.Error)
 }
 
 /*
 Метод добавления новых данных
 */
-func (s *Storage) AddPerson(person *models.Person) (uint, error) {
+func (s *Storage) AddPerson(ctx context.Context, person *models.Person) (uint, error) {
 	//Проверяем наличие записи с таким же email
-	if _, err := s.CheckPersonByEmail(person.Email, 0); err == nil {
+	if _, err := s.CheckPersonByEmail(ctx, person.Email, 0); err == nil {
 		return 0, database.ErrEmailExists
-	}
-	//Создаем запись в базе данных
-	if err := s.DB.Create(person).Error; err != nil {
+	} else if !errors.Is(err, database.ErrPersonNotFound) {
 		return 0, err
 	}
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	//Создаем запись и событие outbox в одной транзакции
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(person).Error; err != nil {
+			return err
+		}
+		if err := bumpVersion(tx, personsTable); err != nil {
+			return err
+		}
+		return addOutboxEvent(tx, events.TypeCreated, person.ID, person)
+	})
+	if err != nil {
+		return 0, translateError(err)
+	}
+	s.invalidateCache(ctx, person.ID)
+	s.outboxWritten()
 	return person.ID, nil
 }
 
 /*
 Метод получения данных
 */
-func (s *Storage) GetPerson(id uint) (*models.Person, error) {
+func (s *Storage) GetPerson(ctx context.Context, id uint) (*models.Person, error) {
 	var person models.Person
+	if s.cacheGet(ctx, "person", personKey(id), &person) {
+		return &person, nil
+	}
+	generation := s.cacheGeneration.Load()
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Read)
+	defer cancel()
 	//Выполняем запрос к базе данных для получения записи по id
-	err := s.DB.First(&person, id).Error
+	err := db.First(&person, id).Error
 	if err != nil {
 		//Возвращаем ошибку при выполнении запроса к базе данных
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, database.ErrPersonNotFound
-		}
-		return nil, err
+		return nil, translateError(err)
 	}
+	s.cacheSet(ctx, generation, personKey(id), &person)
 	//Возвращаем результат
 	return &person, nil
 }
@@ -159,25 +545,41 @@ func (s *Storage) GetPerson(id uint) (*models.Person, error) {
 /*
 Метод обновления данных по id
 */
-func (s *Storage) UpdatePerson(person *models.Person) error {
-	//Выполняем запрос к базе данных для обновления записи
-	result := s.DB.Model(&models.Person{}).Where("id = ?", person.ID).Updates(models.Person{
-		Name:      person.Name,
-		Surname:   person.Surname,
-		Age:       person.Age,
-		Email:     person.Email,
-		Telephone: person.Telephone,
+func (s *Storage) UpdatePerson(ctx context.Context, person *models.Person) error {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		//Выполняем запрос к базе данных для обновления записи
+		result := tx.Model(&models.Person{}).Where("id = ?", person.ID).Updates(models.Person{
+			Name:      person.Name,
+			Surname:   person.Surname,
+			Age:       person.Age,
+			Email:     person.Email,
+			Telephone: person.Telephone,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			//Возвращаем ошибку если запись не найдена для обновления
+			return database.ErrPersonNotFound
+		}
+		//В событие попадает запись целиком: в запросе могли быть не все поля
+		var updated models.Person
+		if err := tx.First(&updated, person.ID).Error; err != nil {
+			return err
+		}
+		if err := bumpVersion(tx, personsTable); err != nil {
+			return err
+		}
+		return addOutboxEvent(tx, events.TypeUpdated, person.ID, &updated)
 	})
-
-	if result.Error != nil {
+	if err != nil {
 		//Возвращаем ошибку при выполнении запроса к базе данных
-		return result.Error
-	}
-
-	if result.RowsAffected == 0 {
-		//Возвращаем ошибку если запись не найдена для обновления
-		return database.ErrPersonNotFound
+		return translateError(err)
 	}
+	s.invalidateCache(ctx, person.ID)
+	s.outboxWritten()
 	//Возвращаем ничего при успехе
 	return nil
 }
@@ -185,44 +587,94 @@ func (s *Storage) UpdatePerson(person *models.Person) error {
 /*
 Метод удаления данных по id
 */
-func (s *Storage) DeletePerson(person *models.Person) error {
-	//Выполняем запрос к базе данных для удаления записи по id
-	result := s.DB.Delete(&person)
-	if result.Error != nil {
+func (s *Storage) DeletePerson(ctx context.Context, person *models.Person) error {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	deleted := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		//Выполняем запрос к базе данных для удаления записи по id
+		result := tx.Delete(&person)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = true
+		if err := bumpVersion(tx, personsTable); err != nil {
+			return err
+		}
+		return addOutboxEvent(tx, events.TypeDeleted, person.ID, nil)
+	})
+	if err != nil {
 		//Возвращаем ошибку при выполнении запроса к базе данных
-		return result.Error
+		return translateError(err)
 	}
-	//Возвращаем ошибку при выполнении запроса к базе данных
-	return result.Error
+	if deleted {
+		s.invalidateCache(ctx, person.ID)
+		s.outboxWritten()
+	}
+	return nil
 }
 
 /*
-Метод получения всех данных
+Метод получения страницы записей по условиям выборки.
+Возвращает записи по возрастанию id и общее количество подходящих записей.
 */
-func (s *Storage) GetAllPersons() ([]models.Person, error) {
+func (s *Storage) ListPersons(ctx context.Context, filter models.PersonFilter, offset int, limit int) ([]models.Person, int64, error) {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Read)
+	defer cancel()
+	query := db.Model(&models.Person{})
+	//Порядок условий постоянный, чтобы текст запроса не менялся
+	conditions := []struct{ column, value string }{
+		{"name", filter.Name},
+		{"surname", filter.Surname},
+		{"email", filter.Email},
+		{"telephone", filter.Telephone},
+	}
+	for _, condition := range conditions {
+		if condition.value != "" {
+			query = query.Where(condition.column+" LIKE ?", "%"+condition.value+"%")
+		}
+	}
+	if filter.AgeMin != nil {
+		query = query.Where("age >= ?", *filter.AgeMin)
+	}
+	if filter.AgeMax != nil {
+		query = query.Where("age <= ?", *filter.AgeMax)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, translateError(err)
+	}
 	var persons []models.Person
-	//Выполняем запрос к базе данных для получения всех записей
-	err := s.DB.Find(&persons).Error
-	if err != nil {
-		return nil, err
+	if err := query.Order("id").Offset(offset).Limit(limit).Find(&persons).Error; err != nil {
+		return nil, 0, translateError(err)
 	}
-	//Возвращаем результат
-	return persons, nil
+	return persons, total, nil
+}
+
+/*
+Метод получения количества записей
+*/
+func (s *Storage) CountPersons(ctx context.Context) (int64, error) {
+	var count int64
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Read)
+	defer cancel()
+	if err := db.Model(&models.Person{}).Count(&count).Error; err != nil {
+		return 0, translateError(err)
+	}
+	return count, nil
 }
 
 /*
 Метод проверки наличия записи по email
 */
-func (s *Storage) CheckPersonByEmail(email string, excludeId uint) (*models.Person, error) {
+func (s *Storage) CheckPersonByEmail(ctx context.Context, email string, excludeId uint) (*models.Person, error) {
 	var person models.Person
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Read)
+	defer cancel()
 	// Выполняем запрос к базе данных для поиска по email
-	if err := s.DB.Where("email = ? AND id != ?", email, excludeId).First(&person).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			//Возвращаем кастомную ошибку (Запись не найдена)
-			return nil, database.ErrPersonNotFound
-		}
-		//Возвращаем ошибку
-		return nil, err
+	if err := db.Where("email = ? AND id != ?", email, excludeId).First(&person).Error; err != nil {
+		//Возвращаем кастомную ошибку (Запись не найдена) или ошибку запроса
+		return nil, translateError(err)
 	}
 	//Возвращаем запись
 	return &person, nil
@@ -231,19 +683,22 @@ func (s *Storage) CheckPersonByEmail(email string, excludeId uint) (*models.Pers
 /*
 Метод проверки наличия записи по id
 */
-func (s *Storage) CheckPersonByIDHandler(id uint) (bool, error) {
+func (s *Storage) CheckPersonByIDHandler(ctx context.Context, id uint) (bool, error) {
 	var person models.Person
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Read)
+	defer cancel()
 	//Выполняем запрос к базе данных для поиска по id
-	result := s.DB.First(&person, id)
+	result := db.First(&person, id)
 	if result.Error != nil {
 		//Проверяем наличие записи по id
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			fmt.Println("Record not found")
+			logging.FromContext(ctx).Debug("record not found", zap.Uint("id", id))
 		} else {
-			fmt.Println("Error when executing the request:", result.Error)
+			logging.FromContext(ctx).Error("error when executing the request", zap.Uint("id", id), zap.Error(result.Error))
+			return false, translateError(result.Error)
 		}
 	} else {
-		fmt.Println("The record was found with CheckPersonByIDHandler:", person)
+		logging.FromContext(ctx).Debug("record found", zap.Uint("id", person.ID))
 		return true, nil
 	}
 	//Возвращаем false при успехе
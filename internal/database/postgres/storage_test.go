@@ -0,0 +1,204 @@
+package postgres
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/cache"
+	"WST_lab6_server/internal/database/dbtest"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+/*
+Функция создания подключения без базы данных: запросы только строятся (DryRun)
+*/
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=test dbname=test sslmode=disable"), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+/*
+Функция подключения к тестовой базе данных (dbtest: PostgreSQL из WST_TEST_DSN или SQLite в памяти)
+*/
+func openTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	logging.Logger = zap.NewNop()
+	return &Storage{DB: dbtest.Open(t, Tables...), Cache: cache.NewLRU(100)}
+}
+
+func TestCacheInvalidatedOnUpdate(t *testing.T) {
+	storage := openTestStorage(t)
+	ctx := context.Background()
+	id, err := storage.AddPerson(ctx, &models.Person{Name: "Ivan", Surname: "Ivanov", Age: 30, Email: "ivan@mail.com", Telephone: "+79990000001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Первое чтение кэширует запись
+	if _, err := storage.GetPerson(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.UpdatePerson(ctx, &models.Person{ID: id, Name: "Petr"}); err != nil {
+		t.Fatal(err)
+	}
+	person, err := storage.GetPerson(ctx, id)
+	if err != nil || person.Name != "Petr" || person.Surname != "Ivanov" {
+		t.Fatalf("stale person after update: %+v, %v", person, err)
+	}
+}
+
+func TestCacheInvalidatedOnAddAndDelete(t *testing.T) {
+	storage := openTestStorage(t)
+	ctx := context.Background()
+	if _, err := storage.AddPerson(ctx, &models.Person{Name: "Ivan", Surname: "Ivanov", Age: 30, Email: "ivan@mail.com", Telephone: "+79990000001"}); err != nil {
+		t.Fatal(err)
+	}
+	//Результат поиска кэшируется и должен сбрасываться при добавлении записи
+	if found, err := storage.SearchPerson(ctx, "Ivanov", nil, 0, 100); err != nil || len(found) != 1 {
+		t.Fatalf("search: %d persons, %v", len(found), err)
+	}
+	id, err := storage.AddPerson(ctx, &models.Person{Name: "Olga", Surname: "Ivanova", Age: 25, Email: "olga@mail.com", Telephone: "+79990000002"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, err := storage.SearchPerson(ctx, "Ivanov", nil, 0, 100); err != nil || len(found) != 2 {
+		t.Fatalf("search after add: %d persons, %v", len(found), err)
+	}
+	//Запись по id и результат поиска сбрасываются при удалении
+	if _, err := storage.GetPerson(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.DeletePerson(ctx, &models.Person{ID: id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.GetPerson(ctx, id); err == nil {
+		t.Error("deleted person is still returned")
+	}
+	if found, err := storage.SearchPerson(ctx, "Ivanov", nil, 0, 100); err != nil || len(found) != 1 {
+		t.Fatalf("search after delete: %d persons, %v", len(found), err)
+	}
+}
+
+func TestSearchQueryHidden(t *testing.T) {
+	db := dryRunDB(t)
+	tests := []struct {
+		search   string
+		hidden   []string
+		included []string
+		excluded []string
+	}{
+		{"mail", nil, []string{"name LIKE", "surname LIKE", "email LIKE", "telephone LIKE"}, nil},
+		{"mail", []string{"email", "telephone"}, []string{"name LIKE", "surname LIKE"}, []string{"email", "telephone"}},
+		{"+7 999", []string{"telephone"}, []string{"email LIKE"}, []string{"telephone"}},
+		{" 34 ", []string{"email"}, []string{"age ="}, []string{"LIKE"}},
+	}
+	for _, test := range tests {
+		var persons []models.Person
+		statement := searchQuery(db, test.search, test.hidden).Find(&persons).Statement
+		sql := statement.SQL.String()
+		for _, part := range test.included {
+			if !strings.Contains(sql, part) {
+				t.Errorf("%q without %v: %q has no %q", test.search, test.hidden, sql, part)
+			}
+		}
+		for _, part := range test.excluded {
+			if strings.Contains(sql, part) {
+				t.Errorf("%q without %v: %q contains %q", test.search, test.hidden, sql, part)
+			}
+		}
+	}
+}
+
+func TestSearchPersonPages(t *testing.T) {
+	storage := openTestStorage(t)
+	ctx := context.Background()
+	for i, name := range []string{"Ivan", "Olga", "Petr", "Irina", "Oleg"} {
+		person := models.Person{Name: name, Surname: "Test", Age: 20 + i, Email: strings.ToLower(name) + "@mail.com", Telephone: "+7999000000" + string(rune('1'+i))}
+		if _, err := storage.AddPerson(ctx, &person); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := func(persons []models.Person) []uint {
+		result := make([]uint, len(persons))
+		for i := range persons {
+			result[i] = persons[i].ID
+		}
+		return result
+	}
+	//Все записи страницами по две по возрастанию id
+	var pages [][]uint
+	for after := uint(0); ; {
+		page, err := storage.SearchPerson(ctx, "", nil, after, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		pages = append(pages, ids(page))
+		after = page[len(page)-1].ID
+	}
+	if fmt.Sprint(pages) != "[[1 2] [3 4] [5]]" {
+		t.Fatalf("pages %v", pages)
+	}
+	//Поиск: первая страница и страница после id 2 кэшируются отдельно
+	if found, err := storage.SearchPerson(ctx, "Ol", nil, 0, 10); err != nil || fmt.Sprint(ids(found)) != "[2 5]" {
+		t.Fatalf("search: %v, %v", ids(found), err)
+	}
+	if found, err := storage.SearchPerson(ctx, "Ol", nil, 2, 10); err != nil || fmt.Sprint(ids(found)) != "[5]" {
+		t.Fatalf("search after 2: %v, %v", ids(found), err)
+	}
+	//Поиск по скрытому полю ничего не находит
+	if found, err := storage.SearchPerson(ctx, "@mail", []string{"email", "telephone"}, 0, 10); err != nil || len(found) != 0 {
+		t.Fatalf("search by hidden email: %v, %v", ids(found), err)
+	}
+}
+
+func TestEachPersonBatches(t *testing.T) {
+	storage := openTestStorage(t)
+	saved := config.DatabaseSetting.StreamBatchSize
+	t.Cleanup(func() { config.DatabaseSetting.StreamBatchSize = saved })
+	config.DatabaseSetting.StreamBatchSize = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := range 5 {
+		if _, err := storage.AddPerson(ctx, &models.Person{Name: "Ivan", Surname: "Test", Age: 30, Email: fmt.Sprintf("ivan%d@mail.com", i), Telephone: "+79990000001"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var seen []uint
+	if err := storage.EachPerson(ctx, "", nil, func(person *models.Person) error {
+		seen = append(seen, person.ID)
+		return nil
+	}); err != nil || fmt.Sprint(seen) != "[1 2 3 4 5]" {
+		t.Fatalf("EachPerson: %v, %v", seen, err)
+	}
+	//Отмена контекста прерывает обход
+	seen = nil
+	err := storage.EachPerson(ctx, "", nil, func(person *models.Person) error {
+		seen = append(seen, person.ID)
+		if len(seen) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || len(seen) != 3 {
+		t.Fatalf("canceled EachPerson: %v after %v", err, seen)
+	}
+}
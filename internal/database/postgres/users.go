@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/database"
+	"WST_lab6_server/internal/models"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// Код ошибки PostgreSQL при нарушении уникальности
+const uniqueViolation = "23505"
+
+/*
+Метод получения пользователя по имени
+*/
+func (s *Storage) GetUser(ctx context.Context, username string) (*models.User, error) {
+	var user models.User
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Read)
+	defer cancel()
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, database.ErrUserNotFound
+		}
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+/*
+Метод добавления пользователя
+*/
+func (s *Storage) AddUser(ctx context.Context, user *models.User) error {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	if err := db.Create(user).Error; err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return database.ErrUserExists
+		}
+		return translateError(err)
+	}
+	return nil
+}
+
+/*
+Метод замены хеша пароля пользователя
+*/
+func (s *Storage) SetUserPassword(ctx context.Context, username string, passwordHash string) error {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	result := db.Model(&models.User{}).Where("username = ?", username).Update("password_hash", passwordHash)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return database.ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/models"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Имя маркера изменений таблицы people
+const personsTable = "people"
+
+/*
+Функция увеличения версии таблицы в транзакции изменения
+*/
+func bumpVersion(tx *gorm.DB, table string) error {
+	now := time.Now().UTC()
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "name"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"version":    gorm.Expr("table_versions.version + 1"),
+			"updated_at": now,
+		}),
+	}).Create(&models.TableVersion{Name: table, Version: 1, UpdatedAt: now}).Error
+}
+
+/*
+Метод получения маркера изменений таблицы people.
+Если таблица еще не изменялась, возвращается версия 0 с нулевым временем.
+*/
+func (s *Storage) PersonsVersion(ctx context.Context) (uint64, time.Time, error) {
+	var version models.TableVersion
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Read)
+	defer cancel()
+	err := db.Where("name = ?", personsTable).Take(&version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, time.Time{}, nil
+	}
+	if err != nil {
+		return 0, time.Time{}, translateError(err)
+	}
+	return version.Version, version.UpdatedAt, nil
+}
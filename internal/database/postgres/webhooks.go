@@ -0,0 +1,224 @@
+package postgres
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/database"
+	"WST_lab6_server/internal/models"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/*
+Метод получения всех подписок webhook
+*/
+func (s *Storage) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Read)
+	defer cancel()
+	if err := db.Order("id").Find(&webhooks).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return webhooks, nil
+}
+
+/*
+Метод получения активных подписок для постановки событий в очередь
+*/
+func (s *Storage) ActiveWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Read)
+	defer cancel()
+	if err := db.Where("active = ?", true).Order("id").Find(&webhooks).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return webhooks, nil
+}
+
+/*
+Метод получения подписки по id
+*/
+func (s *Storage) GetWebhook(ctx context.Context, id uint) (*models.Webhook, error) {
+	var webhook models.Webhook
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Read)
+	defer cancel()
+	if err := db.First(&webhook, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, database.ErrWebhookNotFound
+		}
+		return nil, translateError(err)
+	}
+	return &webhook, nil
+}
+
+/*
+Метод добавления подписки
+*/
+func (s *Storage) AddWebhook(ctx context.Context, webhook *models.Webhook) error {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	return translateError(db.Create(webhook).Error)
+}
+
+/*
+Метод изменения подписки (адрес, типы событий, активность и секрет)
+*/
+func (s *Storage) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	//Select: нулевые значения (active = false, пустой список событий) тоже сохраняются
+	result := db.Model(webhook).Select("URL", "Events", "Secret", "Active").Updates(webhook)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return database.ErrWebhookNotFound
+	}
+	return nil
+}
+
+/*
+Метод удаления подписки вместе с доставками и журналом попыток
+*/
+func (s *Storage) DeleteWebhook(ctx context.Context, id uint) error {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	result := db.Delete(&models.Webhook{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return database.ErrWebhookNotFound
+	}
+	return nil
+}
+
+/*
+Метод постановки доставок в очередь
+*/
+func (s *Storage) AddWebhookDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	return translateError(db.Omit(clause.Associations).Create(&deliveries).Error)
+}
+
+/*
+Метод получения доставок подписки, новые первыми (status - фильтр по состоянию)
+*/
+func (s *Storage) ListWebhookDeliveries(ctx context.Context, webhookID uint, status string, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Read)
+	defer cancel()
+	query := db.Where("webhook_id = ?", webhookID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return deliveries, nil
+}
+
+/*
+Метод получения доставки с журналом попыток
+*/
+func (s *Storage) GetWebhookDelivery(ctx context.Context, webhookID uint, deliveryID uint) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Read)
+	defer cancel()
+	err := db.Preload("AttemptLog", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("webhook_id = ?", webhookID).First(&delivery, deliveryID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, database.ErrDeliveryNotFound
+		}
+		return nil, translateError(err)
+	}
+	return &delivery, nil
+}
+
+/*
+Метод повторной отправки: доставка снова ставится в очередь с полным числом попыток
+*/
+func (s *Storage) RedeliverWebhookDelivery(ctx context.Context, webhookID uint, deliveryID uint) error {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	result := db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND webhook_id = ?", deliveryID, webhookID).
+		Updates(map[string]any{
+			"status":          models.DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return database.ErrDeliveryNotFound
+	}
+	return nil
+}
+
+/*
+Метод выбора доставок, время которых наступило.
+Выбранные доставки откладываются на lease, чтобы другой экземпляр сервера не отправил их одновременно;
+если отправитель остановится, не записав результат, доставка будет повторена после lease.
+*/
+func (s *Storage) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, now).
+			Order("next_attempt_at").Limit(limit).Find(&deliveries).Error
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+		ids := make([]uint, len(deliveries))
+		for i := range deliveries {
+			ids[i] = deliveries[i].ID
+		}
+		err = tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(lease)).Error
+		if err != nil {
+			return err
+		}
+		//Подписка нужна отправителю: адрес и секрет
+		return tx.Preload("Webhook").Find(&deliveries, ids).Error
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return deliveries, nil
+}
+
+/*
+Метод записи результата попытки: строка журнала и новое состояние доставки
+*/
+func (s *Storage) RecordWebhookAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt *models.WebhookAttempt) error {
+	db, cancel := s.withTimeout(ctx, config.DatabaseSetting.Timeouts.Write)
+	defer cancel()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(attempt).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.WebhookDelivery{ID: delivery.ID}).Updates(map[string]any{
+			"status":           delivery.Status,
+			"attempts":         delivery.Attempts,
+			"next_attempt_at":  delivery.NextAttemptAt,
+			"last_status_code": delivery.LastStatusCode,
+			"last_error":       delivery.LastError,
+			"delivered_at":     delivery.DeliveredAt,
+		}).Error
+	})
+	return translateError(err)
+}
@@ -0,0 +1,251 @@
+package events
+
+import (
+	"WST_lab6_server/internal/metrics"
+	"WST_lab6_server/internal/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Типы событий ленты изменений
+const (
+	TypeCreated = "person.created"
+	TypeUpdated = "person.updated"
+	TypeDeleted = "person.deleted"
+	//Запрошенное продолжение вышло за пределы журнала: клиенту нужно перечитать список целиком
+	TypeReset = "reset"
+)
+
+// Значения по умолчанию
+const (
+	defaultLogSize          = 1000
+	defaultSubscriberBuffer = 64
+)
+
+/*
+Событие изменения записи. Для удаления передается только PersonID.
+*/
+type Event struct {
+	ID       uint64         `json:"id,omitempty"`
+	Type     string         `json:"type"`
+	PersonID uint           `json:"personId,omitempty"`
+	Person   *models.Person `json:"person,omitempty"`
+	Time     time.Time      `json:"time"`
+}
+
+/*
+Фильтр подписки: типы событий (пусто - все) и id записи (0 - все)
+*/
+type Filter struct {
+	Types    map[string]bool
+	PersonID uint
+}
+
+/*
+Функция разбора списка типов: полные (person.created) или краткие (created) имена через запятую
+*/
+func ParseTypes(value string) (map[string]bool, bool) {
+	if value == "" {
+		return nil, true
+	}
+	types := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if !strings.HasPrefix(name, "person.") {
+			name = "person." + name
+		}
+		switch name {
+		case TypeCreated, TypeUpdated, TypeDeleted:
+			types[name] = true
+		default:
+			return nil, false
+		}
+	}
+	return types, true
+}
+
+/*
+Метод проверки события фильтром
+*/
+func (f Filter) Match(event *Event) bool {
+	if len(f.Types) > 0 && !f.Types[event.Type] {
+		return false
+	}
+	return f.PersonID == 0 || f.PersonID == event.PersonID
+}
+
+/*
+Подписка на события. Канал закрывается при отписке, остановке брокера
+или переполнении очереди (Dropped возвращает true).
+*/
+type Subscription struct {
+	C       <-chan Event
+	ch      chan Event
+	filter  Filter
+	dropped bool
+}
+
+/*
+Метод проверки отключения подписчика из-за переполнения очереди
+*/
+func (s *Subscription) Dropped() bool {
+	return s.dropped
+}
+
+/*
+Брокер событий: рассылает события подписчикам и хранит ограниченный журнал последних событий
+для продолжения по Last-Event-ID. Publish и Close допускают nil (лента изменений отключена).
+*/
+type Broker struct {
+	mu          sync.Mutex
+	log         []Event
+	next        int
+	full        bool
+	lastID      uint64
+	buffer      int
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+/*
+Функция создания брокера (0 - размеры по умолчанию)
+*/
+func NewBroker(logSize int, subscriberBuffer int) *Broker {
+	if logSize <= 0 {
+		logSize = defaultLogSize
+	}
+	if subscriberBuffer <= 0 {
+		subscriberBuffer = defaultSubscriberBuffer
+	}
+	return &Broker{
+		log:    make([]Event, logSize),
+		buffer: subscriberBuffer,
+		//Идентификаторы продолжаются от времени запуска, чтобы Last-Event-ID
+		//предыдущего процесса не совпал с событиями нового
+		lastID:      uint64(time.Now().UnixMicro()),
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+/*
+Метод публикации события. Идентификатор назначается брокером, время без значения - текущее.
+Подписчик с переполненной очередью отключается, чтобы медленный клиент не задерживал доставку.
+*/
+func (b *Broker) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Person != nil {
+		//Копия: запись вызывающего может измениться после публикации
+		copied := *event.Person
+		event.Person = &copied
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.lastID++
+	event.ID = b.lastID
+	b.log[b.next] = event
+	b.next = (b.next + 1) % len(b.log)
+	if b.next == 0 {
+		b.full = true
+	}
+	metrics.EventsPublished.WithLabelValues(event.Type).Inc()
+	for subscription := range b.subscribers {
+		if !subscription.filter.Match(&event) {
+			continue
+		}
+		select {
+		case subscription.ch <- event:
+		default:
+			subscription.dropped = true
+			b.remove(subscription)
+			metrics.EventSubscribersDropped.Inc()
+		}
+	}
+}
+
+/*
+Метод подписки. При resume возвращаются события журнала после lastEventID,
+если журнал их еще содержит; иначе complete = false и клиенту нужен TypeReset.
+*/
+func (b *Broker) Subscribe(filter Filter, resume bool, lastEventID uint64) (subscription *Subscription, replay []Event, complete bool) {
+	ch := make(chan Event, b.buffer)
+	subscription = &Subscription{C: ch, ch: ch, filter: filter}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return subscription, nil, true
+	}
+	b.subscribers[subscription] = struct{}{}
+	if !resume {
+		return subscription, nil, true
+	}
+	events := b.snapshot()
+	oldest := b.lastID + 1
+	if len(events) > 0 {
+		oldest = events[0].ID
+	}
+	//Пропущенные события уже вытеснены из журнала или идентификатор не из этого процесса
+	if lastEventID+1 < oldest || lastEventID > b.lastID {
+		return subscription, nil, false
+	}
+	for _, event := range events {
+		if event.ID > lastEventID && filter.Match(&event) {
+			replay = append(replay, event)
+		}
+	}
+	return subscription, replay, true
+}
+
+/*
+Метод отписки
+*/
+func (b *Broker) Unsubscribe(subscription *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(subscription)
+}
+
+/*
+Метод остановки брокера: каналы подписчиков закрываются, потоки клиентов завершаются
+*/
+func (b *Broker) Close() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for subscription := range b.subscribers {
+		b.remove(subscription)
+	}
+}
+
+/*
+Метод удаления подписчика (вызывается под блокировкой)
+*/
+func (b *Broker) remove(subscription *Subscription) {
+	if _, ok := b.subscribers[subscription]; !ok {
+		return
+	}
+	delete(b.subscribers, subscription)
+	close(subscription.ch)
+}
+
+/*
+Метод получения журнала в порядке публикации (вызывается под блокировкой)
+*/
+func (b *Broker) snapshot() []Event {
+	if !b.full {
+		return append([]Event(nil), b.log[:b.next]...)
+	}
+	return append(append([]Event(nil), b.log[b.next:]...), b.log[:b.next]...)
+}
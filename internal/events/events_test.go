@@ -0,0 +1,148 @@
+package events
+
+import (
+	"WST_lab6_server/internal/models"
+	"testing"
+)
+
+/*
+Функция чтения событий из очереди подписчика без ожидания
+*/
+func received(subscription *Subscription) []Event {
+	var result []Event
+	for {
+		select {
+		case event, ok := <-subscription.C:
+			if !ok {
+				return result
+			}
+			result = append(result, event)
+		default:
+			return result
+		}
+	}
+}
+
+func publishN(broker *Broker, n int) {
+	for i := 0; i < n; i++ {
+		broker.Publish(Event{Type: TypeCreated, PersonID: uint(i + 1)})
+	}
+}
+
+func TestParseTypes(t *testing.T) {
+	types, ok := ParseTypes("created, person.deleted")
+	if !ok || len(types) != 2 || !types[TypeCreated] || !types[TypeDeleted] {
+		t.Fatalf("ParseTypes = %v, %v", types, ok)
+	}
+	if _, ok := ParseTypes("created,renamed"); ok {
+		t.Error("unknown type accepted")
+	}
+	if types, ok := ParseTypes(""); !ok || types != nil {
+		t.Errorf("empty list: %v, %v", types, ok)
+	}
+}
+
+func TestPublishFilter(t *testing.T) {
+	broker := NewBroker(10, 10)
+	all, _, _ := broker.Subscribe(Filter{}, false, 0)
+	deleted, _, _ := broker.Subscribe(Filter{Types: map[string]bool{TypeDeleted: true}}, false, 0)
+	person, _, _ := broker.Subscribe(Filter{PersonID: 2}, false, 0)
+	original := &models.Person{ID: 2, Name: "Ivan"}
+	broker.Publish(Event{Type: TypeCreated, PersonID: 1})
+	broker.Publish(Event{Type: TypeUpdated, PersonID: 2, Person: original})
+	broker.Publish(Event{Type: TypeDeleted, PersonID: 1})
+	original.Name = "Petr"
+	if events := received(all); len(events) != 3 || events[1].ID != events[0].ID+1 || events[2].ID != events[1].ID+1 {
+		t.Fatalf("all: %+v", events)
+	}
+	if events := received(deleted); len(events) != 1 || events[0].Type != TypeDeleted {
+		t.Errorf("type filter: %+v", events)
+	}
+	events := received(person)
+	if len(events) != 1 || events[0].PersonID != 2 || events[0].Time.IsZero() {
+		t.Fatalf("person filter: %+v", events)
+	}
+	//Брокер публикует копию записи
+	if events[0].Person.Name != "Ivan" {
+		t.Errorf("published person changed with the caller's copy: %+v", events[0].Person)
+	}
+}
+
+func TestSubscribeResume(t *testing.T) {
+	broker := NewBroker(5, 10)
+	first, _, _ := broker.Subscribe(Filter{}, false, 0)
+	publishN(broker, 3)
+	ids := received(first)
+	//Продолжение после первого события: в ответе остальные события журнала по фильтру
+	_, replay, complete := broker.Subscribe(Filter{}, true, ids[0].ID)
+	if !complete || len(replay) != 2 || replay[0].ID != ids[1].ID || replay[1].ID != ids[2].ID {
+		t.Fatalf("replay %+v, complete %v", replay, complete)
+	}
+	_, replay, complete = broker.Subscribe(Filter{PersonID: 3}, true, ids[0].ID)
+	if !complete || len(replay) != 1 || replay[0].PersonID != 3 {
+		t.Fatalf("filtered replay %+v, complete %v", replay, complete)
+	}
+	//Клиент уже получил все события
+	if _, replay, complete := broker.Subscribe(Filter{}, true, ids[2].ID); !complete || len(replay) != 0 {
+		t.Errorf("up to date: replay %+v, complete %v", replay, complete)
+	}
+}
+
+func TestSubscribeReset(t *testing.T) {
+	broker := NewBroker(3, 10)
+	first, _, _ := broker.Subscribe(Filter{}, false, 0)
+	publishN(broker, 5)
+	ids := received(first)
+	//Первые два события вытеснены из журнала размером 3
+	if _, replay, complete := broker.Subscribe(Filter{}, true, ids[0].ID); complete || replay != nil {
+		t.Errorf("evicted position: replay %+v, complete %v", replay, complete)
+	}
+	if _, replay, complete := broker.Subscribe(Filter{}, true, ids[1].ID); !complete || len(replay) != 3 {
+		t.Errorf("oldest kept position: replay %+v, complete %v", replay, complete)
+	}
+	//Идентификатор из будущего (предыдущий процесс или ошибка клиента)
+	if _, _, complete := broker.Subscribe(Filter{}, true, ids[4].ID+100); complete {
+		t.Error("unknown future id was resumed")
+	}
+}
+
+func TestDropOnOverflow(t *testing.T) {
+	broker := NewBroker(10, 2)
+	slow, _, _ := broker.Subscribe(Filter{}, false, 0)
+	other, _, _ := broker.Subscribe(Filter{PersonID: 1}, false, 0)
+	publishN(broker, 3)
+	events := received(slow)
+	if len(events) != 2 || !slow.Dropped() {
+		t.Fatalf("slow subscriber: %d events, dropped %v", len(events), slow.Dropped())
+	}
+	if _, ok := <-slow.C; ok {
+		t.Error("channel of dropped subscriber is open")
+	}
+	//Подписчик с неполной очередью продолжает получать события
+	broker.Publish(Event{Type: TypeUpdated, PersonID: 1})
+	if events := received(other); len(events) != 2 || other.Dropped() {
+		t.Errorf("other subscriber: %d events, dropped %v", len(events), other.Dropped())
+	}
+}
+
+func TestUnsubscribeAndClose(t *testing.T) {
+	broker := NewBroker(10, 10)
+	subscription, _, _ := broker.Subscribe(Filter{}, false, 0)
+	broker.Unsubscribe(subscription)
+	broker.Unsubscribe(subscription)
+	if _, ok := <-subscription.C; ok || subscription.Dropped() {
+		t.Error("unsubscribed channel is open or marked dropped")
+	}
+	open, _, _ := broker.Subscribe(Filter{}, false, 0)
+	broker.Close()
+	if _, ok := <-open.C; ok {
+		t.Error("channel is open after Close")
+	}
+	broker.Publish(Event{Type: TypeCreated})
+	if late, _, _ := broker.Subscribe(Filter{}, true, 0); received(late) != nil {
+		t.Error("subscription after Close received events")
+	}
+	var disabled *Broker
+	disabled.Publish(Event{Type: TypeCreated})
+	disabled.Close()
+}
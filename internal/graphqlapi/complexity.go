@@ -0,0 +1,169 @@
+package graphqlapi
+
+import (
+	"WST_lab6_server/config"
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Ограничения по умолчанию
+const (
+	defaultMaxDepth      = 15
+	defaultMaxComplexity = 1000
+)
+
+/*
+Функция выбора выполняемой операции документа
+*/
+func selectOperation(doc *ast.Document, operationName string) *ast.OperationDefinition {
+	var selected *ast.OperationDefinition
+	for _, definition := range doc.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" {
+			if selected != nil {
+				//Несколько операций без имени - ошибку вернет выполнение
+				return nil
+			}
+			selected = operation
+			continue
+		}
+		if operation.Name != nil && operation.Name.Value == operationName {
+			return operation
+		}
+	}
+	return selected
+}
+
+/*
+Структура оценки запроса: вложенность и стоимость.
+Каждое поле стоит 1, поля со списками (persons, search) умножают стоимость вложенных полей на размер страницы.
+*/
+type estimator struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+/*
+Функция проверки ограничений вложенности и стоимости запроса.
+Вызывается после проверки документа по схеме, поэтому циклы фрагментов невозможны.
+*/
+func checkComplexity(doc *ast.Document, operation *ast.OperationDefinition, variables map[string]interface{}) *apiError {
+	e := &estimator{fragments: map[string]*ast.FragmentDefinition{}, variables: variables}
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			e.fragments[fragment.Name.Value] = fragment
+		}
+	}
+	depth, complexity := e.selectionSet(operation.SelectionSet)
+
+	maxDepth := config.GraphQLSetting.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxDepth
+	}
+	maxComplexity := config.GraphQLSetting.MaxComplexity
+	if maxComplexity <= 0 {
+		maxComplexity = defaultMaxComplexity
+	}
+	if depth > maxDepth {
+		return &apiError{message: fmt.Sprintf("Query depth %d exceeds the limit of %d.", depth, maxDepth), code: "QUERY_TOO_COMPLEX"}
+	}
+	if complexity > maxComplexity {
+		return &apiError{message: fmt.Sprintf("Query complexity %d exceeds the limit of %d.", complexity, maxComplexity), code: "QUERY_TOO_COMPLEX"}
+	}
+	return nil
+}
+
+/*
+Метод оценки набора полей: возвращает глубину и стоимость
+*/
+func (e *estimator) selectionSet(set *ast.SelectionSet) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+	depth, complexity := 0, 0
+	for _, selection := range set.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			childDepth, childComplexity := e.selectionSet(selection.SelectionSet)
+			depth = max(depth, childDepth+1)
+			complexity += 1 + childComplexity*e.multiplier(selection)
+		case *ast.InlineFragment:
+			childDepth, childComplexity := e.selectionSet(selection.SelectionSet)
+			depth = max(depth, childDepth)
+			complexity += childComplexity
+		case *ast.FragmentSpread:
+			if fragment, ok := e.fragments[selection.Name.Value]; ok {
+				childDepth, childComplexity := e.selectionSet(fragment.SelectionSet)
+				depth = max(depth, childDepth)
+				complexity += childComplexity
+			}
+		}
+	}
+	return depth, complexity
+}
+
+/*
+Метод определения множителя стоимости вложенных полей
+*/
+func (e *estimator) multiplier(field *ast.Field) int {
+	switch field.Name.Value {
+	case "persons":
+		limit := 0
+		for _, argument := range field.Arguments {
+			if argument.Name.Value != "pagination" {
+				continue
+			}
+			if pagination, ok := e.value(argument.Value).(map[string]interface{}); ok {
+				limit = toInt(pagination["limit"])
+			}
+		}
+		return pageSize(limit)
+	case "search":
+		first := 0
+		for _, argument := range field.Arguments {
+			if argument.Name.Value == "first" {
+				first = toInt(e.value(argument.Value))
+			}
+		}
+		return pageSize(first)
+	}
+	return 1
+}
+
+/*
+Метод получения значения аргумента с подстановкой переменных
+*/
+func (e *estimator) value(value ast.Value) interface{} {
+	switch value := value.(type) {
+	case *ast.Variable:
+		return e.variables[value.Name.Value]
+	case *ast.IntValue:
+		number, _ := strconv.Atoi(value.Value)
+		return number
+	case *ast.ObjectValue:
+		object := map[string]interface{}{}
+		for _, field := range value.Fields {
+			object[field.Name.Value] = e.value(field.Value)
+		}
+		return object
+	}
+	return nil
+}
+
+/*
+Функция приведения числа из литерала или JSON переменной
+*/
+func toInt(value interface{}) int {
+	switch value := value.(type) {
+	case int:
+		return value
+	case float64:
+		return int(value)
+	}
+	return 0
+}
@@ -0,0 +1,132 @@
+package graphqlapi
+
+import (
+	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/metrics"
+	"WST_lab6_server/internal/middleware"
+	"WST_lab6_server/internal/tracing"
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Ключ роли пользователя в контексте запроса
+type roleKey struct{}
+
+/*
+Функция получения роли пользователя текущего запроса
+*/
+func requestRole(ctx context.Context) string {
+	if role, ok := ctx.Value(roleKey{}).(string); ok {
+		return role
+	}
+	return middleware.AnonymousRole()
+}
+
+/*
+Тело запроса GraphQL
+*/
+type request struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+/*
+Обработчик /graphql
+*/
+type Handler struct {
+	schema graphql.Schema
+}
+
+/*
+Функция создания обработчика
+*/
+func NewHandler(storage *postgres.Storage) (*Handler, error) {
+	schema, err := NewSchema(storage)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{schema: schema}, nil
+}
+
+/*
+Функция ответа с ошибками запроса (синтаксис, схема, ограничения)
+*/
+func abortWithErrors(context *gin.Context, status int, errs ...gqlerrors.FormattedError) {
+	context.AbortWithStatusJSON(status, gin.H{"errors": errs})
+}
+
+/*
+Метод обработки запроса GraphQL.
+Чтение доступно с анонимной ролью, мутации требуют учетных данных, как изменяющие маршруты REST API.
+*/
+func (h *Handler) Serve(context *gin.Context) {
+	ctx, span := tracing.Tracer().Start(context.Request.Context(), "graphql.Execute")
+	defer span.End()
+	context.Request = context.Request.WithContext(ctx)
+
+	var req request
+	if err := context.ShouldBindJSON(&req); err != nil {
+		if middleware.AbortIfBodyTooLarge(context, err) {
+			return
+		}
+		middleware.AbortWithProblem(context, http.StatusBadRequest, "Could not parse request data.")
+		return
+	}
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		abortWithErrors(context, http.StatusBadRequest, gqlerrors.FormatError(err))
+		return
+	}
+	if result := graphql.ValidateDocument(&h.schema, doc, nil); !result.IsValid {
+		abortWithErrors(context, http.StatusBadRequest, result.Errors...)
+		return
+	}
+	operation := selectOperation(doc, req.OperationName)
+	if operation == nil {
+		abortWithErrors(context, http.StatusBadRequest, gqlerrors.NewFormattedError("Unknown operation or operation name is required."))
+		return
+	}
+	span.SetAttributes(attribute.String("graphql.operation.type", operation.Operation))
+	//Мутации только с учетными данными (OptionalBasicAuthMiddleware уже отклонил неверные)
+	if operation.Operation == ast.OperationTypeMutation && context.GetString(middleware.UserKey) == "" {
+		metrics.AuthFailures.WithLabelValues("missing_header").Inc()
+		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is missing"})
+		return
+	}
+	//Мутации доступны ролям editor и admin, как изменяющие маршруты REST API
+	if operation.Operation == ast.OperationTypeMutation && !middleware.HasRole(middleware.RequestRole(context), middleware.WriteRoles...) {
+		metrics.AuthFailures.WithLabelValues("forbidden").Inc()
+		middleware.AbortWithProblem(context, http.StatusForbidden, "Role "+middleware.RequestRole(context)+" is not allowed to run mutations.")
+		return
+	}
+	if err := checkComplexity(doc, operation, req.Variables); err != nil {
+		formatted := gqlerrors.NewFormattedError(err.Error())
+		formatted.Extensions = err.Extensions()
+		abortWithErrors(context, http.StatusBadRequest, formatted)
+		return
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       withRole(ctx, middleware.RequestRole(context)),
+	})
+	context.JSON(http.StatusOK, result)
+}
+
+/*
+Функция сохранения роли пользователя в контексте для резолверов
+*/
+func withRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleKey{}, role)
+}
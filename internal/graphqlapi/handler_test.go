@@ -0,0 +1,278 @@
+package graphqlapi
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/database/dbtest"
+	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/middleware"
+	"WST_lab6_server/internal/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+/*
+Функция настройки пользователей (пароль secret), скрытия полей для viewer и ограничений запросов на время теста
+*/
+func setupConfig(t *testing.T) {
+	t.Helper()
+	logging.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedAuth, savedPII, savedGraphQL := *config.AuthSetting, *config.PIISetting, *config.GraphQLSetting
+	t.Cleanup(func() {
+		*config.AuthSetting, *config.PIISetting, *config.GraphQLSetting = savedAuth, savedPII, savedGraphQL
+	})
+	config.AuthSetting.Users = []config.UserConfig{
+		{Username: "viewer", PasswordHash: string(hash), Role: "viewer"},
+		{Username: "editor", PasswordHash: string(hash), Role: "editor"},
+	}
+	config.AuthSetting.AnonymousRole = "viewer"
+	config.PIISetting.Redaction = map[string][]string{"viewer": {"email", "telephone"}}
+	*config.GraphQLSetting = config.GraphQLConfig{}
+}
+
+/*
+Функция создания маршрутизатора с /graphql (как в routes) поверх тестовой базы данных с count записями
+*/
+func newTestEngine(t *testing.T, count int) *gin.Engine {
+	t.Helper()
+	storage := &postgres.Storage{DB: dbtest.Open(t, postgres.Tables...)}
+	for i := 1; i <= count; i++ {
+		person := &models.Person{Name: "Olga", Surname: fmt.Sprintf("Ditr%d", i), Age: 30 + i,
+			Email: fmt.Sprintf("olga%d@mail.com", i), Telephone: fmt.Sprintf("+7001123457%d", i%10)}
+		if _, err := storage.AddPerson(context.Background(), person); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler, err := NewHandler(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := gin.New()
+	engine.POST("/graphql", middleware.OptionalBasicAuthMiddleware(), handler.Serve)
+	return engine
+}
+
+/*
+Ответ GraphQL
+*/
+type response struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+/*
+Функция выполнения запроса от имени пользователя (пустое имя - без учетных данных)
+*/
+func execute(t *testing.T, engine *gin.Engine, user string, query string, variables map[string]any) (int, response) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": variables})
+	request := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	if user != "" {
+		request.SetBasicAuth(user, "secret")
+	}
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	var result response
+	_ = json.Unmarshal(recorder.Body.Bytes(), &result)
+	return recorder.Code, result
+}
+
+/*
+Запись в ответе GraphQL (id имеет тип ID и передается строкой)
+*/
+type gqlPerson struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Surname   string `json:"surname"`
+	Age       int    `json:"age"`
+	Email     string `json:"email"`
+	Telephone string `json:"telephone"`
+}
+
+/*
+Функция разбора поля data в значение
+*/
+func decodeField(t *testing.T, result response, field string, value any) {
+	t.Helper()
+	if len(result.Errors) > 0 {
+		t.Fatalf("errors: %+v", result.Errors)
+	}
+	if err := json.Unmarshal(result.Data[field], value); err != nil {
+		t.Fatalf("%s: %v", field, err)
+	}
+}
+
+func TestMutationRoles(t *testing.T) {
+	setupConfig(t)
+	engine := newTestEngine(t, 0)
+	mutation := `mutation { createPerson(input: {name: "Ivan", surname: "Ivanov", age: 30, email: "ivan@mail.com", telephone: "+79990000001"}) { id email } }`
+	tests := []struct {
+		user   string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"viewer", http.StatusForbidden},
+		{"editor", http.StatusOK},
+	}
+	for _, test := range tests {
+		code, result := execute(t, engine, test.user, mutation, nil)
+		if code != test.status {
+			t.Errorf("user %q: status %d, want %d", test.user, code, test.status)
+		}
+		if test.status == http.StatusOK {
+			var person gqlPerson
+			decodeField(t, result, "createPerson", &person)
+			if person.Email != "ivan@mail.com" {
+				t.Errorf("created %+v", person)
+			}
+		}
+	}
+	//Запросы чтения доступны без учетных данных
+	if code, result := execute(t, engine, "", `{ persons { total } }`, nil); code != http.StatusOK || len(result.Errors) > 0 {
+		t.Errorf("anonymous query: %d %+v", code, result.Errors)
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	setupConfig(t)
+	engine := newTestEngine(t, 0)
+	config.GraphQLSetting.MaxDepth = 2
+	config.GraphQLSetting.MaxComplexity = 50
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]any
+		rejected  bool
+	}{
+		{"depth", `{ persons { items { id } } }`, nil, true},
+		{"depth within limit", `{ search(query: "Olga") { id } }`, nil, false},
+		//Стоимость search: 1 + поля записи * first (по умолчанию 20, не больше maxPageSize)
+		{"complexity", `{ search(query: "Olga", first: 100) { id name } }`, nil, true},
+		{"complexity within limit", `{ search(query: "Olga", first: 10) { id name } }`, nil, false},
+		{"complexity variable", `query($first: Int) { search(query: "Olga", first: $first) { id name } }`, map[string]any{"first": 30}, true},
+		{"persons complexity", `query { persons(pagination: {limit: 30}) { total } }`, nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, result := execute(t, engine, "", test.query, test.variables)
+			if !test.rejected {
+				if code != http.StatusOK || len(result.Errors) > 0 {
+					t.Errorf("status %d, errors %+v", code, result.Errors)
+				}
+				return
+			}
+			if code != http.StatusBadRequest || len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != "QUERY_TOO_COMPLEX" {
+				t.Errorf("status %d, errors %+v", code, result.Errors)
+			}
+		})
+	}
+}
+
+func TestPersonsFilterAndPagination(t *testing.T) {
+	setupConfig(t)
+	engine := newTestEngine(t, 5)
+	var page struct {
+		Items  []gqlPerson `json:"items"`
+		Total  int         `json:"total"`
+		Offset int         `json:"offset"`
+		Limit  int         `json:"limit"`
+	}
+	_, result := execute(t, engine, "editor", `{ persons(filter: {ageMin: 33}, pagination: {offset: 1, limit: 1}) { total offset limit items { name surname age } } }`, nil)
+	decodeField(t, result, "persons", &page)
+	if page.Total != 3 || page.Offset != 1 || page.Limit != 1 || len(page.Items) != 1 || page.Items[0].Surname != "Ditr4" {
+		t.Errorf("persons: %+v", page)
+	}
+	//limit больше maxPageSize ограничивается
+	config.GraphQLSetting.MaxPageSize = 2
+	_, result = execute(t, engine, "editor", `{ persons(pagination: {limit: 50}) { limit items { id } } }`, nil)
+	decodeField(t, result, "persons", &page)
+	if page.Limit != 2 || len(page.Items) != 2 {
+		t.Errorf("capped persons: %+v", page)
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	setupConfig(t)
+	engine := newTestEngine(t, 5)
+	var ids []string
+	after := ""
+	for pages := 0; pages < 3; pages++ {
+		variables := map[string]any{"after": nil}
+		if after != "" {
+			variables["after"] = after
+		}
+		_, result := execute(t, engine, "editor", `query($after: ID) { search(query: "Olga", first: 2, after: $after) { id } }`, variables)
+		var persons []gqlPerson
+		decodeField(t, result, "search", &persons)
+		for _, person := range persons {
+			ids = append(ids, person.ID)
+		}
+		if len(persons) < 2 {
+			break
+		}
+		after = persons[len(persons)-1].ID
+	}
+	if fmt.Sprint(ids) != "[1 2 3 4 5]" {
+		t.Errorf("ids %v", ids)
+	}
+	_, result := execute(t, engine, "editor", `{ search(query: "Olga", after: "abc") { id } }`, nil)
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != "BAD_USER_INPUT" {
+		t.Errorf("invalid after: %+v", result.Errors)
+	}
+	//Без first выдача ограничена размером страницы
+	config.GraphQLSetting.DefaultPageSize = 3
+	_, result = execute(t, engine, "editor", `{ search(query: "Olga") { id } }`, nil)
+	var persons []gqlPerson
+	decodeField(t, result, "search", &persons)
+	if len(persons) != 3 {
+		t.Errorf("default page: %d persons", len(persons))
+	}
+}
+
+func TestViewerRedaction(t *testing.T) {
+	setupConfig(t)
+	engine := newTestEngine(t, 2)
+	query := `{ person(id: "1") { email telephone } search(query: "Olga") { email } persons(filter: {email: "olga1@"}) { total } }`
+	var person gqlPerson
+	var found []gqlPerson
+	var page struct {
+		Total int `json:"total"`
+	}
+	for _, user := range []string{"", "viewer"} {
+		_, result := execute(t, engine, user, query, nil)
+		decodeField(t, result, "person", &person)
+		decodeField(t, result, "search", &found)
+		decodeField(t, result, "persons", &page)
+		if person.Email == "olga1@mail.com" || person.Telephone == "+70011234571" || len(found) != 2 || found[0].Email == "olga1@mail.com" {
+			t.Errorf("user %q sees %+v %+v", user, person, found)
+		}
+		//Фильтр по скрытому полю не применяется
+		if page.Total != 2 {
+			t.Errorf("user %q: filter by hidden email applied, total %d", user, page.Total)
+		}
+	}
+	_, result := execute(t, engine, "editor", query, nil)
+	decodeField(t, result, "person", &person)
+	decodeField(t, result, "persons", &page)
+	if person.Email != "olga1@mail.com" || page.Total != 1 {
+		t.Errorf("editor sees %+v, total %d", person, page.Total)
+	}
+}
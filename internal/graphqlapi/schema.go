@@ -0,0 +1,369 @@
+package graphqlapi
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/database"
+	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/metrics"
+	"WST_lab6_server/internal/models"
+	"WST_lab6_server/internal/openapi"
+	"WST_lab6_server/internal/pii"
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+	"go.uber.org/zap"
+)
+
+// Значения по умолчанию для ограничений запросов
+const (
+	defaultPageSize = 20
+	defaultMaxPage  = 100
+)
+
+/*
+Ошибка GraphQL с кодом в extensions (NOT_FOUND, CONFLICT, BAD_USER_INPUT, ...)
+*/
+type apiError struct {
+	message    string
+	code       string
+	violations []models.Violation
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func (e *apiError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": e.code}
+	if len(e.violations) > 0 {
+		extensions["violations"] = e.violations
+	}
+	return extensions
+}
+
+/*
+Функция преобразования ошибок пакета database в ошибки GraphQL
+*/
+func storageError(ctx context.Context, err error, message string) error {
+	switch {
+	case errors.Is(err, database.ErrPersonNotFound):
+		return &apiError{message: "Person not found.", code: "NOT_FOUND"}
+	case errors.Is(err, database.ErrEmailExists):
+		return &apiError{message: "Email already in use.", code: "CONFLICT"}
+	case errors.Is(err, database.ErrQueryTimeout):
+		return &apiError{message: "Database query timed out.", code: "TIMEOUT"}
+	case errors.Is(err, database.ErrUnavailable):
+		return &apiError{message: "Database is unavailable.", code: "UNAVAILABLE"}
+	}
+	logging.FromContext(ctx).Error("storage error", zap.Error(err))
+	return &apiError{message: message, code: "INTERNAL_SERVER_ERROR"}
+}
+
+/*
+Функция проверки записи по схеме документа OpenAPI (PersonCreate, PersonUpdate)
+*/
+func validatePerson(schema string, person *models.Person) error {
+	violations, err := openapi.ValidateSchema(schema, person)
+	if err != nil {
+		return &apiError{message: "Request validation is unavailable.", code: "INTERNAL_SERVER_ERROR"}
+	}
+	if len(violations) > 0 {
+		return &apiError{message: "Input does not match the API specification.", code: "BAD_USER_INPUT", violations: violations}
+	}
+	return nil
+}
+
+/*
+Функция разбора аргумента типа ID
+*/
+func idArgument(args map[string]interface{}) (uint, error) {
+	raw, _ := args["id"].(string)
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil || id == 0 {
+		return 0, &apiError{message: "Could not parse person id.", code: "BAD_USER_INPUT"}
+	}
+	return uint(id), nil
+}
+
+/*
+Функция разбора входных данных записи
+*/
+func personInput(args map[string]interface{}) models.Person {
+	input, _ := args["input"].(map[string]interface{})
+	person := models.Person{}
+	person.Name, _ = input["name"].(string)
+	person.Surname, _ = input["surname"].(string)
+	person.Age, _ = input["age"].(int)
+	person.Email, _ = input["email"].(string)
+	person.Telephone, _ = input["telephone"].(string)
+	return person
+}
+
+/*
+Функция получения наибольшего размера страницы
+*/
+func maxPageSize() int {
+	if config.GraphQLSetting.MaxPageSize > 0 {
+		return config.GraphQLSetting.MaxPageSize
+	}
+	return defaultMaxPage
+}
+
+/*
+Функция ограничения размера страницы по настройкам graphql
+*/
+func pageSize(limit int) int {
+	maxPage := maxPageSize()
+	if limit <= 0 {
+		limit = config.GraphQLSetting.DefaultPageSize
+		if limit <= 0 {
+			limit = defaultPageSize
+		}
+	}
+	return min(limit, maxPage)
+}
+
+/*
+Функция подготовки записей к ответу со скрытием полей, недоступных роли
+*/
+func redact(ctx context.Context, persons []models.Person) []models.Person {
+	role := requestRole(ctx)
+	for i := range persons {
+		pii.RedactPerson(&persons[i], role)
+	}
+	return persons
+}
+
+/*
+Функция построения схемы GraphQL поверх хранилища
+*/
+func NewSchema(storage *postgres.Storage) (graphql.Schema, error) {
+	personType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Person",
+		Description: "Запись о персоне",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return strconv.FormatUint(uint64(p.Source.(models.Person).ID), 10), nil
+				},
+			},
+			"name":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"surname":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"age":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"email":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"telephone": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+	pageType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PersonPage",
+		Fields: graphql.Fields{
+			"items":  &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(personType)))},
+			"total":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"offset": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"limit":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+	filterType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "PersonFilter",
+		Description: "Строковые поля ищутся по вхождению, возраст по диапазону",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":      &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"surname":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"email":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"telephone": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"ageMin":    &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"ageMax":    &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		},
+	})
+	paginationType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "Pagination",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"offset": &graphql.InputObjectFieldConfig{Type: graphql.Int, DefaultValue: 0},
+			"limit":  &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		},
+	})
+	inputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "PersonInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":      &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"surname":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"age":       &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"email":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"telephone": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+	idArgs := graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"person": &graphql.Field{
+				Type: personType,
+				Args: idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := idArgument(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					person, err := storage.GetPerson(p.Context, id)
+					if errors.Is(err, database.ErrPersonNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, storageError(p.Context, err, "Could not fetch person.")
+					}
+					return redact(p.Context, []models.Person{*person})[0], nil
+				},
+			},
+			"persons": &graphql.Field{
+				Type: graphql.NewNonNull(pageType),
+				Args: graphql.FieldConfigArgument{
+					"filter":     &graphql.ArgumentConfig{Type: filterType},
+					"pagination": &graphql.ArgumentConfig{Type: paginationType},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					filter := models.PersonFilter{}
+					if raw, ok := p.Args["filter"].(map[string]interface{}); ok {
+						filter.Name, _ = raw["name"].(string)
+						filter.Surname, _ = raw["surname"].(string)
+						filter.Email, _ = raw["email"].(string)
+						filter.Telephone, _ = raw["telephone"].(string)
+						if age, ok := raw["ageMin"].(int); ok {
+							filter.AgeMin = &age
+						}
+						if age, ok := raw["ageMax"].(int); ok {
+							filter.AgeMax = &age
+						}
+					}
+					offset, limit := 0, 0
+					if raw, ok := p.Args["pagination"].(map[string]interface{}); ok {
+						offset, _ = raw["offset"].(int)
+						limit, _ = raw["limit"].(int)
+					}
+					if offset < 0 {
+						return nil, &apiError{message: "Offset must not be negative.", code: "BAD_USER_INPUT"}
+					}
+					limit = pageSize(limit)
+					//Условия по полям, скрытым от роли, не применяются
+					pii.RedactFilter(&filter, requestRole(p.Context))
+					persons, total, err := storage.ListPersons(p.Context, filter, offset, limit)
+					if err != nil {
+						return nil, storageError(p.Context, err, "Could not fetch persons. Try again later.")
+					}
+					return map[string]interface{}{
+						"items":  redact(p.Context, persons),
+						"total":  int(total),
+						"offset": offset,
+						"limit":  limit,
+					}, nil
+				},
+			},
+			"search": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(personType))),
+				Description: "Поиск по всем полям (число ищется по возрасту): first записей с id больше after по возрастанию id",
+				Args: graphql.FieldConfigArgument{
+					"query": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"first": &graphql.ArgumentConfig{Type: graphql.Int},
+					"after": &graphql.ArgumentConfig{Type: graphql.ID},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					searchString, _ := p.Args["query"].(string)
+					if searchString == "" {
+						return nil, &apiError{message: "Search query is required.", code: "BAD_USER_INPUT"}
+					}
+					first, _ := p.Args["first"].(int)
+					if first < 0 {
+						return nil, &apiError{message: "First must not be negative.", code: "BAD_USER_INPUT"}
+					}
+					var after uint64
+					if raw, ok := p.Args["after"].(string); ok {
+						var err error
+						if after, err = strconv.ParseUint(raw, 10, 64); err != nil {
+							return nil, &apiError{message: "Could not parse after id.", code: "BAD_USER_INPUT"}
+						}
+					}
+					//Поля, скрытые от роли, в поиске не участвуют; страница та же, что учитывает checkComplexity
+					persons, err := storage.SearchPerson(p.Context, searchString, pii.HiddenFields(requestRole(p.Context)), uint(after), pageSize(first))
+					if err != nil {
+						return nil, storageError(p.Context, err, "Could not fetch persons. Try again later.")
+					}
+					return redact(p.Context, persons), nil
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createPerson": &graphql.Field{
+				Type: graphql.NewNonNull(personType),
+				Args: graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(inputType)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					person := personInput(p.Args)
+					if err := validatePerson("PersonCreate", &person); err != nil {
+						return nil, err
+					}
+					if _, err := storage.AddPerson(p.Context, &person); err != nil {
+						return nil, storageError(p.Context, err, "Could not create person.")
+					}
+					metrics.PersonsCreated.Inc()
+					return redact(p.Context, []models.Person{person})[0], nil
+				},
+			},
+			"updatePerson": &graphql.Field{
+				Type: graphql.NewNonNull(personType),
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(inputType)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := idArgument(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					person := personInput(p.Args)
+					if err := validatePerson("PersonUpdate", &person); err != nil {
+						return nil, err
+					}
+					person.ID = id
+					//Проверяем уникальность email с исключением текущего ID
+					if _, err := storage.CheckPersonByEmail(p.Context, person.Email, id); err == nil {
+						return nil, storageError(p.Context, database.ErrEmailExists, "")
+					} else if !errors.Is(err, database.ErrPersonNotFound) {
+						return nil, storageError(p.Context, err, "Could not update person.")
+					}
+					if err := storage.UpdatePerson(p.Context, &person); err != nil {
+						return nil, storageError(p.Context, err, "Could not update person.")
+					}
+					metrics.PersonsUpdated.Inc()
+					return redact(p.Context, []models.Person{person})[0], nil
+				},
+			},
+			"deletePerson": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := idArgument(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					//Проверяем наличие записи, чтобы вернуть NOT_FOUND
+					if _, err := storage.GetPerson(p.Context, id); err != nil {
+						return nil, storageError(p.Context, err, "Could not fetch the person.")
+					}
+					if err := storage.DeletePerson(p.Context, &models.Person{ID: id}); err != nil {
+						return nil, storageError(p.Context, err, "Could not delete person.")
+					}
+					metrics.PersonsDeleted.Inc()
+					return true, nil
+				},
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
@@ -0,0 +1,169 @@
+package grpcserver
+
+import (
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/metrics"
+	"WST_lab6_server/internal/middleware"
+	"WST_lab6_server/internal/tracing"
+	"WST_lab6_server/pkg/api/personsv1"
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Ключи метаданных (в gRPC имена заголовков в нижнем регистре)
+const (
+	authorizationKey = "authorization"
+	requestIDKey     = "x-request-id"
+)
+
+// Методы, изменяющие данные: как и в REST API, требуют учетных данных и роли editor или admin
+var writeMethods = map[string]bool{
+	personsv1.PersonService_Create_FullMethodName: true,
+	personsv1.PersonService_Update_FullMethodName: true,
+	personsv1.PersonService_Delete_FullMethodName: true,
+}
+
+// Ключ роли пользователя в контексте запроса
+type roleKey struct{}
+
+/*
+Функция получения роли пользователя текущего запроса
+*/
+func requestRole(ctx context.Context) string {
+	if role, ok := ctx.Value(roleKey{}).(string); ok {
+		return role
+	}
+	return middleware.AnonymousRole()
+}
+
+/*
+Функция проверки учетных данных Basic из метаданных authorization.
+Для методов чтения без учетных данных используется анонимная роль.
+*/
+func authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	values := metadata.ValueFromIncomingContext(ctx, authorizationKey)
+	if len(values) == 0 && !writeMethods[fullMethod] {
+		return context.WithValue(ctx, roleKey{}, middleware.AnonymousRole()), nil
+	}
+	//Спан охватывает только проверку учетных данных
+	_, span := tracing.Tracer().Start(ctx, "grpc.BasicAuth")
+	defer span.End()
+	fail := func(reason string, message string) error {
+		metrics.AuthFailures.WithLabelValues(reason).Inc()
+		span.SetStatus(otelcodes.Error, reason)
+		return status.Error(codes.Unauthenticated, message)
+	}
+	if len(values) == 0 {
+		return nil, fail("missing_header", "Authorization metadata is missing")
+	}
+	username, password, ok := middleware.ParseBasicAuth(values[0])
+	if !ok {
+		return nil, fail("invalid_format", "Invalid authorization format")
+	}
+	span.SetAttributes(attribute.String("enduser.id", username))
+	role, ok := middleware.Authenticate(ctx, username, password)
+	if !ok {
+		return nil, fail("invalid_credentials", "Invalid username or password")
+	}
+	span.SetAttributes(attribute.String("enduser.role", role))
+	if writeMethods[fullMethod] && !middleware.HasRole(role, middleware.WriteRoles...) {
+		metrics.AuthFailures.WithLabelValues("forbidden").Inc()
+		span.SetStatus(otelcodes.Error, "forbidden")
+		return nil, status.Error(codes.PermissionDenied, "Role "+role+" is not allowed to change persons")
+	}
+	logger := logging.FromContext(ctx).With(zap.String("user", username))
+	ctx = logging.WithContext(ctx, logger)
+	return context.WithValue(ctx, roleKey{}, role), nil
+}
+
+func authUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func authStreamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := authenticate(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+}
+
+/*
+Функция подготовки логгера запроса: идентификатор из x-request-id или новый,
+возвращается клиенту в заголовке ответа
+*/
+func withRequestLogger(ctx context.Context, fullMethod string) context.Context {
+	requestID := ""
+	if values := metadata.ValueFromIncomingContext(ctx, requestIDKey); len(values) > 0 {
+		requestID = values[0]
+	}
+	requestID = middleware.RequestID(requestID)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, requestID))
+	fields := []zap.Field{
+		zap.String("request_id", requestID),
+		zap.String("grpc_method", fullMethod),
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		fields = append(fields, zap.String("trace_id", spanContext.TraceID().String()))
+	}
+	return logging.WithContext(ctx, logging.Logger.With(fields...))
+}
+
+/*
+Функция записи строки журнала доступа
+*/
+func logAccess(ctx context.Context, start time.Time, err error) {
+	code := status.Code(err)
+	fields := []zap.Field{
+		zap.String("grpc_code", code.String()),
+		zap.Duration("latency", time.Since(start)),
+	}
+	logger := logging.FromContext(ctx)
+	switch code {
+	case codes.OK, codes.NotFound, codes.AlreadyExists, codes.InvalidArgument, codes.Unauthenticated, codes.PermissionDenied, codes.Canceled:
+		logger.Info("grpc request", fields...)
+	default:
+		logger.Error("grpc request", append(fields, zap.Error(err))...)
+	}
+}
+
+func loggingUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	ctx = withRequestLogger(ctx, info.FullMethod)
+	resp, err := handler(ctx, req)
+	logAccess(ctx, start, err)
+	return resp, err
+}
+
+func loggingStreamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx := withRequestLogger(stream.Context(), info.FullMethod)
+	err := handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	logAccess(ctx, start, err)
+	return err
+}
+
+/*
+Поток с замененным контекстом (логгер и роль запроса)
+*/
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
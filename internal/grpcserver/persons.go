@@ -0,0 +1,280 @@
+package grpcserver
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/database"
+	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/metrics"
+	"WST_lab6_server/internal/models"
+	"WST_lab6_server/internal/openapi"
+	"WST_lab6_server/internal/pii"
+	"WST_lab6_server/pkg/api/personsv1"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Размер страницы List и Search по умолчанию
+const (
+	defaultPageSize = 100
+	defaultMaxPage  = 1000
+)
+
+/*
+Реализация PersonService поверх того же хранилища, что и StorageHandler
+*/
+type PersonServer struct {
+	personsv1.UnimplementedPersonServiceServer
+	Storage *postgres.Storage
+}
+
+/*
+Функция преобразования ошибок пакета database в статусы gRPC
+*/
+func storageError(ctx context.Context, err error, message string) error {
+	switch {
+	case errors.Is(err, database.ErrPersonNotFound):
+		return status.Error(codes.NotFound, "Person not found.")
+	case errors.Is(err, database.ErrEmailExists):
+		return status.Error(codes.AlreadyExists, "Email already in use.")
+	case errors.Is(err, database.ErrInvalidInput), errors.Is(err, database.ErrEmptyQuery), errors.Is(err, database.ErrQueryTooLong):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, database.ErrQueryTimeout):
+		return status.Error(codes.DeadlineExceeded, "Database query timed out.")
+	case errors.Is(err, database.ErrUnavailable):
+		return status.Error(codes.Unavailable, "Database is unavailable.")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "Request canceled.")
+	}
+	logging.FromContext(ctx).Error("storage error", zap.Error(err))
+	return status.Error(codes.Internal, message)
+}
+
+/*
+Функция проверки записи по схеме документа OpenAPI (PersonCreate, PersonUpdate),
+нарушения возвращаются в деталях BadRequest
+*/
+func validatePerson(schema string, person *models.Person) error {
+	violations, err := openapi.ValidateSchema(schema, person)
+	if err != nil {
+		return status.Error(codes.Internal, "Request validation is unavailable.")
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	details := &errdetails.BadRequest{}
+	for _, violation := range violations {
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       strings.TrimPrefix(violation.Name, "/"),
+			Description: violation.Message,
+		})
+	}
+	st, err := status.New(codes.InvalidArgument, "Request does not match the API specification.").WithDetails(details)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "Request does not match the API specification.")
+	}
+	return st.Err()
+}
+
+func toModel(person *personsv1.Person) models.Person {
+	return models.Person{
+		ID:        uint(person.GetId()),
+		Name:      person.GetName(),
+		Surname:   person.GetSurname(),
+		Age:       int(person.GetAge()),
+		Email:     person.GetEmail(),
+		Telephone: person.GetTelephone(),
+	}
+}
+
+func fromModel(person *models.Person) *personsv1.Person {
+	return &personsv1.Person{
+		Id:        uint64(person.ID),
+		Name:      person.Name,
+		Surname:   person.Surname,
+		Age:       int32(person.Age),
+		Email:     person.Email,
+		Telephone: person.Telephone,
+	}
+}
+
+/*
+Функция подготовки записей к ответу со скрытием полей, недоступных роли
+*/
+func fromModels(ctx context.Context, persons []models.Person) []*personsv1.Person {
+	role := requestRole(ctx)
+	result := make([]*personsv1.Person, 0, len(persons))
+	for i := range persons {
+		pii.RedactPerson(&persons[i], role)
+		result = append(result, fromModel(&persons[i]))
+	}
+	return result
+}
+
+func (s *PersonServer) Get(ctx context.Context, req *personsv1.GetRequest) (*personsv1.GetResponse, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Person id is required.")
+	}
+	person, err := s.Storage.GetPerson(ctx, uint(req.GetId()))
+	if err != nil {
+		return nil, storageError(ctx, err, "Could not fetch person.")
+	}
+	pii.RedactPerson(person, requestRole(ctx))
+	return &personsv1.GetResponse{Person: fromModel(person)}, nil
+}
+
+/*
+Функция ограничения размера страницы по настройкам grpcServer
+*/
+func pageSize(size int32) int {
+	maxPage := config.GRPCServerSetting.MaxPageSize
+	if maxPage <= 0 {
+		maxPage = defaultMaxPage
+	}
+	limit := int(size)
+	if limit <= 0 {
+		limit = config.GRPCServerSetting.DefaultPageSize
+		if limit <= 0 {
+			limit = defaultPageSize
+		}
+	}
+	return min(limit, maxPage)
+}
+
+/*
+Функция чтения страницы записей по возрастанию id.
+Маркер страницы - id последней записи предыдущей страницы; возвращает маркер следующей страницы.
+*/
+func (s *PersonServer) page(ctx context.Context, query string, size int32, token string) ([]*personsv1.Person, string, error) {
+	var afterID uint64
+	if token != "" {
+		var err error
+		if afterID, err = strconv.ParseUint(token, 10, 64); err != nil {
+			return nil, "", status.Error(codes.InvalidArgument, "Invalid page token.")
+		}
+	}
+	limit := pageSize(size)
+	//Поля, скрытые от роли, в поиске не участвуют; лишняя запись показывает, что есть следующая страница
+	persons, err := s.Storage.SearchPerson(ctx, query, pii.HiddenFields(requestRole(ctx)), uint(afterID), limit+1)
+	if err != nil {
+		return nil, "", storageError(ctx, err, "Could not fetch persons. Try again later.")
+	}
+	next := ""
+	if len(persons) > limit {
+		persons = persons[:limit]
+		next = strconv.FormatUint(uint64(persons[limit-1].ID), 10)
+	}
+	return fromModels(ctx, persons), next, nil
+}
+
+/*
+Все записи постранично, без страниц - ListStream
+*/
+func (s *PersonServer) List(ctx context.Context, req *personsv1.ListRequest) (*personsv1.ListResponse, error) {
+	persons, next, err := s.page(ctx, "", req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	return &personsv1.ListResponse{Persons: persons, NextPageToken: next}, nil
+}
+
+/*
+Поиск по всем полям постранично. В отличие от REST API пустая выборка возвращается как пустой список.
+*/
+func (s *PersonServer) Search(ctx context.Context, req *personsv1.SearchRequest) (*personsv1.SearchResponse, error) {
+	if req.GetQuery() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Search query is required.")
+	}
+	persons, next, err := s.page(ctx, req.GetQuery(), req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	return &personsv1.SearchResponse{Persons: persons, NextPageToken: next}, nil
+}
+
+func (s *PersonServer) Create(ctx context.Context, req *personsv1.CreateRequest) (*personsv1.CreateResponse, error) {
+	if req.GetPerson() == nil {
+		return nil, status.Error(codes.InvalidArgument, "Person is required.")
+	}
+	if req.GetPerson().GetId() != 0 {
+		return nil, status.Error(codes.InvalidArgument, "Person id is assigned by the server.")
+	}
+	person := toModel(req.GetPerson())
+	if err := validatePerson("PersonCreate", &person); err != nil {
+		return nil, err
+	}
+	id, err := s.Storage.AddPerson(ctx, &person)
+	if err != nil {
+		return nil, storageError(ctx, err, "Could not create person.")
+	}
+	metrics.PersonsCreated.Inc()
+	return &personsv1.CreateResponse{Id: uint64(id)}, nil
+}
+
+func (s *PersonServer) Update(ctx context.Context, req *personsv1.UpdateRequest) (*personsv1.UpdateResponse, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Person id is required.")
+	}
+	if req.GetPerson() == nil {
+		return nil, status.Error(codes.InvalidArgument, "Person is required.")
+	}
+	person := toModel(req.GetPerson())
+	person.ID = 0
+	if err := validatePerson("PersonUpdate", &person); err != nil {
+		return nil, err
+	}
+	person.ID = uint(req.GetId())
+	//Проверяем уникальность email с исключением текущего ID
+	if _, err := s.Storage.CheckPersonByEmail(ctx, person.Email, person.ID); err == nil {
+		return nil, status.Error(codes.AlreadyExists, "Email already in use.")
+	} else if !errors.Is(err, database.ErrPersonNotFound) {
+		return nil, storageError(ctx, err, "Could not update person.")
+	}
+	if err := s.Storage.UpdatePerson(ctx, &person); err != nil {
+		return nil, storageError(ctx, err, "Could not update person.")
+	}
+	metrics.PersonsUpdated.Inc()
+	return &personsv1.UpdateResponse{}, nil
+}
+
+func (s *PersonServer) Delete(ctx context.Context, req *personsv1.DeleteRequest) (*personsv1.DeleteResponse, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Person id is required.")
+	}
+	//Проверяем наличие записи, чтобы вернуть NotFound
+	if _, err := s.Storage.GetPerson(ctx, uint(req.GetId())); err != nil {
+		return nil, storageError(ctx, err, "Could not fetch the person.")
+	}
+	if err := s.Storage.DeletePerson(ctx, &models.Person{ID: uint(req.GetId())}); err != nil {
+		return nil, storageError(ctx, err, "Could not delete person.")
+	}
+	metrics.PersonsDeleted.Inc()
+	return &personsv1.DeleteResponse{}, nil
+}
+
+/*
+Потоковая выдача: записи читаются порциями (EachPerson) и сразу отправляются клиенту
+*/
+func (s *PersonServer) ListStream(req *personsv1.ListStreamRequest, stream personsv1.PersonService_ListStreamServer) error {
+	ctx := stream.Context()
+	role := requestRole(ctx)
+	err := s.Storage.EachPerson(ctx, req.GetQuery(), pii.HiddenFields(role), func(person *models.Person) error {
+		pii.RedactPerson(person, role)
+		return stream.Send(&personsv1.ListStreamResponse{Person: fromModel(person)})
+	})
+	if err != nil {
+		//Ошибка отправки уже содержит статус gRPC
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return storageError(ctx, err, "Could not fetch persons. Try again later.")
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package grpcserver
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/pkg/api/personsv1"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+/*
+Функция создания gRPC сервера с сервисом PersonService.
+Трассировка, журнал запросов и аутентификация подключаются так же, как middleware REST API.
+*/
+func New(storage *postgres.Storage) *grpc.Server {
+	server := grpc.NewServer(
+		//Трассировка запросов (W3C traceparent в метаданных)
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(loggingUnaryInterceptor, authUnaryInterceptor),
+		grpc.ChainStreamInterceptor(loggingStreamInterceptor, authStreamInterceptor),
+	)
+	personsv1.RegisterPersonServiceServer(server, &PersonServer{Storage: storage})
+	if config.GRPCServerSetting.Reflection {
+		reflection.Register(server)
+	}
+	return server
+}
@@ -0,0 +1,278 @@
+package grpcserver
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/database"
+	"WST_lab6_server/internal/database/dbtest"
+	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/models"
+	"WST_lab6_server/pkg/api/personsv1"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	gormpostgres "gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+/*
+Функция настройки пользователей (пароль secret) и скрытия полей для роли viewer на время теста
+*/
+func setupAuth(t *testing.T) {
+	t.Helper()
+	logging.Logger = zap.NewNop()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedUsers, savedRole, savedRedaction := config.AuthSetting.Users, config.AuthSetting.AnonymousRole, config.PIISetting.Redaction
+	t.Cleanup(func() {
+		config.AuthSetting.Users, config.AuthSetting.AnonymousRole, config.PIISetting.Redaction = savedUsers, savedRole, savedRedaction
+	})
+	config.AuthSetting.Users = []config.UserConfig{
+		{Username: "viewer", PasswordHash: string(hash), Role: "viewer"},
+		{Username: "editor", PasswordHash: string(hash), Role: "editor"},
+	}
+	config.AuthSetting.AnonymousRole = "viewer"
+	config.PIISetting.Redaction = map[string][]string{"viewer": {"email", "telephone"}}
+}
+
+/*
+Функция запуска сервера в памяти (bufconn) и создания клиента к нему
+*/
+func newTestClient(t *testing.T, storage *postgres.Storage) personsv1.PersonServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := New(storage)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return personsv1.NewPersonServiceClient(conn)
+}
+
+/*
+Функция создания хранилища с тестовой базой данных и записями
+*/
+func newTestStorage(t *testing.T, count int) *postgres.Storage {
+	t.Helper()
+	storage := &postgres.Storage{DB: dbtest.Open(t, postgres.Tables...)}
+	for i := 1; i <= count; i++ {
+		person := &models.Person{Name: "Olga", Surname: fmt.Sprintf("Ditr%d", i), Age: 30 + i,
+			Email: fmt.Sprintf("olga%d@mail.com", i), Telephone: fmt.Sprintf("+7001123457%d", i%10)}
+		if _, err := storage.AddPerson(context.Background(), person); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return storage
+}
+
+/*
+Функция добавления учетных данных Basic в метаданные запроса
+*/
+func asUser(ctx context.Context, username, password string) context.Context {
+	credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return metadata.AppendToOutgoingContext(ctx, authorizationKey, "Basic "+credentials)
+}
+
+func TestWriteMethodsRequireRole(t *testing.T) {
+	setupAuth(t)
+	client := newTestClient(t, newTestStorage(t, 1))
+	person := &personsv1.Person{Name: "Ivan", Surname: "Ivanov", Age: 30, Email: "ivan@mail.com", Telephone: "+79990000001"}
+	background := context.Background()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		code codes.Code
+	}{
+		{"anonymous", background, codes.Unauthenticated},
+		{"wrong password", asUser(background, "editor", "wrong"), codes.Unauthenticated},
+		{"viewer", asUser(background, "viewer", "secret"), codes.PermissionDenied},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := client.Create(test.ctx, &personsv1.CreateRequest{Person: person})
+			if status.Code(err) != test.code {
+				t.Errorf("Create: %v, want %s", err, test.code)
+			}
+			_, err = client.Update(test.ctx, &personsv1.UpdateRequest{Id: 1, Person: person})
+			if status.Code(err) != test.code {
+				t.Errorf("Update: %v, want %s", err, test.code)
+			}
+			_, err = client.Delete(test.ctx, &personsv1.DeleteRequest{Id: 1})
+			if status.Code(err) != test.code {
+				t.Errorf("Delete: %v, want %s", err, test.code)
+			}
+		})
+	}
+	//Чтение доступно без учетных данных, запись - редактору
+	if _, err := client.Get(background, &personsv1.GetRequest{Id: 1}); err != nil {
+		t.Errorf("anonymous Get: %v", err)
+	}
+	editor := asUser(background, "editor", "secret")
+	created, err := client.Create(editor, &personsv1.CreateRequest{Person: person})
+	if err != nil {
+		t.Fatalf("editor Create: %v", err)
+	}
+	if _, err := client.Delete(editor, &personsv1.DeleteRequest{Id: created.GetId()}); err != nil {
+		t.Errorf("editor Delete: %v", err)
+	}
+}
+
+func TestStorageErrorCodes(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{database.ErrPersonNotFound, codes.NotFound},
+		{database.ErrEmailExists, codes.AlreadyExists},
+		{database.ErrQueryTooLong, codes.InvalidArgument},
+		{fmt.Errorf("%w: %w", database.ErrQueryTimeout, context.DeadlineExceeded), codes.DeadlineExceeded},
+		{fmt.Errorf("%w: connection refused", database.ErrUnavailable), codes.Unavailable},
+		{context.Canceled, codes.Canceled},
+		{errors.New("syntax error at or near"), codes.Internal},
+	}
+	for _, test := range tests {
+		err := storageError(context.Background(), test.err, "Could not fetch person.")
+		if status.Code(err) != test.code {
+			t.Errorf("%v: %v, want %s", test.err, err, test.code)
+		}
+	}
+	//Внутренняя ошибка не раскрывается клиенту
+	if err := storageError(context.Background(), errors.New("password=secret"), "Could not fetch person."); status.Convert(err).Message() != "Could not fetch person." {
+		t.Errorf("internal error message: %v", err)
+	}
+}
+
+func TestStorageErrorsOverGRPC(t *testing.T) {
+	setupAuth(t)
+	client := newTestClient(t, newTestStorage(t, 1))
+	if _, err := client.Get(context.Background(), &personsv1.GetRequest{Id: 42}); status.Code(err) != codes.NotFound {
+		t.Errorf("Get unknown id: %v", err)
+	}
+	//База данных недоступна (порт 1 не принимает соединения)
+	db, err := gorm.Open(gormpostgres.Open("host=127.0.0.1 port=1 user=test dbname=test sslmode=disable connect_timeout=5"), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = newTestClient(t, &postgres.Storage{DB: db})
+	if _, err := client.List(context.Background(), &personsv1.ListRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("List with unavailable database: %v", err)
+	}
+}
+
+func TestCreateValidatesSchema(t *testing.T) {
+	setupAuth(t)
+	client := newTestClient(t, newTestStorage(t, 0))
+	_, err := client.Create(asUser(context.Background(), "editor", "secret"), &personsv1.CreateRequest{
+		Person: &personsv1.Person{Name: "Ivan", Surname: "Ivanov", Age: -1, Email: "ivan", Telephone: "+79990000001"},
+	})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("Create: %v", err)
+	}
+	fields := map[string]bool{}
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, violation := range badRequest.GetFieldViolations() {
+				fields[violation.GetField()] = true
+			}
+		}
+	}
+	if len(fields) != 2 || !fields["age"] || !fields["email"] {
+		t.Errorf("field violations %v, want age and email", fields)
+	}
+}
+
+func TestListPagesAndRedaction(t *testing.T) {
+	setupAuth(t)
+	client := newTestClient(t, newTestStorage(t, 5))
+	var ids []uint64
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+		response, err := client.List(context.Background(), &personsv1.ListRequest{PageSize: 2, PageToken: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, person := range response.GetPersons() {
+			ids = append(ids, person.GetId())
+			//Анонимный пользователь (viewer) не видит email и телефон
+			if person.GetEmail() == fmt.Sprintf("olga%d@mail.com", person.GetId()) || person.GetTelephone() == "" {
+				t.Errorf("person not redacted: %v", person)
+			}
+		}
+		if token = response.GetNextPageToken(); token == "" {
+			break
+		}
+	}
+	if fmt.Sprint(ids) != "[1 2 3 4 5]" {
+		t.Errorf("ids %v", ids)
+	}
+	if _, err := client.List(context.Background(), &personsv1.ListRequest{PageToken: "abc"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("invalid token: %v", err)
+	}
+	response, err := client.List(asUser(context.Background(), "editor", "secret"), &personsv1.ListRequest{PageSize: 1})
+	if err != nil || response.GetPersons()[0].GetEmail() != "olga1@mail.com" {
+		t.Errorf("editor List: %v, %v", response, err)
+	}
+}
+
+/*
+Поток, отменяющий контекст после первой отправленной записи
+*/
+type cancelStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	cancel context.CancelFunc
+	sent   int
+}
+
+func (s *cancelStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *cancelStream) Send(*personsv1.ListStreamResponse) error {
+	s.sent++
+	s.cancel()
+	return nil
+}
+
+func TestListStreamCancel(t *testing.T) {
+	setupAuth(t)
+	saved := config.DatabaseSetting.StreamBatchSize
+	t.Cleanup(func() { config.DatabaseSetting.StreamBatchSize = saved })
+	config.DatabaseSetting.StreamBatchSize = 2
+	storage := newTestStorage(t, 5)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &cancelStream{ctx: ctx, cancel: cancel}
+	err := (&PersonServer{Storage: storage}).ListStream(&personsv1.ListStreamRequest{}, stream)
+	if status.Code(err) != codes.Canceled || stream.sent > 2 {
+		t.Errorf("ListStream: %v after %d records", err, stream.sent)
+	}
+}
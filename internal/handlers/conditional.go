@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/middleware"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+/*
+Функция проверки условного запроса к списку записей.
+ETag и Last-Modified строятся по маркеру изменений таблицы people, поэтому для ответа 304
+записи не читаются. ETag различается по формату, роли (скрытые поля) и строке поиска.
+Возвращает true, если отправлен ответ Not Modified (304).
+*/
+func (sh *StorageHandler) collectionNotModified(context *gin.Context, format string, searchString string) bool {
+	version, modified, err := sh.Storage.PersonsVersion(context.Request.Context())
+	if err != nil {
+		//Без маркера ответ отдается целиком и без валидаторов
+		logging.FromContext(context.Request.Context()).Warn("could not read persons version", zap.Error(err))
+		return false
+	}
+	variant := collectionVariant(format, middleware.RequestRole(context), searchString)
+	return notModified(context, collectionETag(version, variant), modified)
+}
+
+/*
+Функция варианта представления списка: ответы для разных форматов, ролей и запросов различаются
+*/
+func collectionVariant(format string, role string, searchString string) string {
+	return format + "\n" + role + "\n" + strings.TrimSpace(searchString)
+}
+
+/*
+Функция установки валидаторов ответа и проверки If-None-Match и If-Modified-Since.
+Возвращает true, если отправлен ответ Not Modified (304).
+*/
+func notModified(context *gin.Context, etag string, modified time.Time) bool {
+	context.Header("ETag", etag)
+	context.Writer.Header().Add("Vary", "Accept, Authorization")
+	if !modified.IsZero() {
+		context.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	//If-None-Match имеет приоритет над If-Modified-Since (RFC 9110)
+	if ifNoneMatch := context.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		if !etagMatches(ifNoneMatch, etag) {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(context.GetHeader("If-Modified-Since"))
+		//Last-Modified передается с точностью до секунды
+		if err != nil || modified.IsZero() || modified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+	context.Status(http.StatusNotModified)
+	return true
+}
+
+/*
+Функция построения слабого ETag: ответ может передаваться в сжатом виде
+*/
+func collectionETag(version uint64, variant string) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(variant))
+	return fmt.Sprintf(`W/"%d-%x"`, version, hash.Sum64())
+}
+
+/*
+Функция слабого сравнения ETag со списком из If-None-Match ("*" совпадает с любым)
+*/
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+Функция условного запроса к списку с маркером version и временем изменения modified
+*/
+func conditionalRequest(t *testing.T, etag string, modified time.Time, headers map[string]string) (*httptest.ResponseRecorder, bool) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(recorder)
+	context.Request = httptest.NewRequest(http.MethodGet, "/api/v1/persons/list", nil)
+	for name, value := range headers {
+		context.Request.Header.Set(name, value)
+	}
+	result := notModified(context, etag, modified)
+	context.Writer.WriteHeaderNow()
+	return recorder, result
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2026, 3, 1, 12, 0, 0, 500_000_000, time.UTC)
+	etag := collectionETag(12, collectionVariant(mimeJSON, "admin", ""))
+	lastModified := modified.Format(http.TimeFormat)
+	earlier := modified.Add(-time.Hour).Format(http.TimeFormat)
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected bool
+	}{
+		{"no validators", nil, false},
+		{"matching ETag", map[string]string{"If-None-Match": etag}, true},
+		{"strong form of weak ETag", map[string]string{"If-None-Match": etag[2:]}, true},
+		{"ETag in list", map[string]string{"If-None-Match": `W/"1-0", ` + etag}, true},
+		{"wildcard", map[string]string{"If-None-Match": "*"}, true},
+		{"other ETag", map[string]string{"If-None-Match": `W/"11-0"`}, false},
+		{"same second as Last-Modified", map[string]string{"If-Modified-Since": lastModified}, true},
+		{"modified since", map[string]string{"If-Modified-Since": earlier}, false},
+		{"invalid date", map[string]string{"If-Modified-Since": "yesterday"}, false},
+		//If-None-Match имеет приоритет: несовпадающий ETag отменяет совпадающую дату
+		{"If-None-Match wins over date", map[string]string{"If-None-Match": `W/"11-0"`, "If-Modified-Since": lastModified}, false},
+		{"If-None-Match wins over old date", map[string]string{"If-None-Match": etag, "If-Modified-Since": earlier}, true},
+	}
+	for _, test := range tests {
+		recorder, result := conditionalRequest(t, etag, modified, test.headers)
+		if result != test.expected {
+			t.Errorf("%s: notModified = %v", test.name, result)
+		}
+		if test.expected && recorder.Code != http.StatusNotModified {
+			t.Errorf("%s: status %d", test.name, recorder.Code)
+		}
+		if recorder.Header().Get("ETag") != etag || recorder.Header().Get("Last-Modified") != lastModified ||
+			recorder.Header().Get("Vary") != "Accept, Authorization" {
+			t.Errorf("%s: validators %v", test.name, recorder.Header())
+		}
+	}
+	//Таблица еще не изменялась: без Last-Modified и без ответа 304 по дате
+	recorder, result := conditionalRequest(t, etag, time.Time{}, map[string]string{"If-Modified-Since": lastModified})
+	if result || recorder.Header().Get("Last-Modified") != "" {
+		t.Errorf("zero time: notModified = %v, headers %v", result, recorder.Header())
+	}
+}
+
+func TestCollectionETagVariants(t *testing.T) {
+	base := collectionETag(3, collectionVariant(mimeJSON, "viewer", "Ivan"))
+	if base[:2] != `W/` {
+		t.Errorf("ETag %s is not weak", base)
+	}
+	if other := collectionETag(3, collectionVariant(mimeJSON, "viewer", " Ivan ")); other != base {
+		t.Error("surrounding spaces of the query change the ETag")
+	}
+	for name, etag := range map[string]string{
+		"role":    collectionETag(3, collectionVariant(mimeJSON, "admin", "Ivan")),
+		"format":  collectionETag(3, collectionVariant(mimeCSV, "viewer", "Ivan")),
+		"query":   collectionETag(3, collectionVariant(mimeJSON, "viewer", "Petr")),
+		"version": collectionETag(4, collectionVariant(mimeJSON, "viewer", "Ivan")),
+	} {
+		if etag == base {
+			t.Errorf("ETag does not depend on %s", name)
+		}
+	}
+	//Ответ, сохраненный для одной роли, не подходит другой роли
+	if etagMatches(base, collectionETag(3, collectionVariant(mimeJSON, "admin", "Ivan"))) {
+		t.Error("viewer ETag matches admin representation")
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"WST_lab6_server/internal/middleware"
+	"WST_lab6_server/internal/models"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Замена специальных символов в JSON Pointer (RFC 6901)
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+/*
+Функция строгого разбора тела запроса в формате JSON.
+В отличие от ShouldBindJSON отклоняет неизвестные поля, повторяющиеся ключи и данные после значения,
+forbidden - поля верхнего уровня (в нижнем регистре), которые клиент передавать не должен, и описание нарушения.
+При ошибке отправляет Bad Request (400) или Payload Too Large (413) в формате application/problem+json
+с указанием полей и возвращает false.
+*/
+func bindStrictJSON(context *gin.Context, value any, forbidden map[string]string) bool {
+	data, err := io.ReadAll(context.Request.Body)
+	if err != nil {
+		if !middleware.AbortIfBodyTooLarge(context, err) {
+			middleware.AbortWithProblem(context, http.StatusBadRequest, "Could not read request body.")
+		}
+		return false
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		abortWithBodyViolations(context, models.Violation{In: "body", Message: "request body is empty"})
+		return false
+	}
+	scanner := &keyScanner{decoder: json.NewDecoder(bytes.NewReader(data)), forbidden: forbidden}
+	if err := scanner.scan(); err != nil {
+		abortWithBodyViolations(context, syntaxViolation(err))
+		return false
+	}
+	if len(scanner.violations) > 0 {
+		abortWithBodyViolations(context, scanner.violations...)
+		return false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		abortWithBodyViolations(context, decodeViolation(err))
+		return false
+	}
+	return true
+}
+
+func abortWithBodyViolations(context *gin.Context, violations ...models.Violation) {
+	middleware.AbortWithViolations(context, http.StatusBadRequest, "Request body is not valid.", violations)
+}
+
+/*
+Проверка ключей объектов по потоку токенов: повторы (без учета регистра, как сопоставляет поля
+encoding/json) и запрещенные поля верхнего уровня
+*/
+type keyScanner struct {
+	decoder    *json.Decoder
+	forbidden  map[string]string
+	violations []models.Violation
+}
+
+/*
+Метод проверки всего тела: одно значение JSON без данных после него
+*/
+func (s *keyScanner) scan() error {
+	if err := s.value(""); err != nil {
+		return err
+	}
+	if _, err := s.decoder.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+func (s *keyScanner) value(pointer string) error {
+	token, err := s.decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch token {
+	case json.Delim('{'):
+		seen := map[string]bool{}
+		for s.decoder.More() {
+			token, err := s.decoder.Token()
+			if err != nil {
+				return err
+			}
+			key := token.(string)
+			path := pointer + "/" + pointerEscaper.Replace(key)
+			if seen[strings.ToLower(key)] {
+				s.violations = append(s.violations, models.Violation{In: "body", Name: path, Message: "duplicate key"})
+			}
+			seen[strings.ToLower(key)] = true
+			if message, ok := s.forbidden[strings.ToLower(key)]; ok && pointer == "" {
+				s.violations = append(s.violations, models.Violation{In: "body", Name: path, Message: message})
+			}
+			if err := s.value(path); err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		for i := 0; s.decoder.More(); i++ {
+			if err := s.value(pointer + "/" + strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+	//Закрывающая скобка объекта или массива
+	_, err = s.decoder.Token()
+	return err
+}
+
+// Ошибка данных после значения JSON
+var errTrailingData = errors.New("unexpected data after the JSON value")
+
+/*
+Функция описания синтаксической ошибки с позицией в теле
+*/
+func syntaxViolation(err error) models.Violation {
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return models.Violation{In: "body", Message: fmt.Sprintf("%s at offset %d", syntaxErr.Error(), syntaxErr.Offset)}
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return models.Violation{In: "body", Message: "unexpected end of JSON input"}
+	}
+	return models.Violation{In: "body", Message: err.Error()}
+}
+
+/*
+Функция описания ошибки разбора в структуру: неизвестное поле или неверный тип значения
+*/
+func decodeViolation(err error) models.Violation {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		name := ""
+		if typeErr.Field != "" {
+			name = "/" + strings.ReplaceAll(typeErr.Field, ".", "/")
+		}
+		return models.Violation{In: "body", Name: name, Message: fmt.Sprintf("expected %s, got %s", typeErr.Type.Kind(), typeErr.Value)}
+	}
+	//encoding/json не выделяет неизвестные поля в отдельный тип ошибки
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if unquoted, err := strconv.Unquote(field); err == nil {
+			field = unquoted
+		}
+		return models.Violation{In: "body", Name: "/" + pointerEscaper.Replace(field), Message: "unknown field"}
+	}
+	return models.Violation{In: "body", Message: err.Error()}
+}
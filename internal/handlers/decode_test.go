@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/middleware"
+	"WST_lab6_server/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+Функция разбора тела запроса bindStrictJSON: статус и нарушения из ответа
+*/
+func bindBody(t *testing.T, body string, forbidden map[string]string) (int, models.Person, []models.Violation) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(middleware.BodyLimitMiddleware())
+	var person models.Person
+	engine.POST("/persons", func(context *gin.Context) {
+		if bindStrictJSON(context, &person, forbidden) {
+			context.Status(http.StatusNoContent)
+		}
+	})
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/persons", strings.NewReader(body)))
+	var problem models.ErrorResponse
+	if recorder.Code != http.StatusNoContent {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("response is not a problem: %s", recorder.Body)
+		}
+	}
+	return recorder.Code, person, problem.Errors
+}
+
+func TestBindStrictJSON(t *testing.T) {
+	forbidden := map[string]string{"id": "id is assigned by the server"}
+	tests := []struct {
+		name    string
+		body    string
+		pointer string
+		message string
+	}{
+		{"unknown field", `{"name":"Ivan","telefone":"+79990000000"}`, "/telefone", "unknown field"},
+		{"duplicate key", `{"name":"Ivan","name":"Petr"}`, "/name", "duplicate key"},
+		{"case-folded duplicate", `{"email":"a@b.ru","Email":"c@d.ru"}`, "/Email", "duplicate key"},
+		{"forbidden key", `{"id":5,"name":"Ivan"}`, "/id", "id is assigned by the server"},
+		{"case-folded forbidden key", `{"ID":5}`, "/ID", "id is assigned by the server"},
+		{"pointer escaping", `{"a/b":1,"a/b":2}`, "/a~1b", "duplicate key"},
+		{"trailing data", `{"name":"Ivan"} {"name":"Petr"}`, "", "unexpected data after the JSON value"},
+		{"trailing garbage", `{"name":"Ivan"}]`, "", "unexpected data after the JSON value"},
+		{"wrong type", `{"age":"old"}`, "/age", "expected int, got string"},
+		{"truncated", `{"name":`, "", "unexpected end of JSON input"},
+		{"empty", ` `, "", "request body is empty"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, _, violations := bindBody(t, test.body, forbidden)
+			if status != http.StatusBadRequest || len(violations) != 1 {
+				t.Fatalf("status %d, violations %+v", status, violations)
+			}
+			if violations[0].Name != test.pointer || violations[0].Message != test.message {
+				t.Errorf("violation %+v, want %s: %s", violations[0], test.pointer, test.message)
+			}
+		})
+	}
+}
+
+func TestBindStrictJSONNested(t *testing.T) {
+	//Повторы ищутся во вложенных объектах, запрещенные поля - только на верхнем уровне
+	var value struct {
+		Items []map[string]int `json:"items"`
+	}
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/", func(context *gin.Context) {
+		if bindStrictJSON(context, &value, map[string]string{"id": "forbidden"}) {
+			context.Status(http.StatusNoContent)
+		}
+	})
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"items":[{"id":1},{"a":1,"a":2}]}`)))
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), `"name":"/items/1/a"`) ||
+		strings.Contains(recorder.Body.String(), "forbidden") {
+		t.Fatalf("status %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestBindStrictJSONValid(t *testing.T) {
+	status, person, _ := bindBody(t, `{"name":"Ivan","surname":"Ivanov","age":30}`, map[string]string{"id": "forbidden"})
+	if status != http.StatusNoContent || person.Name != "Ivan" || person.Age != 30 {
+		t.Fatalf("status %d, person %+v", status, person)
+	}
+}
+
+func TestBindStrictJSONTooLarge(t *testing.T) {
+	saved := config.HTTPServerSetting.BodyLimits
+	t.Cleanup(func() { config.HTTPServerSetting.BodyLimits = saved })
+	config.HTTPServerSetting.BodyLimits = map[string]int64{"/persons": 32}
+	body := `{"name":"` + strings.Repeat("a", 64) + `"}`
+	if status, _, _ := bindBody(t, body, nil); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("with Content-Length: status %d", status)
+	}
+	//Тело без Content-Length ограничивается при чтении
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(middleware.BodyLimitMiddleware())
+	engine.POST("/persons", func(context *gin.Context) {
+		var person models.Person
+		if bindStrictJSON(context, &person, nil) {
+			context.Status(http.StatusNoContent)
+		}
+	})
+	request := httptest.NewRequest(http.MethodPost, "/persons", strings.NewReader(body))
+	request.ContentLength = -1
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusRequestEntityTooLarge || !strings.Contains(recorder.Body.String(), "32 bytes") {
+		t.Errorf("chunked: status %d: %s", recorder.Code, recorder.Body)
+	}
+}
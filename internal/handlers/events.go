@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/events"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/metrics"
+	"WST_lab6_server/internal/middleware"
+	"WST_lab6_server/internal/pii"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// Параметры ленты изменений по умолчанию
+const (
+	defaultHeartbeatInterval = 15 * time.Second
+	//Пауза перед переподключением EventSource (поле retry)
+	eventsRetry = 3 * time.Second
+	//Ограничение времени отправки одного сообщения WebSocket
+	websocketWriteTimeout = 10 * time.Second
+)
+
+// Проверка Origin по умолчанию: WebSocket только с того же хоста
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 4096}
+
+/*
+Функция получения интервала поддержания соединения
+*/
+func heartbeatInterval() time.Duration {
+	if config.EventsSetting.HeartbeatInterval > 0 {
+		return config.EventsSetting.HeartbeatInterval
+	}
+	return defaultHeartbeatInterval
+}
+
+/*
+Метод подписки на ленту изменений по параметрам запроса:
+type (created,updated,deleted), personId и место продолжения (Last-Event-ID или ?lastEventId=).
+При ошибке ответ уже отправлен.
+*/
+func (sh *StorageHandler) subscribe(context *gin.Context) (*events.Subscription, []events.Event, bool, bool) {
+	if sh.Storage.Events == nil {
+		middleware.AbortWithProblem(context, http.StatusServiceUnavailable, "Change feed is disabled.")
+		return nil, nil, false, false
+	}
+	var filter events.Filter
+	types, ok := events.ParseTypes(context.Query("type"))
+	if !ok {
+		middleware.AbortWithProblem(context, http.StatusBadRequest, "Unknown event type.")
+		return nil, nil, false, false
+	}
+	filter.Types = types
+	if value := context.Query("personId"); value != "" {
+		personID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			middleware.AbortWithProblem(context, http.StatusBadRequest, "Could not parse personId.")
+			return nil, nil, false, false
+		}
+		filter.PersonID = uint(personID)
+	}
+	//Заголовок отправляет EventSource при переподключении, параметр - для WebSocket
+	lastEventID := context.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = context.Query("lastEventId")
+	}
+	var resumeFrom uint64
+	if lastEventID != "" {
+		var err error
+		if resumeFrom, err = strconv.ParseUint(lastEventID, 10, 64); err != nil {
+			middleware.AbortWithProblem(context, http.StatusBadRequest, "Could not parse Last-Event-ID.")
+			return nil, nil, false, false
+		}
+	}
+	subscription, replay, complete := sh.Storage.Events.Subscribe(filter, lastEventID != "", resumeFrom)
+	return subscription, replay, complete, true
+}
+
+/*
+Функция подготовки события к отправке со скрытием полей, недоступных роли
+*/
+func redactEvent(event events.Event, role string) events.Event {
+	if event.Person != nil {
+		person := *event.Person
+		pii.RedactPerson(&person, role)
+		event.Person = &person
+	}
+	return event
+}
+
+/*
+Метод обработки запроса на ленту изменений в формате Server-Sent Events
+*/
+func (sh *StorageHandler) PersonEventsHandler(context *gin.Context) {
+	subscription, replay, complete, ok := sh.subscribe(context)
+	if !ok {
+		return
+	}
+	defer sh.Storage.Events.Unsubscribe(subscription)
+	metrics.EventSubscribers.WithLabelValues("sse").Inc()
+	defer metrics.EventSubscribers.WithLabelValues("sse").Dec()
+	logger := logging.FromContext(context.Request.Context())
+	role := middleware.RequestRole(context)
+
+	//Поток не ограничивается WriteTimeout сервера
+	_ = http.NewResponseController(context.Writer).SetWriteDeadline(time.Time{})
+	context.Header("Content-Type", "text/event-stream")
+	context.Header("Cache-Control", "no-cache")
+	context.Header("Connection", "keep-alive")
+	//Отключаем буферизацию ответа в nginx
+	context.Header("X-Accel-Buffering", "no")
+	context.Status(http.StatusOK)
+
+	write := func(event events.Event) error {
+		data, err := json.Marshal(redactEvent(event, role))
+		if err != nil {
+			return err
+		}
+		if event.Type == events.TypeReset {
+			_, err = fmt.Fprintf(context.Writer, "event: %s\ndata: %s\n\n", event.Type, data)
+			return err
+		}
+		_, err = fmt.Fprintf(context.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		return err
+	}
+	if _, err := fmt.Fprintf(context.Writer, "retry: %d\n\n", eventsRetry.Milliseconds()); err != nil {
+		return
+	}
+	if !complete {
+		if err := write(events.Event{Type: events.TypeReset, Time: time.Now().UTC()}); err != nil {
+			return
+		}
+	}
+	for _, event := range replay {
+		if err := write(event); err != nil {
+			return
+		}
+	}
+	context.Writer.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval())
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-context.Request.Context().Done():
+			return
+		case event, open := <-subscription.C:
+			if !open {
+				if subscription.Dropped() {
+					logger.Warn("event subscriber dropped: queue is full")
+				}
+				return
+			}
+			if err := write(event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(context.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		context.Writer.Flush()
+	}
+}
+
+/*
+Метод обработки запроса на ленту изменений через WebSocket.
+Сообщения - события в JSON, параметры подписки те же, что и у SSE.
+*/
+func (sh *StorageHandler) PersonEventsWebSocketHandler(context *gin.Context) {
+	//Подписка до установки соединения, чтобы ошибки параметров вернулись как HTTP ответ
+	subscription, replay, complete, ok := sh.subscribe(context)
+	if !ok {
+		return
+	}
+	defer sh.Storage.Events.Unsubscribe(subscription)
+	conn, err := upgrader.Upgrade(context.Writer, context.Request, nil)
+	if err != nil {
+		//Upgrader уже ответил клиенту
+		return
+	}
+	defer conn.Close()
+	metrics.EventSubscribers.WithLabelValues("websocket").Inc()
+	defer metrics.EventSubscribers.WithLabelValues("websocket").Dec()
+	logger := logging.FromContext(context.Request.Context())
+	role := middleware.RequestRole(context)
+	interval := heartbeatInterval()
+
+	//Клиент ничего не отправляет: чтение нужно для обработки pong и закрытия соединения
+	closed := make(chan struct{})
+	conn.SetReadLimit(512)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * interval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * interval))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(event events.Event) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+		return conn.WriteJSON(redactEvent(event, role))
+	}
+	closeWith := func(code int, text string) {
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(websocketWriteTimeout))
+	}
+	if !complete {
+		if err := send(events.Event{Type: events.TypeReset, Time: time.Now().UTC()}); err != nil {
+			return
+		}
+	}
+	for _, event := range replay {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case event, open := <-subscription.C:
+			if !open {
+				if subscription.Dropped() {
+					logger.Warn("event subscriber dropped: queue is full")
+					closeWith(websocket.CloseTryAgainLater, "event queue overflow")
+					return
+				}
+				closeWith(websocket.CloseGoingAway, "server shutting down")
+				return
+			}
+			if err := send(event); err != nil {
+				logger.Debug("websocket send failed", zap.Error(err))
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(websocketWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package handlers
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/middleware"
+	"WST_lab6_server/internal/models"
+	"WST_lab6_server/internal/pii"
+	"bufio"
+	gocontext "context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+MIME типы поддерживаемых форматов выгрузки
+*/
+const (
+	mimeJSON   = "application/json"
+	mimeCSV    = "text/csv"
+	mimeXLSX   = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	mimeNDJSON = "application/x-ndjson"
+	mimeYAML   = "application/yaml"
+)
+
+// Значения параметра ?format= и соответствующие им MIME типы
+var exportFormats = map[string]string{
+	"json":   mimeJSON,
+	"csv":    mimeCSV,
+	"xlsx":   mimeXLSX,
+	"ndjson": mimeNDJSON,
+	"jsonl":  mimeNDJSON,
+	"yaml":   mimeYAML,
+	"yml":    mimeYAML,
+}
+
+// Альтернативные MIME типы из заголовка Accept
+var mimeAliases = map[string]string{
+	"application/jsonl":  mimeNDJSON,
+	"application/x-yaml": mimeYAML,
+	"text/yaml":          mimeYAML,
+}
+
+// Расширения файлов для заголовка Content-Disposition
+var exportExtensions = map[string]string{
+	mimeCSV:    "csv",
+	mimeXLSX:   "xlsx",
+	mimeNDJSON: "ndjson",
+	mimeYAML:   "yaml",
+}
+
+// Заголовок таблицы для CSV и XLSX
+var exportColumns = []string{"id", "name", "surname", "age", "email", "telephone"}
+
+// Символы, с которых табличные редакторы начинают формулу
+const formulaPrefixes = "=+-@\t\r"
+
+// Десятичное число со знаком: единственный вид значения с + или - в начале, который не экранируется
+var plainNumber = regexp.MustCompile(`^[+-]?\d+(\.\d+)?$`)
+
+// Наибольшее количество строк XLSX по умолчанию
+const defaultMaxXLSXRows = 100000
+
+// Ошибка превышения httpServer.maxXLSXRows
+var errTooManyRows = errors.New("too many rows for xlsx export")
+
+/*
+Функция определения формата ответа по параметру ?format= или заголовку Accept.
+Возвращает пустую строку если формат не поддерживается.
+*/
+func exportFormat(context *gin.Context) string {
+	//Параметр запроса имеет приоритет над заголовком
+	if format := context.Query("format"); format != "" {
+		return exportFormats[strings.ToLower(format)]
+	}
+	if context.GetHeader("Accept") == "" {
+		return mimeJSON
+	}
+	format := context.NegotiateFormat(mimeJSON, mimeCSV, mimeXLSX, mimeNDJSON, mimeYAML,
+		"application/jsonl", "application/x-yaml", "text/yaml")
+	if alias, ok := mimeAliases[format]; ok {
+		return alias
+	}
+	return format
+}
+
+/*
+Интерфейс построчной записи данных в тело ответа.
+Close завершает документ, Release освобождает ресурсы записи (временные файлы XLSX);
+Release вызывается всегда, в том числе после ошибки или отключения клиента, и допускает повторный вызов.
+*/
+type personWriter interface {
+	Write(person *models.Person) error
+	Close() error
+	Release()
+}
+
+/*
+Функция создания записи для выбранного формата
+*/
+func newPersonWriter(format string, w io.Writer) personWriter {
+	switch format {
+	case mimeJSON:
+		buf := bufio.NewWriter(w)
+		return &jsonPersonWriter{buf: buf, enc: json.NewEncoder(buf)}
+	case mimeCSV:
+		return &csvPersonWriter{w: csv.NewWriter(w)}
+	case mimeXLSX:
+		return &xlsxPersonWriter{w: w, maxRows: maxXLSXRows()}
+	case mimeNDJSON:
+		buf := bufio.NewWriter(w)
+		return &ndjsonPersonWriter{buf: buf, enc: json.NewEncoder(buf)}
+	case mimeYAML:
+		return &yamlPersonWriter{buf: bufio.NewWriter(w)}
+	}
+	return nil
+}
+
+/*
+Функция получения ограничения количества строк XLSX
+*/
+func maxXLSXRows() int {
+	if config.HTTPServerSetting.MaxXLSXRows > 0 {
+		return config.HTTPServerSetting.MaxXLSXRows
+	}
+	return defaultMaxXLSXRows
+}
+
+/*
+Метод потоковой выдачи записей в выбранном формате.
+Записи читаются из базы данных порциями и сразу пишутся в ответ,
+при notFoundOnEmpty пустая выборка возвращается как Not Found (404).
+*/
+func (sh *StorageHandler) streamPersons(context *gin.Context, format string, searchString string, notFoundOnEmpty bool) {
+	//Список не изменился с прошлого запроса клиента
+	if sh.collectionNotModified(context, format, searchString) {
+		return
+	}
+	writer := newPersonWriter(format, context.Writer)
+	defer writer.Release()
+	//Заголовки будут отправлены вместе с первой порцией данных
+	context.Header("Content-Type", format)
+	if extension, ok := exportExtensions[format]; ok {
+		context.Header("Content-Disposition", fmt.Sprintf("attachment; filename=persons.%s", extension))
+	}
+	context.Status(http.StatusOK)
+	role := middleware.RequestRole(context)
+	count := 0
+	//Поля, скрытые от роли, в поиске не участвуют
+	err := sh.Storage.EachPerson(context.Request.Context(), searchString, pii.HiddenFields(role), func(person *models.Person) error {
+		count++
+		//Скрываем поля, недоступные роли пользователя
+		pii.RedactPerson(person, role)
+		return writer.Write(person)
+	})
+	if err == nil && count == 0 && notFoundOnEmpty {
+		resetStreamHeaders(context)
+		context.JSON(http.StatusNotFound, gin.H{
+			"code":    "not_found",
+			"message": fmt.Sprintf("Person for '%s' request was not found.", searchString),
+		})
+		return
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		//Клиент отключился, дописывать ответ некому
+		if errors.Is(err, gocontext.Canceled) {
+			logging.FromContext(context.Request.Context()).Info("stream canceled by client", zap.String("format", format), zap.Int("sent", count))
+			context.Abort()
+			return
+		}
+		//Книга XLSX не отправляется до Close, поэтому ответ еще можно заменить
+		if errors.Is(err, errTooManyRows) {
+			resetStreamHeaders(context)
+			context.JSON(http.StatusNotAcceptable, gin.H{
+				"message": fmt.Sprintf("xlsx export is limited to %d rows, use csv or ndjson.", maxXLSXRows()),
+			})
+			return
+		}
+		//Если данные еще не отправлены, возвращаем статус 5xx и сообщение об ошибке
+		if !context.Writer.Written() {
+			resetStreamHeaders(context)
+			storageError(context, err, "Could not fetch persons. Try again later.")
+			return
+		}
+		//Иначе прерываем передачу
+		logging.FromContext(context.Request.Context()).Error("stream failed", zap.String("format", format), zap.Error(err))
+		context.Abort()
+	}
+}
+
+/*
+Функция сброса заголовков потоковой выдачи перед ответом с ошибкой
+*/
+func resetStreamHeaders(context *gin.Context) {
+	context.Writer.Header().Del("Content-Type")
+	context.Writer.Header().Del("Content-Disposition")
+	context.Writer.Header().Del("ETag")
+	context.Writer.Header().Del("Last-Modified")
+}
+
+/*
+Функция преобразования записи в строку таблицы CSV
+*/
+func personRecord(person *models.Person) []string {
+	return []string{
+		strconv.FormatUint(uint64(person.ID), 10),
+		escapeFormula(person.Name),
+		escapeFormula(person.Surname),
+		strconv.Itoa(person.Age),
+		escapeFormula(person.Email),
+		escapeFormula(person.Telephone),
+	}
+}
+
+/*
+Функция защиты значения ячейки от выполнения как формулы при открытии в табличном редакторе (CSV injection):
+к строке, начинающейся с =, +, -, @, табуляции или перевода строки, добавляется апостроф.
+Десятичные числа (например телефон +79990000000) формулой не являются и не изменяются,
+остальной текст (-Inf, +NaN, -0x1p-2) экранируется.
+*/
+func escapeFormula(value string) string {
+	if value == "" || !strings.ContainsRune(formulaPrefixes, rune(value[0])) {
+		return value
+	}
+	if plainNumber.MatchString(value) {
+		return value
+	}
+	return "'" + value
+}
+
+/*
+Запись в формате CSV
+*/
+type csvPersonWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (cw *csvPersonWriter) writeHeader() error {
+	if cw.header {
+		return nil
+	}
+	cw.header = true
+	return cw.w.Write(exportColumns)
+}
+
+func (cw *csvPersonWriter) Write(person *models.Person) error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	return cw.w.Write(personRecord(person))
+}
+
+func (cw *csvPersonWriter) Close() error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvPersonWriter) Release() {}
+
+/*
+Запись в формате JSON (массив, элементы пишутся по мере чтения)
+*/
+type jsonPersonWriter struct {
+	buf   *bufio.Writer
+	enc   *json.Encoder
+	count int
+}
+
+func (jw *jsonPersonWriter) Write(person *models.Person) error {
+	separator := ","
+	if jw.count == 0 {
+		separator = "["
+	}
+	jw.count++
+	if _, err := jw.buf.WriteString(separator); err != nil {
+		return err
+	}
+	return jw.enc.Encode(person)
+}
+
+func (jw *jsonPersonWriter) Close() error {
+	closing := "]"
+	if jw.count == 0 {
+		closing = "[]"
+	}
+	if _, err := jw.buf.WriteString(closing); err != nil {
+		return err
+	}
+	return jw.buf.Flush()
+}
+
+func (jw *jsonPersonWriter) Release() {}
+
+/*
+Запись в формате JSON Lines (одна запись на строку)
+*/
+type ndjsonPersonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func (nw *ndjsonPersonWriter) Write(person *models.Person) error {
+	return nw.enc.Encode(person)
+}
+
+func (nw *ndjsonPersonWriter) Close() error {
+	return nw.buf.Flush()
+}
+
+func (nw *ndjsonPersonWriter) Release() {}
+
+/*
+Запись в формате YAML (последовательность записей)
+*/
+type yamlPersonWriter struct {
+	buf   *bufio.Writer
+	count int
+}
+
+func (yw *yamlPersonWriter) Write(person *models.Person) error {
+	//Каждая запись кодируется как элемент последовательности
+	data, err := yaml.Marshal([]*models.Person{person})
+	if err != nil {
+		return err
+	}
+	yw.count++
+	_, err = yw.buf.Write(data)
+	return err
+}
+
+func (yw *yamlPersonWriter) Close() error {
+	//Пустая выборка - пустая последовательность
+	if yw.count == 0 {
+		if _, err := yw.buf.WriteString("[]\n"); err != nil {
+			return err
+		}
+	}
+	return yw.buf.Flush()
+}
+
+func (yw *yamlPersonWriter) Release() {}
+
+/*
+Запись в формате XLSX.
+Строки пишутся через excelize.StreamWriter, при большом объеме excelize сбрасывает их во временный файл,
+который удаляется в Release. Архив книги собирается и отправляется только в Close,
+поэтому количество строк ограничено maxRows (httpServer.maxXLSXRows).
+id и возраст записываются числами, остальные поля - строками.
+*/
+type xlsxPersonWriter struct {
+	w       io.Writer
+	file    *excelize.File
+	stream  *excelize.StreamWriter
+	row     int
+	maxRows int
+}
+
+func (xw *xlsxPersonWriter) open() error {
+	if xw.stream != nil {
+		return nil
+	}
+	xw.file = excelize.NewFile()
+	stream, err := xw.file.NewStreamWriter("Sheet1")
+	if err != nil {
+		return err
+	}
+	xw.stream = stream
+	header := make([]interface{}, len(exportColumns))
+	for i, column := range exportColumns {
+		header[i] = column
+	}
+	return xw.setRow(header)
+}
+
+func (xw *xlsxPersonWriter) setRow(row []interface{}) error {
+	xw.row++
+	cell, err := excelize.CoordinatesToCellName(1, xw.row)
+	if err != nil {
+		return err
+	}
+	return xw.stream.SetRow(cell, row)
+}
+
+func (xw *xlsxPersonWriter) Write(person *models.Person) error {
+	if err := xw.open(); err != nil {
+		return err
+	}
+	//Первая строка - заголовок
+	if xw.row > xw.maxRows {
+		return errTooManyRows
+	}
+	return xw.setRow([]interface{}{
+		person.ID,
+		escapeFormula(person.Name),
+		escapeFormula(person.Surname),
+		person.Age,
+		escapeFormula(person.Email),
+		escapeFormula(person.Telephone),
+	})
+}
+
+func (xw *xlsxPersonWriter) Close() error {
+	if err := xw.open(); err != nil {
+		return err
+	}
+	defer xw.Release()
+	if err := xw.stream.Flush(); err != nil {
+		return err
+	}
+	_, err := xw.file.WriteTo(xw.w)
+	return err
+}
+
+func (xw *xlsxPersonWriter) Release() {
+	if xw.file == nil {
+		return
+	}
+	if err := xw.file.Close(); err != nil {
+		logging.Logger.Warn("error removing xlsx temporary files", zap.Error(err))
+	}
+	xw.file = nil
+}
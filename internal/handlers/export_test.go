@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/models"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Записи для выгрузки: вторая содержит значения, похожие на формулы
+var exportPersons = []models.Person{
+	{ID: 1, Name: "Olga", Surname: "Ditr", Age: 34, Email: "olga@mail.com", Telephone: "+70011234576"},
+	{ID: 2, Name: "=HYPERLINK(\"http://evil\")", Surname: "-2+3", Age: 40, Email: "@sum", Telephone: "+7 (999) 000"},
+}
+
+/*
+Функция выгрузки записей в формате format без обращения к базе данных
+*/
+func exportBytes(t *testing.T, format string, persons []models.Person) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := newPersonWriter(format, &buf)
+	defer writer.Release()
+	for i := range persons {
+		person := persons[i]
+		if err := writer.Write(&person); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExportFormat(t *testing.T) {
+	tests := []struct {
+		query  string
+		accept string
+		format string
+	}{
+		{"", "", mimeJSON},
+		{"CSV", "application/yaml", mimeCSV},
+		{"jsonl", "", mimeNDJSON},
+		{"yml", "", mimeYAML},
+		{"xml", "", ""},
+		{"", "text/yaml", mimeYAML},
+		{"", "application/jsonl", mimeNDJSON},
+		{"", mimeXLSX, mimeXLSX},
+		{"", "text/html", ""},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, test := range tests {
+		context, _ := gin.CreateTestContext(httptest.NewRecorder())
+		context.Request = httptest.NewRequest(http.MethodGet, "/api/v1/persons/list?format="+test.query, nil)
+		if test.accept != "" {
+			context.Request.Header.Set("Accept", test.accept)
+		}
+		if got := exportFormat(context); got != test.format {
+			t.Errorf("format=%q, Accept %q: %q, want %q", test.query, test.accept, got, test.format)
+		}
+	}
+}
+
+func TestEscapeFormula(t *testing.T) {
+	tests := map[string]string{
+		"Olga":               "Olga",
+		"":                   "",
+		"=1+2":               "'=1+2",
+		"+cmd|' /C calc'!A0": "'+cmd|' /C calc'!A0",
+		"-2+3":               "'-2+3",
+		"@SUM(A1)":           "'@SUM(A1)",
+		"\t=1":               "'\t=1",
+		"\r=1":               "'\r=1",
+		"+70011234576":       "+70011234576",
+		"-5":                 "-5",
+		"+3.25":              "+3.25",
+		"-Inf":               "'-Inf",
+		"+NaN":               "'+NaN",
+		"-0x1p-2":            "'-0x1p-2",
+		"+1e5":               "'+1e5",
+		"a=b":                "a=b",
+	}
+	for value, want := range tests {
+		if got := escapeFormula(value); got != want {
+			t.Errorf("escapeFormula(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	for _, persons := range [][]models.Person{exportPersons, nil} {
+		var decoded []models.Person
+		if err := json.Unmarshal(exportBytes(t, mimeJSON, persons), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if len(decoded) != len(persons) || (len(persons) > 0 && decoded[1] != persons[1]) {
+			t.Errorf("decoded %+v", decoded)
+		}
+	}
+	if data := exportBytes(t, mimeJSON, nil); string(data) != "[]" {
+		t.Errorf("empty list %q", data)
+	}
+}
+
+func TestExportNDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSuffix(string(exportBytes(t, mimeNDJSON, exportPersons)), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("%d lines", len(lines))
+	}
+	var person models.Person
+	if err := json.Unmarshal([]byte(lines[0]), &person); err != nil || person != exportPersons[0] {
+		t.Errorf("first line %q: %v", lines[0], err)
+	}
+	if data := exportBytes(t, mimeNDJSON, nil); len(data) != 0 {
+		t.Errorf("empty list %q", data)
+	}
+}
+
+func TestExportYAML(t *testing.T) {
+	var decoded []models.Person
+	if err := yaml.Unmarshal(exportBytes(t, mimeYAML, exportPersons), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || decoded[0] != exportPersons[0] || decoded[1] != exportPersons[1] {
+		t.Errorf("decoded %+v", decoded)
+	}
+	if err := yaml.Unmarshal(exportBytes(t, mimeYAML, nil), &decoded); err != nil || len(decoded) != 0 {
+		t.Errorf("empty list: %+v, %v", decoded, err)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	records, err := csv.NewReader(bytes.NewReader(exportBytes(t, mimeCSV, exportPersons))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		exportColumns,
+		{"1", "Olga", "Ditr", "34", "olga@mail.com", "+70011234576"},
+		{"2", "'=HYPERLINK(\"http://evil\")", "'-2+3", "40", "'@sum", "'+7 (999) 000"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("%d records", len(records))
+	}
+	for i := range want {
+		if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("record %d: %q, want %q", i, records[i], want[i])
+		}
+	}
+	//Пустая выборка - только заголовок
+	if data := exportBytes(t, mimeCSV, nil); string(data) != strings.Join(exportColumns, ",")+"\n" {
+		t.Errorf("empty list %q", data)
+	}
+}
+
+func TestExportXLSX(t *testing.T) {
+	file, err := excelize.OpenReader(bytes.NewReader(exportBytes(t, mimeXLSX, exportPersons)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := file.GetRows("Sheet1")
+	if err != nil || len(rows) != 3 || strings.Join(rows[0], ",") != strings.Join(exportColumns, ",") {
+		t.Fatalf("rows %q, %v", rows, err)
+	}
+	if rows[1][1] != "Olga" || rows[1][5] != "+70011234576" || rows[2][1] != "'=HYPERLINK(\"http://evil\")" || rows[2][4] != "'@sum" {
+		t.Errorf("rows %q", rows[1:])
+	}
+	//id и возраст - числа, текстовые поля - строки, формул нет
+	for cell, want := range map[string]excelize.CellType{"A2": excelize.CellTypeUnset, "D2": excelize.CellTypeUnset, "B3": excelize.CellTypeInlineString} {
+		if got, err := file.GetCellType("Sheet1", cell); err != nil || got != want {
+			t.Errorf("%s: cell type %v, want %v (%v)", cell, got, want, err)
+		}
+	}
+	if formula, err := file.GetCellFormula("Sheet1", "B3"); err != nil || formula != "" {
+		t.Errorf("B3 formula %q, %v", formula, err)
+	}
+	if value, _ := file.GetCellValue("Sheet1", "D3"); value != "40" {
+		t.Errorf("D3 = %q", value)
+	}
+}
+
+func TestExportXLSXReleased(t *testing.T) {
+	//Выгрузка прервана после первой записи: Release освобождает книгу и ничего не пишет в ответ
+	var buf bytes.Buffer
+	writer := newPersonWriter(mimeXLSX, &buf).(*xlsxPersonWriter)
+	if err := writer.Write(&exportPersons[0]); err != nil {
+		t.Fatal(err)
+	}
+	writer.Release()
+	writer.Release()
+	if writer.file != nil || buf.Len() != 0 {
+		t.Fatalf("file %v, %d bytes written", writer.file, buf.Len())
+	}
+	//Close освобождает книгу сам
+	writer = newPersonWriter(mimeXLSX, &buf).(*xlsxPersonWriter)
+	if err := writer.Close(); err != nil || writer.file != nil || buf.Len() == 0 {
+		t.Fatalf("Close: %v, file %v", err, writer.file)
+	}
+}
+
+func TestExportXLSXRowLimit(t *testing.T) {
+	saved := config.HTTPServerSetting.MaxXLSXRows
+	t.Cleanup(func() { config.HTTPServerSetting.MaxXLSXRows = saved })
+	config.HTTPServerSetting.MaxXLSXRows = 2
+	var buf bytes.Buffer
+	writer := newPersonWriter(mimeXLSX, &buf)
+	defer writer.Release()
+	for i := range 2 {
+		if err := writer.Write(&exportPersons[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Write(&exportPersons[0]); !errors.Is(err, errTooManyRows) || buf.Len() != 0 {
+		t.Fatalf("third row: %v, %d bytes written", err, buf.Len())
+	}
+	//Ограничение касается только XLSX
+	config.HTTPServerSetting.MaxXLSXRows = 1
+	if data := exportBytes(t, mimeCSV, exportPersons); strings.Count(string(data), "\n") != 3 {
+		t.Errorf("csv %q", data)
+	}
+}
@@ -3,15 +3,19 @@ package handlers
 import (
 	"WST_lab6_server/internal/database"
 	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/metrics"
+	"WST_lab6_server/internal/middleware"
 	"WST_lab6_server/internal/models"
+	"WST_lab6_server/internal/pii"
+	"WST_lab6_server/internal/tracing"
 	"errors"
-	"fmt"
 	"net/http"
-	"regexp"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 /*
@@ -22,19 +26,45 @@ type StorageHandler struct {
 }
 
 /*
-Функция проверки email на корректность
+Функция открытия спана обработчика.
+Контекст запроса заменяется, чтобы запросы к базе данных стали дочерними спанами.
 */
-func validateEmail(email string) bool {
-	re := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	return re.MatchString(email)
+func startSpan(context *gin.Context, name string) trace.Span {
+	ctx, span := tracing.Tracer().Start(context.Request.Context(), name)
+	context.Request = context.Request.WithContext(ctx)
+	return span
 }
 
 /*
-Функция проверки телефона на корректность
+Функция ответа на ошибку хранилища.
+Превышение времени запроса возвращается как Gateway Timeout (504),
+недоступность базы данных как Service Unavailable (503), остальные ошибки как Internal Server Error (500).
 */
-func validatePhone(phone string) bool {
-	re := regexp.MustCompile(`^\+7\d{10}$`)
-	return re.MatchString(phone)
+func storageError(context *gin.Context, err error, message string) {
+	logging.FromContext(context.Request.Context()).Error("storage error", zap.Error(err))
+	switch {
+	case errors.Is(err, database.ErrQueryTimeout):
+		middleware.AbortWithProblem(context, http.StatusGatewayTimeout, "Database query timed out.")
+	case errors.Is(err, database.ErrUnavailable):
+		context.Header("Retry-After", "5")
+		middleware.AbortWithProblem(context, http.StatusServiceUnavailable, "Database is unavailable.")
+	default:
+		context.JSON(http.StatusInternalServerError, gin.H{"message": message})
+	}
+}
+
+/*
+Функция получения id записи из пути запроса.
+Формат id проверяется OpenAPIValidationMiddleware по документу OpenAPI.
+*/
+func personID(context *gin.Context) (uint, bool) {
+	personId, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err != nil {
+		//При ошибке возвращаем статус Bad Request (400) и сообщение об ошибке
+		context.JSON(http.StatusBadRequest, gin.H{"message": "Could not parse person id."})
+		return 0, false
+	}
+	return uint(personId), true
 }
 
 /*
@@ -43,61 +73,49 @@ func validatePhone(phone string) bool {
 //
 */
 func (sh *StorageHandler) SearchPersonHandler(context *gin.Context) {
-	//Получаем строку поиска из запроса
+	span := startSpan(context, "StorageHandler.SearchPersonHandler")
+	defer span.End()
+	//Получаем строку поиска из запроса (обязательность проверена по документу OpenAPI)
 	searchString := context.Query("query")
-	//Проверяем что строка не пустая
-	if searchString == "" {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Search query cannot be empty."})
-		return
-	}
-	//Ищем в базе данных по этой строке и возвращаем результат
-	persons, err := sh.Storage.SearchPerson(searchString)
-	if err != nil {
-		//При ошибке возвращаем статус InternalServerError (500) и сообщение об ошибке
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not retrieve persons."})
+	//Проверяем запрошенный формат ответа
+	format := exportFormat(context)
+	if format == "" {
+		context.JSON(http.StatusNotAcceptable, gin.H{"message": "Requested format is not supported."})
 		return
 	}
-	if len(persons) == 0 {
-		context.JSON(http.StatusNotFound, gin.H{
-			"code":    "not_found",
-			"message": fmt.Sprintf("Person for '%s' request was not found.", searchString),
-		})
-		return
-	}
-	//Возвращаем статус ОК (200) и результат поиска (массив)
-	context.JSON(http.StatusOK, persons)
+	//Ищем в базе данных по этой строке и возвращаем результат порциями
+	sh.streamPersons(context, format, searchString, true)
 }
 
 /*
 Метод обработки запроса на получение всех данных
 */
 func (sh *StorageHandler) GetAllPersonsHandler(context *gin.Context) {
-	//Получаем все данные из базы данных
-	persons, err := sh.Storage.GetAllPersons()
-	if err != nil {
-		//При ошибке возвращаем статус InternalServerError (500) и сообщение об ошибке
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch persons. Try again later."})
+	span := startSpan(context, "StorageHandler.GetAllPersonsHandler")
+	defer span.End()
+	//Проверяем запрошенный формат ответа
+	format := exportFormat(context)
+	if format == "" {
+		context.JSON(http.StatusNotAcceptable, gin.H{"message": "Requested format is not supported."})
 		return
 	}
-	//Возвращаем статус ОК (200) и результат поиска (массив)
-	context.JSON(http.StatusOK, persons)
+	//Возвращаем все данные из базы данных порциями
+	sh.streamPersons(context, format, "", false)
 }
 
 /*
 Метод обработки запроса на получение всех данных
 */
 func (sh *StorageHandler) GetPersonHandler(context *gin.Context) {
+	span := startSpan(context, "StorageHandler.GetPersonHandler")
+	defer span.End()
 	//Получаем id из запроса
-	personIdStr := context.Param("id")
-	//Преобразуем строку id в uint
-	personId, err := strconv.ParseUint(personIdStr, 10, 64)
-	if err != nil {
-		//При ошибке возвращаем статус Bad Request (400) и сообщение об ошибке
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Could not parse person id."})
+	personId, ok := personID(context)
+	if !ok {
 		return
 	}
 	//Получаем данные из базы данных
-	person, err := sh.Storage.GetPerson(uint(personId))
+	person, err := sh.Storage.GetPerson(context.Request.Context(), personId)
 	if err != nil {
 		//При ошибке, проверяем тип ошибки
 		if errors.Is(err, database.ErrPersonNotFound) {
@@ -105,12 +123,13 @@ func (sh *StorageHandler) GetPersonHandler(context *gin.Context) {
 			context.JSON(http.StatusNotFound, gin.H{"message": "Person not found."})
 			return
 		}
-		fmt.Println(err)
-		//Если другая ошибка, возвращаем статус Internal Server Error (500) и сообщение об ошибке
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch person."})
+		//Если другая ошибка, возвращаем статус 5xx и сообщение об ошибке
+		storageError(context, err, "Could not fetch person.")
 		return
 	}
 
+	//Скрываем поля, недоступные роли пользователя
+	pii.RedactPerson(person, middleware.RequestRole(context))
 	//Возвращаем статус ОК (200) и результат
 	context.JSON(http.StatusOK, person)
 
@@ -120,40 +139,16 @@ func (sh *StorageHandler) GetPersonHandler(context *gin.Context) {
 Метод обработки запроса на добавление новых данных
 */
 func (sh *StorageHandler) AddPersonHandler(context *gin.Context) {
+	span := startSpan(context, "StorageHandler.AddPersonHandler")
+	defer span.End()
 	var newPerson models.Person
-	//Привязываем к структуре
-	err := context.ShouldBindJSON(&newPerson)
-	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Could not parse request data."})
-		return
-	}
-	//Проверяем полученные данные
-	//Возраст > 0
-	if newPerson.Age < 0 {
-		context.Error(gin.Error{
-			Type: gin.ErrorTypePublic,
-			Err:  fmt.Errorf("invalid age value"),
-		})
-		return
-	}
-	//Email regexp
-	if !validateEmail(newPerson.Email) {
-		context.Error(gin.Error{
-			Type: gin.ErrorTypePublic,
-			Err:  fmt.Errorf("invalid email format"),
-		})
-		return
-	}
-	//Номер телефона regexp
-	if !validatePhone(newPerson.Telephone) {
-		context.Error(gin.Error{
-			Type: gin.ErrorTypePublic,
-			Err:  fmt.Errorf("invalid phone number format (+70011234568)"),
-		})
+	//Привязываем к структуре, id назначает база данных
+	if !bindStrictJSON(context, &newPerson, map[string]string{"id": "id is assigned by the server"}) {
 		return
 	}
+	//Возраст, формат email и телефона проверены по схеме PersonCreate документа OpenAPI
 	//Добавляем в БД
-	id, err := sh.Storage.AddPerson(&newPerson)
+	id, err := sh.Storage.AddPerson(context.Request.Context(), &newPerson)
 	if err != nil {
 		//Проверяем тип ошибки
 		if errors.Is(err, database.ErrEmailExists) {
@@ -161,9 +156,10 @@ func (sh *StorageHandler) AddPersonHandler(context *gin.Context) {
 			context.JSON(http.StatusConflict, gin.H{"message": "Email already in use."})
 			return
 		}
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create person."})
+		storageError(context, err, "Could not create person.")
 		return
 	}
+	metrics.PersonsCreated.Inc()
 	//Возвращаем статус Created (201) и id новой записи
 	context.JSON(http.StatusCreated, gin.H{"id": id})
 }
@@ -172,94 +168,35 @@ func (sh *StorageHandler) AddPersonHandler(context *gin.Context) {
 Метод обработки запроса на изменение данных
 */
 func (sh *StorageHandler) UpdatePersonHandler(context *gin.Context) {
+	span := startSpan(context, "StorageHandler.UpdatePersonHandler")
+	defer span.End()
 	//Получаем id из запроса
-	personIdStr := context.Param("id")
-	//Преобразуем строку id в uint
-	personId, err := strconv.ParseUint(personIdStr, 10, 64)
-	if err != nil {
-		//При ошибке возвращаем статус Bad Request (400) и сообщение об ошибке
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Could not parse person id."})
+	personId, ok := personID(context)
+	if !ok {
 		return
-
 	}
 	//Создаем структуру обновленных данных
 	var updatedPerson models.Person
 	//Привязываем данные из запроса к структуре
-	err = context.ShouldBindJSON(&updatedPerson)
-	if err != nil {
-		//При ошибке возвращаем статус Bad Request (400) и сообщение об ошибке
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Could not parse request data."})
+	if !bindStrictJSON(context, &updatedPerson, nil) {
 		return
 	}
 	//Присваиваем id обновляемой записи в структуре
-	updatedPerson.ID = uint(personId)
+	updatedPerson.ID = personId
 	//Проверяем уникальность email с исключением текущего ID
 	if updatedPerson.Email != "" {
-		if _, err := sh.Storage.CheckPersonByEmail(updatedPerson.Email, updatedPerson.ID); err == nil {
+		if _, err := sh.Storage.CheckPersonByEmail(context.Request.Context(), updatedPerson.Email, updatedPerson.ID); err == nil {
 			context.JSON(http.StatusConflict, gin.H{"message": "Email already in use."})
 			return
-		}
-		//Проверяем формат email
-		if !validateEmail(updatedPerson.Email) {
-			context.JSON(http.StatusBadRequest, gin.H{"message": "Invalid email format."})
-			return
-		}
-	}
-
-	// Проверяем, были ли указаны поля для обновления
-	if updatedPerson.Name == "" &&
-		updatedPerson.Surname == "" &&
-		updatedPerson.Email == "" &&
-		updatedPerson.Telephone == "" &&
-		updatedPerson.Age <= 0 {
-		//Если не указаны поля для обновления, возвращаем статус Bad Request (400) и сообщение об ошибке
-		context.JSON(http.StatusBadRequest, gin.H{"message": "At least one field must be provided for update."})
-		return
-	}
-	// Проверяем незаполненные поля если они указаны в запросе
-	if updatedPerson.Name == "" {
-		if len(updatedPerson.Name) == 0 {
-			context.JSON(http.StatusBadRequest, gin.H{"message": "Name cannot be empty."})
-			return
-		}
-	}
-	if updatedPerson.Surname == "" {
-		if len(updatedPerson.Surname) == 0 {
-			context.JSON(http.StatusBadRequest, gin.H{"message": "Surname cannot be empty."})
-			return
-		}
-	}
-
-	if updatedPerson.Email == "" {
-		if len(updatedPerson.Email) == 0 {
-			context.JSON(http.StatusBadRequest, gin.H{"message": "Email cannot be empty."})
-			return
-		}
-		if !validateEmail(updatedPerson.Email) {
-			context.JSON(http.StatusBadRequest, gin.H{"message": "Invalid email format."})
-			return
-		}
-	}
-
-	if updatedPerson.Telephone == "" {
-		if len(updatedPerson.Telephone) == 0 {
-			context.JSON(http.StatusBadRequest, gin.H{"message": "Telephone cannot be empty."})
-			return
-		}
-		if !validatePhone(updatedPerson.Telephone) {
-			context.JSON(http.StatusBadRequest, gin.H{"message": "Invalid phone number format."})
-			return
-		}
-	}
-	if updatedPerson.Age > 0 {
-		if updatedPerson.Age <= 0 {
-			context.JSON(http.StatusBadRequest, gin.H{"message": "Age must be greater than 0."})
+		} else if !errors.Is(err, database.ErrPersonNotFound) {
+			storageError(context, err, "Could not update person.")
 			return
 		}
 	}
+	//Обязательность полей и их формат проверены по схеме PersonUpdate документа OpenAPI
 
 	//Обновляем данные в базе данных
-	err = sh.Storage.UpdatePerson(&updatedPerson)
+	err := sh.Storage.UpdatePerson(context.Request.Context(), &updatedPerson)
 	if err != nil {
 		//Проверяем на отсутстве в базе данных
 		if errors.Is(err, database.ErrPersonNotFound) {
@@ -267,10 +204,11 @@ func (sh *StorageHandler) UpdatePersonHandler(context *gin.Context) {
 			context.JSON(http.StatusNotFound, gin.H{"message": "Person not found."})
 			return
 		}
-		//Если другая ошибка, возвращаем статус Internal Server Error (500) и сообщение об ошибке
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not update person."})
+		//Если другая ошибка, возвращаем статус 5xx и сообщение об ошибке
+		storageError(context, err, "Could not update person.")
 		return
 	}
+	metrics.PersonsUpdated.Inc()
 	//Возвращаем статус OK (200) и сообщение об успешном обновлении данных
 	context.JSON(http.StatusOK, gin.H{"message": "Person updated successfully!"})
 }
@@ -279,36 +217,34 @@ func (sh *StorageHandler) UpdatePersonHandler(context *gin.Context) {
 Метод обработки запроса на удаление данных
 */
 func (sh *StorageHandler) DeletePersonHandler(context *gin.Context) {
+	span := startSpan(context, "StorageHandler.DeletePersonHandler")
+	defer span.End()
 	//Получаем id из запроса
-	personIdStr := context.Param("id")
-	//Преобразуем строку id в uint
-	personId, err := strconv.ParseUint(personIdStr, 10, 64)
-	if err != nil {
-		//При ошибке возвращаем статус Bad Request (400) и сообщение об ошибке
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Could not parse person id."})
+	personId, ok := personID(context)
+	if !ok {
 		return
-
 	}
 	//Проверяем наличие записи с этим id в базе данных
-	person, err := sh.Storage.GetPerson(uint(personId))
-	if person == nil {
+	_, err := sh.Storage.GetPerson(context.Request.Context(), personId)
+	if errors.Is(err, database.ErrPersonNotFound) {
 		//Если запись не найдена, возвращаем статус Not Found (404) и сообщение об ошибке
 		context.JSON(http.StatusNotFound, gin.H{"message": "Person not found."})
 		return
 	}
 	if err != nil {
-		//При ошибке возвращаем статус Internal Server Error (5) и сообщение об ошибке
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch the person ."})
+		//При ошибке возвращаем статус 5xx и сообщение об ошибке
+		storageError(context, err, "Could not fetch the person .")
 		return
 	}
-	
+
 	//Удаляем запись из базы данных
-	err = sh.Storage.DeletePerson(&models.Person{ID: uint(personId)})
+	err = sh.Storage.DeletePerson(context.Request.Context(), &models.Person{ID: personId})
 	if err != nil {
-		//При ошибке возвращаем статус Internal Server Error (500) и сообщение об ошибке
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Could Not Delete Person"})
+		//При ошибке возвращаем статус 5xx и сообщение об ошибке
+		storageError(context, err, "Could Not Delete Person")
 		return
 	}
+	metrics.PersonsDeleted.Inc()
 	//Возвращаем статус OK (200) и сообщение об успешном удалении данных
 	context.JSON(http.StatusOK, gin.H{"message": "Deleted Successfully"})
 }
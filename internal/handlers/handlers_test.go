@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	gormpostgres "gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+/*
+Функция создания хранилища с недоступной базой данных (порт 1 не принимает соединения)
+*/
+func unreachableStorage(t *testing.T) *postgres.Storage {
+	t.Helper()
+	db, err := gorm.Open(gormpostgres.Open("host=127.0.0.1 port=1 user=test dbname=test sslmode=disable connect_timeout=5"), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return &postgres.Storage{DB: db}
+}
+
+func TestStorageErrorStatus(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	saved := config.DatabaseSetting.Timeouts
+	t.Cleanup(func() { config.DatabaseSetting.Timeouts = saved })
+	handler := &StorageHandler{Storage: unreachableStorage(t)}
+	tests := []struct {
+		name       string
+		read       time.Duration
+		status     int
+		retryAfter string
+	}{
+		//Срок запроса истекает раньше попытки соединения
+		{"timeout", time.Nanosecond, http.StatusGatewayTimeout, ""},
+		//Соединение отклонено
+		{"unavailable", time.Minute, http.StatusServiceUnavailable, "5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.DatabaseSetting.Timeouts = config.QueryTimeoutConfig{Read: test.read}
+			recorder := httptest.NewRecorder()
+			context, _ := gin.CreateTestContext(recorder)
+			context.Request = httptest.NewRequest(http.MethodGet, "/persons/1", nil)
+			context.Params = gin.Params{{Key: "id", Value: "1"}}
+			handler.GetPersonHandler(context)
+			var problem models.ErrorResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("%d %s: %v", recorder.Code, recorder.Body, err)
+			}
+			if recorder.Code != test.status || problem.Status != test.status ||
+				recorder.Header().Get("Content-Type") != "application/problem+json" {
+				t.Errorf("got %d %s %s", recorder.Code, recorder.Header().Get("Content-Type"), recorder.Body)
+			}
+			if got := recorder.Header().Get("Retry-After"); got != test.retryAfter {
+				t.Errorf("Retry-After %q, want %q", got, test.retryAfter)
+			}
+		})
+	}
+}
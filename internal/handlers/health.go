@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/health"
+	"WST_lab6_server/internal/models"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+Обработчик проверки жизнеспособности процесса (/healthz)
+*/
+func LivenessHandler(context *gin.Context) {
+	//Процесс отвечает - значит жив
+	context.JSON(http.StatusOK, gin.H{"status": models.HealthStatusUp})
+}
+
+/*
+Обработчик проверки готовности к приему запросов (/readyz).
+Маршрут доступен без аутентификации, поэтому в ответе только имена неуспешных проверок без текста ошибок.
+*/
+func ReadinessHandler(context *gin.Context) {
+	report := health.Run(context.Request.Context(), config.HTTPServerSetting.HealthCheckTimeout)
+	//Возвращаем статус OK (200) или Service Unavailable (503) с перечнем неуспешных проверок
+	if report.Status != models.HealthStatusUp {
+		failed := []string{}
+		for name, result := range report.Checks {
+			if result.Status != models.HealthStatusUp {
+				failed = append(failed, name)
+			}
+		}
+		sort.Strings(failed)
+		context.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":       report.Status,
+			"shuttingDown": report.ShuttingDown,
+			"failed":       failed,
+		})
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"status": report.Status})
+}
+
+/*
+Обработчик общего состояния сервера (/health).
+Маршрут доступен без аутентификации: возвращается только итоговый статус,
+ошибки проверок и статистика пула соединений доступны в /admin/health.
+*/
+func HealthHandler(context *gin.Context) {
+	report := health.Run(context.Request.Context(), config.HTTPServerSetting.HealthCheckTimeout)
+	//Возвращаем статус OK (200) или Service Unavailable (503) если есть неуспешные проверки
+	context.JSON(healthStatusCode(report), gin.H{"status": report.Status})
+}
+
+/*
+Обработчик подробного отчета о состоянии зависимостей (/admin/health, роль admin)
+*/
+func HealthReportHandler(context *gin.Context) {
+	report := health.Run(context.Request.Context(), config.HTTPServerSetting.HealthCheckTimeout)
+	context.JSON(healthStatusCode(report), report)
+}
+
+func healthStatusCode(report models.HealthReport) int {
+	if report.Status != models.HealthStatusUp {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
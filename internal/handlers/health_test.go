@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"WST_lab6_server/internal/health"
+	"WST_lab6_server/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+Функция вызова обработчика проверки состояния
+*/
+func healthRequest(t *testing.T, handler gin.HandlerFunc) (int, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(recorder)
+	context.Request = httptest.NewRequest(http.MethodGet, "/health", nil)
+	handler(context)
+	return recorder.Code, recorder.Body.String()
+}
+
+func TestHealthHidesDetails(t *testing.T) {
+	health.Register("database", func(ctx context.Context) (any, error) {
+		return map[string]int{"openConnections": 3}, errors.New("dial tcp 10.0.0.5:5432: password authentication failed for user wst")
+	})
+	//Публичные маршруты: только статус и имена проверок
+	code, body := healthRequest(t, HealthHandler)
+	if code != http.StatusServiceUnavailable || strings.TrimSpace(body) != `{"status":"down"}` {
+		t.Errorf("/health: %d %s", code, body)
+	}
+	code, body = healthRequest(t, ReadinessHandler)
+	var readiness struct {
+		Status string   `json:"status"`
+		Failed []string `json:"failed"`
+	}
+	if err := json.Unmarshal([]byte(body), &readiness); err != nil || code != http.StatusServiceUnavailable ||
+		len(readiness.Failed) != 1 || readiness.Failed[0] != "database" || strings.Contains(body, "10.0.0.5") {
+		t.Errorf("/readyz: %d %s", code, body)
+	}
+	//Подробный отчет для администратора
+	code, body = healthRequest(t, HealthReportHandler)
+	var report models.HealthReport
+	if err := json.Unmarshal([]byte(body), &report); err != nil || code != http.StatusServiceUnavailable ||
+		!strings.Contains(report.Checks["database"].Error, "10.0.0.5") || !strings.Contains(body, "openConnections") {
+		t.Errorf("/admin/health: %d %s", code, body)
+	}
+}
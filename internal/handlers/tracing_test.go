@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/tracing"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	gormpostgres "gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+/*
+Функция создания хранилища без подключения к базе данных:
+запросы только строятся (DryRun), обратные вызовы плагинов выполняются
+*/
+func dryRunStorage(t *testing.T) *postgres.Storage {
+	t.Helper()
+	db, err := gorm.Open(gormpostgres.Open("host=127.0.0.1 port=1 user=test dbname=test sslmode=disable"), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	return &postgres.Storage{DB: db}
+}
+
+/*
+Спан обработчика - дочерний спан otelgin, спан SQL запроса - дочерний спан обработчика
+*/
+func TestHandlerSpans(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logging.Logger = zap.NewNop()
+	recorder := tracetest.NewSpanRecorder()
+	saved := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(saved) })
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	handler := StorageHandler{Storage: dryRunStorage(t)}
+	engine := gin.New()
+	engine.Use(otelgin.Middleware("test"))
+	engine.GET("/api/v1/person/:id", handler.GetPersonHandler)
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/person/7", nil))
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	server, handlerSpan, query := spans["/api/v1/person/:id"], spans["StorageHandler.GetPersonHandler"], spans["gorm.query"]
+	if server == nil || handlerSpan == nil || query == nil {
+		t.Fatalf("spans %v", spans)
+	}
+	if handlerSpan.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("handler span parent %s, want otelgin span %s", handlerSpan.Parent().SpanID(), server.SpanContext().SpanID())
+	}
+	if query.Parent().SpanID() != handlerSpan.SpanContext().SpanID() {
+		t.Errorf("query span parent %s, want handler span %s", query.Parent().SpanID(), handlerSpan.SpanContext().SpanID())
+	}
+	if query.SpanContext().TraceID() != server.SpanContext().TraceID() {
+		t.Error("query span belongs to another trace")
+	}
+}
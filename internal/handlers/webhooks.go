@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"WST_lab6_server/internal/database"
+	"WST_lab6_server/internal/models"
+	"WST_lab6_server/internal/webhooks"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Число доставок в ответе журнала по умолчанию
+const defaultDeliveriesLimit = 100
+
+/*
+Тело запроса создания и изменения подписки.
+Секрет можно передать явно; при создании без секрета он генерируется.
+*/
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+	Active *bool    `json:"active"`
+}
+
+/*
+Метод переноса полей запроса в подписку (active по умолчанию true)
+*/
+func (r *webhookRequest) apply(webhook *models.Webhook) {
+	webhook.URL = r.URL
+	webhook.Events = r.Events
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+	if r.Secret != "" {
+		webhook.Secret = r.Secret
+	}
+	webhook.Active = r.Active == nil || *r.Active
+}
+
+/*
+Функция получения id из пути запроса (формат проверен по документу OpenAPI)
+*/
+func pathID(context *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(context.Param(name), 10, 64)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "Could not parse " + name + "."})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+/*
+Функция ответа на ошибку хранилища для подписок и доставок
+*/
+func webhookError(context *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, database.ErrWebhookNotFound):
+		context.JSON(http.StatusNotFound, gin.H{"message": "Webhook not found."})
+	case errors.Is(err, database.ErrDeliveryNotFound):
+		context.JSON(http.StatusNotFound, gin.H{"message": "Delivery not found."})
+	default:
+		storageError(context, err, message)
+	}
+}
+
+/*
+Метод обработки запроса на получение списка подписок (секреты не возвращаются)
+*/
+func (sh *StorageHandler) ListWebhooksHandler(context *gin.Context) {
+	span := startSpan(context, "StorageHandler.ListWebhooksHandler")
+	defer span.End()
+	list, err := sh.Storage.ListWebhooks(context.Request.Context())
+	if err != nil {
+		storageError(context, err, "Could not fetch webhooks.")
+		return
+	}
+	for i := range list {
+		list[i].Secret = ""
+	}
+	context.JSON(http.StatusOK, list)
+}
+
+/*
+Метод обработки запроса на создание подписки.
+Секрет подписи возвращается только в этом ответе.
+*/
+func (sh *StorageHandler) AddWebhookHandler(context *gin.Context) {
+	span := startSpan(context, "StorageHandler.AddWebhookHandler")
+	defer span.End()
+	var request webhookRequest
+	if !bindStrictJSON(context, &request, nil) {
+		return
+	}
+	//Адрес и типы событий проверены по схеме WebhookCreate документа OpenAPI
+	var webhook models.Webhook
+	request.apply(&webhook)
+	if webhook.Secret == "" {
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"message": "Could not generate webhook secret."})
+			return
+		}
+		webhook.Secret = secret
+	}
+	if err := sh.Storage.AddWebhook(context.Request.Context(), &webhook); err != nil {
+		storageError(context, err, "Could not create webhook.")
+		return
+	}
+	//Возвращаем статус Created (201) и подписку вместе с секретом
+	context.JSON(http.StatusCreated, webhook)
+}
+
+/*
+Метод обработки запроса на получение подписки
+*/
+func (sh *StorageHandler) GetWebhookHandler(context *gin.Context) {
+	span := startSpan(context, "StorageHandler.GetWebhookHandler")
+	defer span.End()
+	id, ok := pathID(context, "id")
+	if !ok {
+		return
+	}
+	webhook, err := sh.Storage.GetWebhook(context.Request.Context(), id)
+	if err != nil {
+		webhookError(context, err, "Could not fetch webhook.")
+		return
+	}
+	webhook.Secret = ""
+	context.JSON(http.StatusOK, webhook)
+}
+
+/*
+Метод обработки запроса на изменение подписки.
+Без секрета в запросе сохраняется прежний.
+*/
+func (sh *StorageHandler) UpdateWebhookHandler(context *gin.Context) {
+	span := startSpan(context, "StorageHandler.UpdateWebhookHandler")
+	defer span.End()
+	id, ok := pathID(context, "id")
+	if !ok {
+		return
+	}
+	var request webhookRequest
+	if !bindStrictJSON(context, &request, nil) {
+		return
+	}
+	webhook, err := sh.Storage.GetWebhook(context.Request.Context(), id)
+	if err != nil {
+		webhookError(context, err, "Could not update webhook.")
+		return
+	}
+	request.apply(webhook)
+	if err := sh.Storage.UpdateWebhook(context.Request.Context(), webhook); err != nil {
+		webhookError(context, err, "Could not update webhook.")
+		return
+	}
+	webhook.Secret = ""
+	context.JSON(http.StatusOK, webhook)
+}
+
+/*
+Метод обработки запроса на удаление подписки вместе с журналом доставок
+*/
+func (sh *StorageHandler) DeleteWebhookHandler(context *gin.Context) {
+	span := startSpan(context, "StorageHandler.DeleteWebhookHandler")
+	defer span.End()
+	id, ok := pathID(context, "id")
+	if !ok {
+		return
+	}
+	if err := sh.Storage.DeleteWebhook(context.Request.Context(), id); err != nil {
+		webhookError(context, err, "Could not delete webhook.")
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"message": "Deleted Successfully"})
+}
+
+/*
+Метод обработки запроса на получение журнала доставок подписки (status - фильтр по состоянию)
+*/
+func (sh *StorageHandler) ListWebhookDeliveriesHandler(context *gin.Context) {
+	span := startSpan(context, "StorageHandler.ListWebhookDeliveriesHandler")
+	defer span.End()
+	id, ok := pathID(context, "id")
+	if !ok {
+		return
+	}
+	//Значения status и limit проверены по документу OpenAPI
+	limit := defaultDeliveriesLimit
+	if value := context.Query("limit"); value != "" {
+		limit, _ = strconv.Atoi(value)
+	}
+	//Несуществующая подписка - 404, а не пустой список
+	if _, err := sh.Storage.GetWebhook(context.Request.Context(), id); err != nil {
+		webhookError(context, err, "Could not fetch deliveries.")
+		return
+	}
+	deliveries, err := sh.Storage.ListWebhookDeliveries(context.Request.Context(), id, context.Query("status"), limit)
+	if err != nil {
+		storageError(context, err, "Could not fetch deliveries.")
+		return
+	}
+	context.JSON(http.StatusOK, deliveries)
+}
+
+/*
+Метод обработки запроса на получение доставки с журналом попыток
+*/
+func (sh *StorageHandler) GetWebhookDeliveryHandler(context *gin.Context) {
+	span := startSpan(context, "StorageHandler.GetWebhookDeliveryHandler")
+	defer span.End()
+	id, ok := pathID(context, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := pathID(context, "deliveryId")
+	if !ok {
+		return
+	}
+	delivery, err := sh.Storage.GetWebhookDelivery(context.Request.Context(), id, deliveryID)
+	if err != nil {
+		webhookError(context, err, "Could not fetch delivery.")
+		return
+	}
+	context.JSON(http.StatusOK, delivery)
+}
+
+/*
+Метод обработки запроса на повторную отправку доставки (в том числе в состоянии dead)
+*/
+func (sh *StorageHandler) RedeliverWebhookHandler(context *gin.Context) {
+	span := startSpan(context, "StorageHandler.RedeliverWebhookHandler")
+	defer span.End()
+	id, ok := pathID(context, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := pathID(context, "deliveryId")
+	if !ok {
+		return
+	}
+	if err := sh.Storage.RedeliverWebhookDelivery(context.Request.Context(), id, deliveryID); err != nil {
+		webhookError(context, err, "Could not redeliver.")
+		return
+	}
+	//Возвращаем статус Accepted (202): доставка выполняется отправителем
+	context.JSON(http.StatusAccepted, gin.H{"message": "Delivery queued."})
+}
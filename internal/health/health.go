@@ -0,0 +1,113 @@
+package health
+
+import (
+	"WST_lab6_server/internal/models"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Функция проверки зависимости, возвращает дополнительные сведения для отчета
+type CheckFunc func(ctx context.Context) (any, error)
+
+// Зарегистрированная проверка
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Ограничение времени одной проверки по умолчанию
+const defaultCheckTimeout = 3 * time.Second
+
+var (
+	mu           sync.RWMutex
+	checks       []check
+	shuttingDown atomic.Bool
+	startedAt    = time.Now()
+)
+
+/*
+Функция регистрации проверки зависимости для /readyz, /health и /admin/health
+*/
+func Register(name string, fn CheckFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks = append(checks, check{name: name, fn: fn})
+}
+
+/*
+Функция перевода сервера в состояние остановки, после нее сервер перестает быть готовым
+*/
+func SetShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+/*
+Функция проверки состояния остановки
+*/
+func ShuttingDown() bool {
+	return shuttingDown.Load()
+}
+
+/*
+Функция выполнения всех проверок.
+Проверки выполняются параллельно, каждая ограничена timeout.
+*/
+func Run(ctx context.Context, timeout time.Duration) models.HealthReport {
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	mu.RLock()
+	registered := make([]check, len(checks))
+	copy(registered, checks)
+	mu.RUnlock()
+
+	report := models.HealthReport{
+		Status:       models.HealthStatusUp,
+		Uptime:       time.Since(startedAt).Round(time.Second).String(),
+		ShuttingDown: ShuttingDown(),
+		Checks:       make(map[string]models.CheckResult, len(registered)),
+	}
+	results := make([]models.CheckResult, len(registered))
+	var wg sync.WaitGroup
+	for i, c := range registered {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c, timeout)
+		}()
+	}
+	wg.Wait()
+	for i, c := range registered {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != models.HealthStatusUp {
+			report.Status = models.HealthStatusDown
+		}
+	}
+	//Во время остановки сервер не готов принимать запросы
+	if report.ShuttingDown {
+		report.Status = models.HealthStatusDown
+	}
+	return report
+}
+
+/*
+Функция выполнения одной проверки с замером времени
+*/
+func runCheck(ctx context.Context, c check, timeout time.Duration) models.CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	details, err := c.fn(ctx)
+	result := models.CheckResult{
+		Status:  models.HealthStatusUp,
+		Latency: time.Since(start).String(),
+		Details: details,
+	}
+	if err != nil {
+		result.Status = models.HealthStatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/logging"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+/*
+Проверка ролей на изменяющих и административных маршрутах.
+Запрос, прошедший проверку роли, отклоняется проверкой по OpenAPI (400): база данных не нужна.
+*/
+func TestRoutesRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logging.Logger = zap.NewNop()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := config.AuthSetting.Users
+	t.Cleanup(func() { config.AuthSetting.Users = saved })
+	config.AuthSetting.Users = []config.UserConfig{
+		{Username: "viewer", PasswordHash: string(hash), Role: "viewer"},
+		{Username: "editor", PasswordHash: string(hash), Role: "editor"},
+		{Username: "admin", PasswordHash: string(hash), Role: "admin"},
+	}
+	engine := gin.New()
+	Init(engine, &postgres.Storage{})
+
+	tests := []struct {
+		user   string
+		method string
+		path   string
+		status int
+	}{
+		{"viewer", http.MethodPost, "/api/v1/persons", http.StatusForbidden},
+		{"viewer", http.MethodPut, "/api/v1/person/1", http.StatusForbidden},
+		{"viewer", http.MethodDelete, "/api/v1/person/abc", http.StatusForbidden},
+		{"editor", http.MethodPost, "/api/v1/persons", http.StatusBadRequest},
+		{"editor", http.MethodDelete, "/api/v1/person/abc", http.StatusBadRequest},
+		{"admin", http.MethodPut, "/api/v1/person/1", http.StatusBadRequest},
+		{"viewer", http.MethodPost, "/admin/webhooks", http.StatusForbidden},
+		{"editor", http.MethodPut, "/admin/log/level", http.StatusForbidden},
+		{"admin", http.MethodPost, "/admin/webhooks", http.StatusBadRequest},
+		{"viewer", http.MethodGet, "/admin/health", http.StatusForbidden},
+		{"", http.MethodGet, "/admin/health", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.path, strings.NewReader("{}"))
+		request.Header.Set("Content-Type", "application/json")
+		if test.user != "" {
+			request.SetBasicAuth(test.user, "secret")
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		if recorder.Code != test.status {
+			t.Errorf("%s %s as %s: status %d, want %d: %s", test.method, test.path, test.user, recorder.Code, test.status, recorder.Body)
+		}
+	}
+}
@@ -1,30 +1,89 @@
 package routes
 
 import (
+	"WST_lab6_server/config"
 	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/graphqlapi"
 	"WST_lab6_server/internal/handlers"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/metrics"
 	"WST_lab6_server/internal/middleware"
+	"WST_lab6_server/internal/openapi"
+	"WST_lab6_server/internal/soapapi"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.uber.org/zap"
 )
 
-func Init(httpserver *gin.Engine) {
+func Init(httpserver *gin.Engine, storage *postgres.Storage) {
+	//Трассировка запросов (W3C traceparent)
+	httpserver.Use(otelgin.Middleware(config.TracingSetting.ServiceName))
+	//Идентификатор запроса и структурированный журнал доступа
+	httpserver.Use(middleware.RequestLoggerMiddleware())
+	//Метрики HTTP запросов
+	httpserver.Use(middleware.MetricsMiddleware())
 	//middleware для обработки ошибок
 	httpserver.Use(middleware.ErrorHandler())
 	//Восстановление после паники
 	httpserver.Use(gin.Recovery())
-	//Логгирование 
-	httpserver.Use(gin.Logger())
-	//Подключение к БД
-	db := postgres.Init()
-	storage := &postgres.Storage{DB: db}
+	//Сжатие ответов и распаковка тел запросов (compression)
+	if config.CompressionSetting.Enabled {
+		httpserver.Use(middleware.CompressionMiddleware())
+	}
+	//Ограничение размера тела запроса (httpServer.maxBodySize, httpServer.bodyLimits)
+	httpserver.Use(middleware.BodyLimitMiddleware())
+	//Cache-Control по маршрутам (httpServer.cacheControl)
+	httpserver.Use(middleware.CacheControlMiddleware())
 	route := &handlers.StorageHandler{Storage: storage}
+	//Проверка запросов по документу OpenAPI (подключается после аутентификации)
+	validate := middleware.OpenAPIValidationMiddleware()
+	//Проверки состояния: процесс жив, готовность к запросам, общий статус (подробный отчет - /admin/health)
+	httpserver.GET("/healthz", handlers.LivenessHandler)
+	httpserver.GET("/readyz", handlers.ReadinessHandler)
+	httpserver.GET("/health", handlers.HealthHandler)
+	//Метрики в формате Prometheus
+	httpserver.GET("/metrics", gin.WrapH(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})))
+	//Документация API: OpenAPI и Swagger UI
+	httpserver.GET(openapi.SpecPath, openapi.SpecHandler)
+	httpserver.GET("/docs/*any", openapi.UIHandler)
+	//GraphQL: чтение с анонимной ролью, мутации только с учетными данными
+	graphqlHandler, err := graphqlapi.NewHandler(storage)
+	if err != nil {
+		logging.Logger.Fatal("error building graphql schema", zap.Error(err))
+	}
+	httpserver.POST("/graphql", middleware.OptionalBasicAuthMiddleware(), graphqlHandler.Serve)
+	//SOAP 1.1/1.2: WSDL и конверты с WS-Security UsernameToken
+	soapHandler := soapapi.NewHandler(storage)
+	httpserver.GET(soapapi.Path, soapHandler.WSDL)
+	httpserver.POST(soapapi.Path, soapHandler.Serve)
+	//Административные маршруты: только роль admin
+	admin := httpserver.Group("/admin", middleware.BasicAuthMiddleware(), middleware.RequireRole(middleware.RoleAdmin))
+	//Уровень журнала: GET - текущий, PUT {"level":"debug"} - изменить без перезапуска
+	admin.GET("/health", handlers.HealthReportHandler)
+	admin.GET("/log/level", gin.WrapH(logging.Level))
+	admin.PUT("/log/level", validate, gin.WrapH(logging.Level))
+	//Подписки webhook, журнал доставок и повторная отправка
+	admin.GET("/webhooks", validate, route.ListWebhooksHandler)
+	admin.POST("/webhooks", validate, route.AddWebhookHandler)
+	admin.GET("/webhooks/:id", validate, route.GetWebhookHandler)
+	admin.PUT("/webhooks/:id", validate, route.UpdateWebhookHandler)
+	admin.DELETE("/webhooks/:id", validate, route.DeleteWebhookHandler)
+	admin.GET("/webhooks/:id/deliveries", validate, route.ListWebhookDeliveriesHandler)
+	admin.GET("/webhooks/:id/deliveries/:deliveryId", validate, route.GetWebhookDeliveryHandler)
+	admin.POST("/webhooks/:id/deliveries/:deliveryId/redeliver", validate, route.RedeliverWebhookHandler)
 	//routes по запросам
 	apiv1 := httpserver.Group("/api/v1")
-	apiv1.GET("/persons", route.SearchPersonHandler)
-	apiv1.POST("/persons", middleware.BasicAuthMiddleware(), route.AddPersonHandler)
-	apiv1.GET("/persons/list", route.GetAllPersonsHandler)
-	apiv1.GET("/person/:id", route.GetPersonHandler)
-	apiv1.PUT("/person/:id",middleware.BasicAuthMiddleware(), route.UpdatePersonHandler)
-	apiv1.DELETE("/person/:id", middleware.BasicAuthMiddleware(), route.DeletePersonHandler)
+	//Изменение записей доступно ролям editor и admin
+	write := middleware.RequireRole(middleware.WriteRoles...)
+	apiv1.GET("/persons", middleware.OptionalBasicAuthMiddleware(), validate, route.SearchPersonHandler)
+	apiv1.POST("/persons", middleware.BasicAuthMiddleware(), write, validate, route.AddPersonHandler)
+	apiv1.GET("/persons/list", middleware.OptionalBasicAuthMiddleware(), validate, route.GetAllPersonsHandler)
+	//Лента изменений: Server-Sent Events и WebSocket
+	apiv1.GET("/persons/events", middleware.BasicAuthMiddleware(), validate, route.PersonEventsHandler)
+	apiv1.GET("/persons/events/ws", middleware.BasicAuthMiddleware(), validate, route.PersonEventsWebSocketHandler)
+	apiv1.GET("/person/:id", middleware.OptionalBasicAuthMiddleware(), validate, route.GetPersonHandler)
+	apiv1.PUT("/person/:id", middleware.BasicAuthMiddleware(), write, validate, route.UpdatePersonHandler)
+	apiv1.DELETE("/person/:id", middleware.BasicAuthMiddleware(), write, validate, route.DeletePersonHandler)
 
 }
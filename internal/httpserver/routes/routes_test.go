@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/openapi"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Маршруты, которые не описываются в документе OpenAPI
+var undocumentedRoutes = map[string]bool{
+	"GET /docs/*any": true,
+}
+
+// Параметр пути gin (:id) в формате OpenAPI ({id})
+var ginParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+/*
+Проверка соответствия зарегистрированных маршрутов и документа OpenAPI
+*/
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	Init(engine, &postgres.Storage{})
+
+	registered := make(map[string]bool)
+	for _, route := range engine.Routes() {
+		key := route.Method + " " + route.Path
+		if undocumentedRoutes[key] {
+			continue
+		}
+		registered[route.Method+" "+ginParam.ReplaceAllString(route.Path, "{$1}")] = true
+	}
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openapi.Spec, &spec); err != nil {
+		t.Fatalf("invalid OpenAPI document: %v", err)
+	}
+	documented := make(map[string]bool)
+	for path, item := range spec.Paths {
+		for method := range item {
+			switch method {
+			case "get", "put", "post", "delete", "patch", "head", "options":
+				documented[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+
+	if missing := difference(registered, documented); len(missing) > 0 {
+		t.Errorf("routes missing from OpenAPI document: %v", missing)
+	}
+	if stale := difference(documented, registered); len(stale) > 0 {
+		t.Errorf("OpenAPI operations without registered route: %v", stale)
+	}
+}
+
+/*
+Функция получения ключей a, отсутствующих в b
+*/
+func difference(a, b map[string]bool) []string {
+	var result []string
+	for key := range a {
+		if !b[key] {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
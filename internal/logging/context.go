@@ -0,0 +1,28 @@
+package logging
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// Ключ логгера запроса в контексте
+type loggerKey struct{}
+
+/*
+Функция сохранения логгера в контексте
+*/
+func WithContext(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+/*
+Функция получения логгера из контекста.
+Если логгер запроса не задан, возвращается общий логгер.
+*/
+func FromContext(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return Logger
+}
@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"WST_lab6_server/internal/pii"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/*
+Адаптер журнала GORM, записи идут в zap с логгером запроса из контекста
+*/
+type GormLogger struct {
+	level         gormlogger.LogLevel
+	slowThreshold time.Duration
+}
+
+/*
+Функция создания адаптера журнала GORM
+*/
+func NewGormLogger(level gormlogger.LogLevel, slowThreshold time.Duration) *GormLogger {
+	return &GormLogger{level: level, slowThreshold: slowThreshold}
+}
+
+func (l *GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	copied := *l
+	copied.level = level
+	return &copied
+}
+
+func (l *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Info {
+		gormZap(ctx).Info(maskMessage(fmt.Sprintf(msg, args...)))
+	}
+}
+
+func (l *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		gormZap(ctx).Warn(maskMessage(fmt.Sprintf(msg, args...)))
+	}
+}
+
+func (l *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Error {
+		gormZap(ctx).Error(maskMessage(fmt.Sprintf(msg, args...)))
+	}
+}
+
+/*
+Метод фильтрации параметров SQL запроса перед записью в журнал.
+При включенном маскировании email и телефоны в параметрах скрываются.
+*/
+func (l *GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if !pii.MaskLogs() {
+		return sql, params
+	}
+	masked := make([]interface{}, len(params))
+	for i, param := range params {
+		if value, ok := param.(string); ok {
+			masked[i] = pii.MaskString(value)
+			continue
+		}
+		masked[i] = param
+	}
+	return sql, masked
+}
+
+/*
+Метод записи выполненного SQL запроса.
+Ошибки пишутся на уровне error (кроме отсутствия записи), медленные запросы - warn, остальные - debug.
+*/
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	logger := gormZap(ctx)
+	switch {
+	case err != nil && l.level >= gormlogger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		logger.Error("sql query failed", zap.String("sql", sql), zap.Int64("rows", rows),
+			zap.Duration("elapsed", elapsed), maskedError(err))
+	case l.slowThreshold > 0 && elapsed > l.slowThreshold && l.level >= gormlogger.Warn:
+		sql, rows := fc()
+		logger.Warn("slow sql query", zap.String("sql", sql), zap.Int64("rows", rows),
+			zap.Duration("elapsed", elapsed), zap.Duration("threshold", l.slowThreshold))
+	case l.level >= gormlogger.Info && logger.Core().Enabled(zap.DebugLevel):
+		sql, rows := fc()
+		logger.Debug("sql query", zap.String("sql", sql), zap.Int64("rows", rows), zap.Duration("elapsed", elapsed))
+	}
+}
+
+/*
+Функция маскирования email и телефонов в сообщении согласно настройке pii.maskLogs
+*/
+func maskMessage(message string) string {
+	if !pii.MaskLogs() {
+		return message
+	}
+	return pii.MaskString(message)
+}
+
+/*
+Функция поля журнала с ошибкой SQL запроса.
+Текст ошибки базы данных может содержать значения записи (например "Key (email)=(olga@mail.com) already exists"),
+поэтому при включенном маскировании он проходит через pii.MaskString.
+*/
+func maskedError(err error) zap.Field {
+	if !pii.MaskLogs() {
+		return zap.Error(err)
+	}
+	return zap.String("error", pii.MaskString(err.Error()))
+}
+
+/*
+Функция получения логгера для записей GORM
+*/
+func gormZap(ctx context.Context) *zap.Logger {
+	return FromContext(ctx).With(zap.String("component", "gorm"))
+}
@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"WST_lab6_server/config"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/*
+Функция подмены общего логгера наблюдателем с включенным или выключенным маскированием
+*/
+func observeGorm(t *testing.T, maskLogs bool) *observer.ObservedLogs {
+	t.Helper()
+	core, logs := observer.New(zap.DebugLevel)
+	savedLogger, savedMask := Logger, config.PIISetting.MaskLogs
+	t.Cleanup(func() { Logger, config.PIISetting.MaskLogs = savedLogger, savedMask })
+	Logger = zap.New(core)
+	config.PIISetting.MaskLogs = maskLogs
+	return logs
+}
+
+func TestGormErrorMasked(t *testing.T) {
+	logs := observeGorm(t, true)
+	gormLogger := NewGormLogger(gormlogger.Error, 0)
+	err := errors.New(`duplicate key value violates unique constraint "idx_people_email": Key (email)=(olga@mail.com) already exists, telephone +70011234576`)
+	gormLogger.Trace(context.Background(), time.Now(), func() (string, int64) { return "INSERT INTO people", 0 }, err)
+	gormLogger.Error(context.Background(), "failed to save %s", "olga@mail.com")
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("%d entries", len(entries))
+	}
+	logged := entries[0].ContextMap()["error"].(string)
+	if strings.Contains(logged, "olga@mail.com") || strings.Contains(logged, "+70011234576") ||
+		!strings.Contains(logged, "o***@mail.com") || !strings.Contains(logged, "+7*******576") {
+		t.Errorf("error field %q", logged)
+	}
+	if entries[1].Message != "failed to save o***@mail.com" {
+		t.Errorf("message %q", entries[1].Message)
+	}
+}
+
+func TestGormErrorUnmasked(t *testing.T) {
+	logs := observeGorm(t, false)
+	err := errors.New("Key (email)=(olga@mail.com) already exists")
+	NewGormLogger(gormlogger.Error, 0).Trace(context.Background(), time.Now(), func() (string, int64) { return "INSERT INTO people", 0 }, err)
+	if logged := logs.All()[0].ContextMap()["error"]; logged != err.Error() {
+		t.Errorf("error field %q", logged)
+	}
+}
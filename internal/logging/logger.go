@@ -1,28 +1,119 @@
 package logging
 
 import (
+	"WST_lab6_server/config"
+	"fmt"
+	"os"
+	"strings"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"os"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 var Logger *zap.Logger
 
-func InitializeLogger() {
-	config := zap.NewProductionEncoderConfig()
-	config.EncodeTime = zapcore.ISO8601TimeEncoder
-	fileEncoder := zapcore.NewJSONEncoder(config)
-	consoleEncoder := zapcore.NewConsoleEncoder(config)
-	logFile, _ := os.OpenFile(
-		"log.json",
-		os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	writer := zapcore.AddSync(logFile)
-	defaultLogLevel := zapcore.DebugLevel
-	core := zapcore.NewTee(
-		zapcore.NewCore(fileEncoder, writer, defaultLogLevel),
-		zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), defaultLogLevel),
-	)
-	Logger = zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
-	defer Logger.Sync()
+// Уровень журнала, может изменяться во время работы через административный маршрут
+var Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+
+// Вывод журнала по умолчанию: консоль и файл log.json
+var defaultOutputs = []config.LogOutputConfig{
+	{Path: "stdout", Format: "console"},
+	{Path: "log.json", Format: "json"},
+}
+
+/*
+Функция инициализации журнала по настройкам GeneralServerSetting.LogLevel и LoggingSetting
+*/
+func InitializeLogger() error {
+	//Уровень журнала из файла конфигурации
+	if err := SetLevel(config.GeneralServerSetting.LogLevel); err != nil {
+		return err
+	}
+	outputs := config.LoggingSetting.Outputs
+	if len(outputs) == 0 {
+		outputs = defaultOutputs
+	}
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	cores := make([]zapcore.Core, 0, len(outputs))
+	for _, output := range outputs {
+		encoder, err := newEncoder(output.Format, encoderConfig)
+		if err != nil {
+			return err
+		}
+		writer, err := newWriter(output.Path)
+		if err != nil {
+			return err
+		}
+		cores = append(cores, zapcore.NewCore(encoder, writer, Level))
+	}
+	Logger = zap.New(zapcore.NewTee(cores...), zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
+	return nil
+}
+
+/*
+Функция изменения уровня журнала (debug, info, warn, error, fatal)
+*/
+func SetLevel(level string) error {
+	if level == "" {
+		return nil
+	}
+	var zapLevel zapcore.Level
+	if err := zapLevel.UnmarshalText([]byte(strings.ToLower(level))); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	Level.SetLevel(zapLevel)
+	return nil
+}
+
+/*
+Функция выгрузки буферов журнала перед остановкой
+*/
+func Sync() {
+	if Logger != nil {
+		_ = Logger.Sync()
+	}
+}
+
+/*
+Функция создания кодировщика записей: json или console
+*/
+func newEncoder(format string, encoderConfig zapcore.EncoderConfig) (zapcore.Encoder, error) {
+	switch strings.ToLower(format) {
+	case "", "json":
+		return zapcore.NewJSONEncoder(encoderConfig), nil
+	case "console":
+		return zapcore.NewConsoleEncoder(encoderConfig), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
 
+/*
+Функция создания вывода журнала.
+stdout и stderr пишутся напрямую, файлы - с ротацией по размеру и возрасту.
+lumberjack открывает файл при первой записи, поэтому файл открывается сразу:
+недоступный для записи каталог или файл должен остановить запуск, а не терять записи журнала.
+*/
+func newWriter(path string) (zapcore.WriteSyncer, error) {
+	switch path {
+	case "stdout":
+		return zapcore.Lock(os.Stdout), nil
+	case "stderr":
+		return zapcore.Lock(os.Stderr), nil
+	}
+	rotation := config.LoggingSetting.Rotation
+	writer := &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    rotation.MaxSizeMB,
+		MaxAge:     rotation.MaxAgeDays,
+		MaxBackups: rotation.MaxBackups,
+		Compress:   rotation.Compress,
+		LocalTime:  true,
+	}
+	//Пустая запись создает каталог и открывает файл так же, как при ротации
+	if _, err := writer.Write(nil); err != nil {
+		return nil, fmt.Errorf("error opening log file %s: %w", path, err)
+	}
+	return zapcore.AddSync(writer), nil
 }
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"WST_lab6_server/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+Функция подмены настроек вывода журнала
+*/
+func setOutputs(t *testing.T, outputs ...config.LogOutputConfig) {
+	t.Helper()
+	saved, savedLogger := config.LoggingSetting.Outputs, Logger
+	t.Cleanup(func() { config.LoggingSetting.Outputs, Logger = saved, savedLogger })
+	config.LoggingSetting.Outputs = outputs
+}
+
+func TestInitializeLoggerCreatesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "server.json")
+	setOutputs(t, config.LogOutputConfig{Path: path, Format: "json"})
+	if err := InitializeLogger(); err != nil {
+		t.Fatal(err)
+	}
+	//Отсутствующий каталог создается, файл существует до первой записи
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	Logger.Info("started")
+	Sync()
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), `"msg":"started"`) {
+		t.Fatalf("log file %q, %v", data, err)
+	}
+}
+
+func TestInitializeLoggerUnwritablePath(t *testing.T) {
+	//Каталог журнала - обычный файл: создать в нем файл невозможно
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(blocker, "server.json")
+	setOutputs(t, config.LogOutputConfig{Path: "stdout", Format: "console"}, config.LogOutputConfig{Path: path, Format: "json"})
+	err := InitializeLogger()
+	if err == nil || !strings.Contains(err.Error(), path) {
+		t.Fatalf("InitializeLogger: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Ключ времени начала запроса в gorm.DB
+const gormStartKey = "metrics:start"
+
+/*
+Плагин GORM для замера времени выполнения запросов по типу операции
+*/
+type GormPlugin struct{}
+
+func (GormPlugin) Name() string {
+	return "metrics"
+}
+
+// Функция регистрации обратного вызова в цепочке GORM
+type registerFunc func(name string, fn func(*gorm.DB)) error
+
+/*
+Метод подключения функций обратного вызова до и после каждой операции GORM
+*/
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		operation     string
+		before, after registerFunc
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+	for _, hook := range hooks {
+		if err := hook.before("metrics:before_"+hook.operation, startTimer); err != nil {
+			return err
+		}
+		if err := hook.after("metrics:after_"+hook.operation, observe(hook.operation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Функция запоминания времени начала запроса
+*/
+func startTimer(db *gorm.DB) {
+	db.InstanceSet(gormStartKey, time.Now())
+}
+
+/*
+Функция записи времени выполнения запроса в гистограмму
+*/
+func observe(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(gormStartKey)
+		if !ok {
+			return
+		}
+		start, ok := value.(time.Time)
+		if !ok {
+			return
+		}
+		DBQueryDuration.WithLabelValues(operation, db.Statement.Table, strconv.FormatBool(db.Error != nil)).
+			Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,282 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Пространство имен метрик сервера
+const namespace = "wst"
+
+// Время хранения значений метрик, которые считаются запросом COUNT(*) к базе данных
+const countCacheTTL = 30 * time.Second
+
+var (
+	// Количество HTTP запросов по маршруту и статусу
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Total number of HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+	// Время обработки HTTP запросов по маршруту и статусу
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	// Количество обрабатываемых в данный момент запросов
+	HTTPInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Number of HTTP requests currently being served.",
+	})
+	// Время выполнения запросов GORM по типу операции
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Database query latency by GORM operation.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"operation", "table", "error"})
+	// Количество неудачных попыток аутентификации по причине
+	AuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "failures_total",
+		Help:      "Authentication failures by reason.",
+	}, []string{"reason"})
+	// Бизнес события над записями
+	PersonsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "persons",
+		Name:      "created_total",
+		Help:      "Number of persons created.",
+	})
+	PersonsUpdated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "persons",
+		Name:      "updated_total",
+		Help:      "Number of persons updated.",
+	})
+	PersonsDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "persons",
+		Name:      "deleted_total",
+		Help:      "Number of persons deleted.",
+	})
+	// Лента изменений: опубликованные события, активные подписчики и отключенные медленные подписчики
+	EventsPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "published_total",
+		Help:      "Change events published by type.",
+	}, []string{"type"})
+	EventSubscribers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "subscribers",
+		Help:      "Number of active change feed subscribers by transport.",
+	}, []string{"transport"})
+	EventSubscribersDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "subscribers_dropped_total",
+		Help:      "Subscribers disconnected because their event queue was full.",
+	})
+	// Попытки доставки webhook по результату (delivered, retry, dead) и их длительность
+	WebhookAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhooks",
+		Name:      "attempts_total",
+		Help:      "Webhook delivery attempts by result.",
+	}, []string{"result"})
+	WebhookAttemptDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "webhooks",
+		Name:      "attempt_duration_seconds",
+		Help:      "Webhook delivery request latency.",
+		Buckets:   prometheus.DefBuckets,
+	})
+	// События outbox, принятые получателем и отклоненные им (по получателю)
+	OutboxDelivered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "delivered_total",
+		Help:      "Outbox events accepted by a sink.",
+	}, []string{"sink"})
+	OutboxFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "failures_total",
+		Help:      "Outbox events rejected by a sink and scheduled for retry.",
+	}, []string{"sink"})
+	// События outbox, доставка которых прекращена после outbox.maxAttempts попыток
+	OutboxDead = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "dead_total",
+		Help:      "Outbox events given up after outbox.maxAttempts failed attempts.",
+	})
+	// Время от записи события до доставки всем получателям
+	OutboxLag = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "lag_seconds",
+		Help:      "Time from writing an outbox event to dispatching it to all sinks.",
+		Buckets:   prometheus.DefBuckets,
+	})
+	// Обращения к кэшу чтения (person, search) по результату (hit, miss) и вытеснения
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "Read cache lookups by cache and result.",
+	}, []string{"cache", "result"})
+	CacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "evictions_total",
+		Help:      "Entries evicted from the in-memory cache because it was full.",
+	})
+	// Размеры тел до и после сжатия (direction: request, response) и степень сжатия
+	CompressionBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "compression_bytes_total",
+		Help:      "HTTP body bytes before and after content encoding.",
+	}, []string{"direction", "encoding", "stage"})
+	CompressionRatio = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "compression_ratio",
+		Help:      "Uncompressed to compressed size ratio of HTTP bodies.",
+		Buckets:   []float64{1, 1.5, 2, 3, 4, 6, 8, 12, 16, 32},
+	}, []string{"direction", "encoding"})
+)
+
+// Реестр метрик сервера
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		HTTPInFlight,
+		DBQueryDuration,
+		AuthFailures,
+		PersonsCreated,
+		PersonsUpdated,
+		PersonsDeleted,
+		EventsPublished,
+		EventSubscribers,
+		EventSubscribersDropped,
+		WebhookAttempts,
+		WebhookAttemptDuration,
+		OutboxDelivered,
+		OutboxFailures,
+		OutboxDead,
+		OutboxLag,
+		CacheRequests,
+		CacheEvictions,
+		CompressionBytes,
+		CompressionRatio,
+	)
+}
+
+/*
+Функция регистрации метрик пула соединений с базой данных
+*/
+func RegisterDBStats(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+/*
+Функция регистрации метрики общего количества записей.
+Значение запрашивается не чаще одного раза в countCacheTTL.
+*/
+func RegisterPersonsCount(count func(ctx context.Context) (int64, error)) {
+	Registry.MustRegister(&countCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "persons", "total"),
+			"Current number of persons in the database.",
+			nil, nil),
+		count:   count,
+		timeout: 2 * time.Second,
+		ttl:     countCacheTTL,
+	})
+}
+
+/*
+Функция регистрации метрики количества недоставленных событий outbox
+*/
+func RegisterOutboxPending(count func(ctx context.Context) (int64, error)) {
+	Registry.MustRegister(&countCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "outbox", "pending"),
+			"Outbox events not yet dispatched to all sinks.",
+			nil, nil),
+		count:   count,
+		timeout: 2 * time.Second,
+		ttl:     countCacheTTL,
+	})
+}
+
+/*
+Сборщик метрики количества записей.
+Последнее успешное значение хранится ttl, чтобы частые или параллельные сборы
+не нагружали базу данных запросами COUNT(*).
+*/
+type countCollector struct {
+	desc    *prometheus.Desc
+	count   func(ctx context.Context) (int64, error)
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu        sync.Mutex
+	value     int64
+	updatedAt time.Time
+}
+
+func (c *countCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *countCollector) Collect(ch chan<- prometheus.Metric) {
+	count, err := c.current()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count))
+}
+
+/*
+Функция получения значения метрики: из кэша или запросом к базе данных, если кэш устарел.
+Параллельные сборы ждут один запрос, ошибки не кэшируются.
+*/
+func (c *countCollector) current() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.updatedAt.IsZero() && time.Since(c.updatedAt) < c.ttl {
+		return c.value, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	count, err := c.count(ctx)
+	if err != nil {
+		return 0, err
+	}
+	c.value, c.updatedAt = count, time.Now()
+	return count, nil
+}
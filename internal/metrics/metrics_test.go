@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCountCollectorCached(t *testing.T) {
+	var calls int
+	var fail bool
+	collector := &countCollector{
+		desc: prometheus.NewDesc("wst_test_total", "Test count.", nil, nil),
+		count: func(ctx context.Context) (int64, error) {
+			calls++
+			if fail {
+				return 0, errors.New("database is down")
+			}
+			return int64(calls * 10), nil
+		},
+		timeout: time.Second,
+		ttl:     time.Hour,
+	}
+	//Параллельные сборы в пределах ttl выполняют один запрос
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value := testutil.ToFloat64(collector); value != 10 {
+				t.Errorf("value %v", value)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("%d queries", calls)
+	}
+	//Устаревшее значение запрашивается заново, ошибка не кэшируется
+	collector.updatedAt = time.Now().Add(-2 * time.Hour)
+	fail = true
+	if _, err := collector.current(); err == nil || calls != 2 {
+		t.Fatalf("current: %v after %d queries", err, calls)
+	}
+	fail = false
+	if value := testutil.ToFloat64(collector); value != 30 || calls != 3 {
+		t.Errorf("value %v after %d queries", value, calls)
+	}
+}
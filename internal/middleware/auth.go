@@ -1,30 +1,86 @@
 package middleware
 
 import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/metrics"
+	"WST_lab6_server/internal/models"
+	"WST_lab6_server/internal/tracing"
+	"context"
 	"encoding/base64"
 
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var validUsers = map[string]string{
-	"root": "$2a$10$PbueWoNyctbsSD0b52FXvuDz4y2hDQ3z5HE.Sqi9eJIul6Mc7xnt2",
+// Роли пользователей
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// Ключ роли пользователя в gin.Context
+const RoleKey = "role"
+
+// Пользователь по умолчанию, если в конфигурации не указаны пользователи
+var defaultUsers = []config.UserConfig{
+	{Username: "root", PasswordHash: "$2a$10$PbueWoNyctbsSD0b52FXvuDz4y2hDQ3z5HE.Sqi9eJIul6Mc7xnt2", Role: RoleAdmin},
+}
+
+/*
+Хранилище пользователей, созданных командой user add (таблица users)
+*/
+type UserStore interface {
+	GetUser(ctx context.Context, username string) (*models.User, error)
+}
+
+// Хранилище пользователей; nil - только пользователи из конфигурации
+var userStore UserStore
+
+// Подключаем хранилище пользователей
+func SetUserStore(store UserStore) {
+	userStore = store
 }
 
 // Проверяем базовую аутентификацию
 func BasicAuthMiddleware() gin.HandlerFunc {
+	return basicAuth(false)
+}
+
+// Проверяем базовую аутентификацию, если она передана; без заголовка запрос выполняется с анонимной ролью
+func OptionalBasicAuthMiddleware() gin.HandlerFunc {
+	return basicAuth(true)
+}
+
+func basicAuth(optional bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		auth := c.Request.Header.Get("Authorization")
+		if auth == "" && optional {
+			c.Set(RoleKey, AnonymousRole())
+			c.Next()
+			return
+		}
+		//Спан охватывает только проверку учетных данных
+		_, span := tracing.Tracer().Start(c.Request.Context(), "middleware.BasicAuth")
+		defer span.End()
 		if auth == "" {
+			metrics.AuthFailures.WithLabelValues("missing_header").Inc()
+			span.SetStatus(codes.Error, "missing_header")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is missing"})
 			c.Abort()
 			return
 		}
 
 		if !strings.HasPrefix(auth, "Basic ") {
+			metrics.AuthFailures.WithLabelValues("invalid_format").Inc()
+			span.SetStatus(codes.Error, "invalid_format")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
 			c.Abort()
 			return
@@ -33,12 +89,20 @@ func BasicAuthMiddleware() gin.HandlerFunc {
 		payload := strings.TrimPrefix(auth, "Basic ")
 		username, password := decodeBasicAuth(payload)
 
-		if !isValidUser(username, password) {
+		span.SetAttributes(attribute.String("enduser.id", username))
+		role, ok := Authenticate(c.Request.Context(), username, password)
+		if !ok {
+			metrics.AuthFailures.WithLabelValues("invalid_credentials").Inc()
+			span.SetStatus(codes.Error, "invalid_credentials")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 			c.Abort()
 			return
 		}
 
+		span.SetAttributes(attribute.String("enduser.role", role))
+		c.Set(RoleKey, role)
+		SetRequestUser(c, username)
+		span.End()
 		c.Next()
 	}
 }
@@ -56,12 +120,89 @@ func decodeBasicAuth(payload string) (string, string) {
 	return "", ""
 }
 
-// Проверяем данные пользователя
-func isValidUser(username, password string) bool {
-	if validPasswordHash, exists := validUsers[username]; exists {
-		err := bcrypt.CompareHashAndPassword([]byte(validPasswordHash), []byte(password))
-		return err == nil
+// Разбираем значение заголовка Authorization со схемой Basic (используется и в gRPC)
+func ParseBasicAuth(auth string) (username, password string, ok bool) {
+	if !strings.HasPrefix(auth, "Basic ") {
+		return "", "", false
+	}
+	username, password = decodeBasicAuth(strings.TrimPrefix(auth, "Basic "))
+	return username, password, true
+}
+
+// Проверяем данные пользователя и возвращаем его роль.
+// Пользователи из конфигурации имеют приоритет над пользователями из базы данных.
+func Authenticate(ctx context.Context, username, password string) (string, bool) {
+	users := config.AuthSetting.Users
+	if len(users) == 0 {
+		users = defaultUsers
+	}
+	for _, user := range users {
+		if user.Username != username {
+			continue
+		}
+		err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+		if err != nil {
+			return "", false
+		}
+		if user.Role == "" {
+			return RoleAdmin, true
+		}
+		return user.Role, true
+	}
+	if userStore == nil || username == "" {
+		return "", false
+	}
+	user, err := userStore.GetUser(ctx, username)
+	if err != nil {
+		logging.FromContext(ctx).Debug("user lookup failed", zap.String("username", username), zap.Error(err))
+		return "", false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return "", false
+	}
+	return user.Role, true
+}
+
+// Роль запросов без учетных данных
+func AnonymousRole() string {
+	if config.AuthSetting.AnonymousRole == "" {
+		return RoleViewer
+	}
+	return config.AuthSetting.AnonymousRole
+}
+
+// Роль пользователя текущего запроса
+func RequestRole(c *gin.Context) string {
+	if role := c.GetString(RoleKey); role != "" {
+		return role
+	}
+	return AnonymousRole()
+}
+
+// Роли, которым разрешено изменять записи
+var WriteRoles = []string{RoleAdmin, RoleEditor}
+
+// Проверяем, что роль входит в список разрешенных
+func HasRole(role string, allowed ...string) bool {
+	for _, candidate := range allowed {
+		if role == candidate {
+			return true
+		}
 	}
 	return false
+}
 
+// Проверяем роль пользователя (подключается после BasicAuthMiddleware).
+// Запрос с другой ролью отклоняется со статусом Forbidden (403).
+func RequireRole(allowed ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := RequestRole(c)
+		if !HasRole(role, allowed...) {
+			metrics.AuthFailures.WithLabelValues("forbidden").Inc()
+			logging.FromContext(c.Request.Context()).Info("access denied", zap.String("role", role), zap.Strings("required", allowed))
+			AbortWithProblem(c, http.StatusForbidden, "Role "+role+" is not allowed to perform this request.")
+			return
+		}
+		c.Next()
+	}
 }
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"WST_lab6_server/config"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+Middleware заголовка Cache-Control по шаблону маршрута (httpServer.cacheControl).
+Заголовок добавляется только к успешным ответам и 304 на GET и HEAD,
+чтобы ошибки не сохранялись в кэшах клиентов и прокси.
+*/
+func CacheControlMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		policy, ok := config.HTTPServerSetting.CacheControl[c.FullPath()]
+		if !ok || policy == "" {
+			c.Next()
+			return
+		}
+		writer := &cacheControlWriter{ResponseWriter: c.Writer, policy: policy}
+		c.Writer = writer
+		c.Next()
+		//Ответ без тела (304) отправляется gin после обработчиков, минуя обертку
+		writer.setHeader()
+	}
+}
+
+/*
+Обертка ответа: Cache-Control устанавливается непосредственно перед отправкой заголовков,
+когда статус ответа уже известен
+*/
+type cacheControlWriter struct {
+	gin.ResponseWriter
+	policy string
+}
+
+func (w *cacheControlWriter) setHeader() {
+	if w.ResponseWriter.Written() {
+		return
+	}
+	status := w.ResponseWriter.Status()
+	if status < http.StatusBadRequest && w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", w.policy)
+	}
+}
+
+func (w *cacheControlWriter) WriteHeaderNow() {
+	w.setHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *cacheControlWriter) Write(data []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *cacheControlWriter) WriteString(s string) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *cacheControlWriter) Flush() {
+	w.setHeader()
+	w.ResponseWriter.Flush()
+}
@@ -0,0 +1,396 @@
+package middleware
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/metrics"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// Значения по умолчанию
+const (
+	defaultMinCompressSize     = 1024
+	defaultMaxDecompressedSize = 32 << 20
+)
+
+// Сжимаемые типы содержимого по умолчанию
+var defaultCompressibleTypes = []string{"application/json", "application/problem+json", "application/x-ndjson", "application/yaml", "application/xml", "text/*"}
+
+// Поддерживаемые кодировки в порядке предпочтения сервера при равном q
+var supportedEncodings = []string{"br", "gzip", "deflate"}
+
+/*
+Кодировщики переиспользуются между запросами: создание кодировщика brotli и gzip дороже самого сжатия небольших ответов
+*/
+var encoderPools = map[string]*sync.Pool{
+	"br": {New: func() any {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}},
+	"gzip": {New: func() any {
+		return gzip.NewWriter(nil)
+	}},
+	"deflate": {New: func() any {
+		writer, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return writer
+	}},
+}
+
+/*
+Кодировщик потока ответа
+*/
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+/*
+Middleware сжатия ответов и распаковки тел запросов.
+Кодировка ответа выбирается по Accept-Encoding (br, gzip, deflate с учетом q); сжимаются ответы
+разрешенных типов от minSize байт. Тело POST, PUT и PATCH с Content-Encoding распаковывается
+до передачи обработчику с ограничением размера maxDecompressedSize.
+*/
+func CompressionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, ok := decompressRequest(c)
+		if !ok {
+			return
+		}
+		if body != nil {
+			defer body.observe()
+		}
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		//HEAD без тела, WebSocket передает кадры без HTTP кодирования
+		if encoding == "" || c.Request.Method == http.MethodHead || strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+			c.Next()
+			return
+		}
+		writer := &compressWriter{ResponseWriter: c.Writer, encoding: encoding}
+		c.Writer = writer
+		c.Next()
+		writer.finish()
+		//Ответы, записываемые после обработки запроса внешними middleware, идут без сжатия
+		c.Writer = writer.ResponseWriter
+	}
+}
+
+/*
+Функция распаковки тела запроса. Возвращает false, если ответ с ошибкой уже отправлен.
+*/
+func decompressRequest(c *gin.Context) (*decompressedBody, bool) {
+	contentEncoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+	if contentEncoding == "" || contentEncoding == "identity" || c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return nil, true
+	}
+	switch c.Request.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return nil, true
+	}
+	compressed := &countingReader{reader: c.Request.Body}
+	var decoder io.Reader
+	var err error
+	switch contentEncoding {
+	case "gzip", "x-gzip":
+		decoder, err = gzip.NewReader(compressed)
+	case "deflate":
+		decoder = flate.NewReader(compressed)
+	case "br":
+		decoder = brotli.NewReader(compressed)
+	default:
+		c.Header("Accept-Encoding", "gzip, deflate, br")
+		AbortWithProblem(c, http.StatusUnsupportedMediaType, "Content-Encoding "+contentEncoding+" is not supported.")
+		return nil, false
+	}
+	if err != nil {
+		AbortWithProblem(c, http.StatusBadRequest, "Request body is not valid "+contentEncoding+" data.")
+		return nil, false
+	}
+	limit := config.CompressionSetting.MaxDecompressedSize
+	if limit <= 0 {
+		limit = defaultMaxDecompressedSize
+	}
+	body := &decompressedBody{reader: decoder, closer: c.Request.Body, compressed: compressed, encoding: contentEncoding}
+	//Распакованное тело ограничивается, чтобы небольшой запрос не развернулся в гигабайты
+	c.Request.Body = http.MaxBytesReader(c.Writer, body, limit)
+	c.Request.Header.Del("Content-Encoding")
+	c.Request.Header.Del("Content-Length")
+	c.Request.ContentLength = -1
+	return body, true
+}
+
+/*
+Функция выбора кодировки ответа по Accept-Encoding.
+Кодировка с q=0 запрещена, "*" относится ко всем не названным кодировкам.
+*/
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+	weights := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		weight := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		if name == "*" {
+			wildcard = weight
+			continue
+		}
+		if name == "x-gzip" {
+			name = "gzip"
+		}
+		weights[name] = weight
+	}
+	best, bestWeight := "", 0.0
+	for _, name := range supportedEncodings {
+		weight, ok := weights[name]
+		if !ok {
+			weight = wildcard
+		}
+		if weight > bestWeight {
+			best, bestWeight = name, weight
+		}
+	}
+	return best
+}
+
+/*
+Функция проверки типа содержимого по списку compression.contentTypes.
+Поток событий SSE не сжимается: события должны доходить до клиента сразу.
+*/
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "text/event-stream" {
+		return false
+	}
+	allowed := config.CompressionSetting.ContentTypes
+	if len(allowed) == 0 {
+		allowed = defaultCompressibleTypes
+	}
+	for _, pattern := range allowed {
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Обертка ответа со сжатием. Начало ответа накапливается, пока не станет ясно,
+достигает ли он minSize; потоковые ответы (Flush) сжимаются сразу.
+*/
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	buffer   bytes.Buffer
+	//Решение принято: ответ сжимается (encoder != nil) или передается как есть
+	decided bool
+	encoder encoder
+	counter *countingWriter
+	//Размер ответа до сжатия
+	written int64
+	//Обработчик завершил ответ
+	finished bool
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	//Заголовки отправляются вместе с телом: статус фиксируется при первой записи
+	w.written += int64(len(data))
+	if !w.decided {
+		w.buffer.Write(data)
+		if w.buffer.Len() < minCompressSize() {
+			return len(data), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+/*
+Запись тела уже начата, даже если байты еще в буфере: обработчик не должен
+после этого отправлять другой ответ
+*/
+func (w *compressWriter) Written() bool {
+	return w.written > 0 || w.ResponseWriter.Written()
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided && w.written == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		//Размер потока заранее неизвестен: сжимаем, если позволяет тип содержимого
+		_ = w.decide()
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+/*
+Метод выбора: сжимать ли ответ. Накопленное начало ответа передается в выбранном виде.
+*/
+func (w *compressWriter) decide() error {
+	w.decided = true
+	header := w.Header()
+	status := w.Status()
+	if header.Get("Content-Encoding") == "" && status != http.StatusNoContent && status != http.StatusNotModified &&
+		status >= http.StatusOK && compressible(header.Get("Content-Type")) {
+		header.Add("Vary", "Accept-Encoding")
+		if !w.belowMinSize() {
+			header.Set("Content-Encoding", w.encoding)
+			header.Del("Content-Length")
+			w.counter = &countingWriter{writer: w.ResponseWriter}
+			w.encoder = encoderPools[w.encoding].Get().(encoder)
+			w.encoder.Reset(w.counter)
+		}
+	}
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(w.buffer.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buffer.Bytes())
+	}
+	w.buffer.Reset()
+	return err
+}
+
+/*
+Метод проверки, что ответ целиком меньше minSize (ответ завершен, а буфер не заполнен)
+*/
+func (w *compressWriter) belowMinSize() bool {
+	return w.finished && w.buffer.Len() < minCompressSize()
+}
+
+/*
+Метод завершения ответа: отправка накопленного начала и закрытие кодировщика
+*/
+func (w *compressWriter) finish() {
+	w.finished = true
+	if !w.decided {
+		_ = w.decide()
+	}
+	if w.encoder == nil {
+		return
+	}
+	_ = w.encoder.Close()
+	w.encoder.Reset(nil)
+	encoderPools[w.encoding].Put(w.encoder)
+	w.encoder = nil
+	observeCompression("response", w.encoding, w.written, w.counter.count)
+}
+
+func minCompressSize() int {
+	if config.CompressionSetting.MinSize > 0 {
+		return config.CompressionSetting.MinSize
+	}
+	return defaultMinCompressSize
+}
+
+/*
+Функция учета размеров до и после сжатия
+*/
+func observeCompression(direction string, encoding string, uncompressed int64, compressed int64) {
+	metrics.CompressionBytes.WithLabelValues(direction, encoding, "uncompressed").Add(float64(uncompressed))
+	metrics.CompressionBytes.WithLabelValues(direction, encoding, "compressed").Add(float64(compressed))
+	if uncompressed > 0 && compressed > 0 {
+		metrics.CompressionRatio.WithLabelValues(direction, encoding).Observe(float64(uncompressed) / float64(compressed))
+	}
+}
+
+/*
+Счетчик байт, переданных клиенту после сжатия
+*/
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	n, err := w.writer.Write(data)
+	w.count += int64(n)
+	return n, err
+}
+
+/*
+Счетчик байт, прочитанных из сжатого тела запроса
+*/
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(data []byte) (int, error) {
+	n, err := r.reader.Read(data)
+	r.count += int64(n)
+	return n, err
+}
+
+/*
+Распакованное тело запроса
+*/
+type decompressedBody struct {
+	reader     io.Reader
+	closer     io.Closer
+	compressed *countingReader
+	encoding   string
+	count      int64
+}
+
+func (b *decompressedBody) Read(data []byte) (int, error) {
+	n, err := b.reader.Read(data)
+	b.count += int64(n)
+	return n, err
+}
+
+func (b *decompressedBody) Close() error {
+	return b.closer.Close()
+}
+
+/*
+Метод учета степени сжатия прочитанной части тела запроса
+*/
+func (b *decompressedBody) observe() {
+	if b.count > 0 {
+		observeCompression("request", b.encoding, b.count, b.compressed.count)
+	}
+}
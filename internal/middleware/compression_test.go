@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"WST_lab6_server/config"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// Ответ больше minSize по умолчанию
+var largeBody = strings.Repeat(`{"name":"Ivan","surname":"Ivanov"}`, 100)
+
+func newCompressionEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(CompressionMiddleware())
+	engine.GET("/large", func(c *gin.Context) { c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(largeBody)) })
+	engine.HEAD("/large", func(c *gin.Context) { c.Data(http.StatusOK, "application/json", []byte(largeBody)) })
+	engine.GET("/small", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"id": 1}) })
+	engine.GET("/binary", func(c *gin.Context) { c.Data(http.StatusOK, "image/png", []byte(largeBody)) })
+	engine.GET("/events", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.String(http.StatusOK, largeBody)
+		c.Writer.Flush()
+	})
+	engine.GET("/not-modified", func(c *gin.Context) { c.Status(http.StatusNotModified) })
+	engine.POST("/echo", func(c *gin.Context) {
+		data, err := io.ReadAll(c.Request.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.String(http.StatusRequestEntityTooLarge, "limit %d", tooLarge.Limit)
+			return
+		}
+		c.Data(http.StatusOK, "text/plain", data)
+	})
+	return engine
+}
+
+func serve(engine *gin.Engine, method string, path string, acceptEncoding string, body io.Reader, contentEncoding string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, body)
+	if acceptEncoding != "" {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	if contentEncoding != "" {
+		request.Header.Set("Content-Encoding", contentEncoding)
+	}
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                          "",
+		"identity":                  "",
+		"gzip":                      "gzip",
+		"x-gzip":                    "gzip",
+		"gzip, deflate, br":         "br",
+		"gzip;q=1, br;q=0.5":        "gzip",
+		"br;q=0, gzip;q=0.1":        "gzip",
+		"*":                         "br",
+		"*;q=0.5, br;q=0, gzip;q=0": "deflate",
+		"gzip;q=0, *;q=0":           "",
+		"compress, zstd":            "",
+	}
+	for header, want := range tests {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompressResponse(t *testing.T) {
+	engine := newCompressionEngine()
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		"deflate": func(r io.Reader) (io.Reader, error) {
+			return flate.NewReader(r), nil
+		},
+	}
+	for encoding, decode := range decoders {
+		recorder := serve(engine, http.MethodGet, "/large", encoding, nil, "")
+		if recorder.Header().Get("Content-Encoding") != encoding || recorder.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("%s: headers %v", encoding, recorder.Header())
+		}
+		reader, err := decode(recorder.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil || string(data) != largeBody {
+			t.Errorf("%s: body does not round-trip: %v", encoding, err)
+		}
+		if recorder.Body.Len() >= len(largeBody) {
+			t.Errorf("%s: response was not compressed", encoding)
+		}
+	}
+}
+
+func TestCompressionSkipped(t *testing.T) {
+	engine := newCompressionEngine()
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		accept string
+	}{
+		{"no Accept-Encoding", http.MethodGet, "/large", ""},
+		{"below minSize", http.MethodGet, "/small", "gzip"},
+		{"content type not allowed", http.MethodGet, "/binary", "gzip"},
+		{"event stream", http.MethodGet, "/events", "gzip"},
+		{"not modified", http.MethodGet, "/not-modified", "gzip"},
+		{"HEAD", http.MethodHead, "/large", "gzip"},
+	}
+	for _, test := range tests {
+		recorder := serve(engine, test.method, test.path, test.accept, nil, "")
+		if encoding := recorder.Header().Get("Content-Encoding"); encoding != "" {
+			t.Errorf("%s: Content-Encoding %q", test.name, encoding)
+		}
+	}
+	if recorder := serve(engine, http.MethodGet, "/not-modified", "gzip", nil, ""); recorder.Code != http.StatusNotModified || recorder.Body.Len() != 0 {
+		t.Errorf("not modified: status %d, body %q", recorder.Code, recorder.Body)
+	}
+	if recorder := serve(engine, http.MethodGet, "/small", "gzip", nil, ""); recorder.Body.String() != `{"id":1}` {
+		t.Errorf("below minSize: body %q", recorder.Body)
+	}
+}
+
+func TestDecompressRequest(t *testing.T) {
+	engine := newCompressionEngine()
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(largeBody))
+	writer.Close()
+	recorder := serve(engine, http.MethodPost, "/echo", "", bytes.NewReader(compressed.Bytes()), "gzip")
+	if recorder.Code != http.StatusOK || recorder.Body.String() != largeBody {
+		t.Fatalf("gzip body: status %d", recorder.Code)
+	}
+	if recorder := serve(engine, http.MethodPost, "/echo", "", strings.NewReader("data"), "zstd"); recorder.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("unknown encoding: status %d", recorder.Code)
+	}
+	if recorder := serve(engine, http.MethodPost, "/echo", "", strings.NewReader("not gzip"), "gzip"); recorder.Code != http.StatusBadRequest {
+		t.Errorf("invalid gzip: status %d", recorder.Code)
+	}
+}
+
+func TestDecompressedSizeLimit(t *testing.T) {
+	saved := config.CompressionSetting.MaxDecompressedSize
+	t.Cleanup(func() { config.CompressionSetting.MaxDecompressedSize = saved })
+	config.CompressionSetting.MaxDecompressedSize = 1024
+	//Небольшое сжатое тело, которое разворачивается в 1 МБ
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(make([]byte, 1<<20))
+	writer.Close()
+	recorder := serve(newCompressionEngine(), http.MethodPost, "/echo", "", bytes.NewReader(compressed.Bytes()), "gzip")
+	if recorder.Code != http.StatusRequestEntityTooLarge || recorder.Body.String() != "limit 1024" {
+		t.Fatalf("status %d: %s", recorder.Code, recorder.Body)
+	}
+}
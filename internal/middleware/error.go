@@ -2,9 +2,12 @@ package middleware
 
 import (
 	"WST_lab6_server/internal/models"
+	"WST_lab6_server/internal/tracing"
 	"net/http"
-   
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ErrorHandler - middleware для обработки ошибок
@@ -25,7 +28,11 @@ func ErrorHandler() gin.HandlerFunc {
 
         // Обработка ошибок после выполнения запроса
         if len(c.Errors) > 0 {
+            _, span := tracing.Tracer().Start(c.Request.Context(), "middleware.ErrorHandler")
+            defer span.End()
+            span.SetAttributes(attribute.Int("gin.errors", len(c.Errors)))
             for _, err := range c.Errors {
+                span.RecordError(err.Err)
                 var status int
                 var title string
 
@@ -54,4 +61,36 @@ func ErrorHandler() gin.HandlerFunc {
             }
         }
     }
-}
\ No newline at end of file
+}
+
+/*
+Функция ответа об ошибке в формате application/problem+json с прерыванием обработки запроса
+*/
+func AbortWithProblem(c *gin.Context, status int, detail string) {
+	c.Header("Content-Type", "application/problem+json")
+	c.AbortWithStatusJSON(status, newProblem(c, status, detail))
+}
+
+/*
+Функция ответа об ошибке со списком нарушений в формате application/problem+json
+*/
+func AbortWithViolations(c *gin.Context, status int, detail string, violations []models.Violation) {
+	problem := newProblem(c, status, detail)
+	problem.Errors = violations
+	c.Header("Content-Type", "application/problem+json")
+	c.AbortWithStatusJSON(status, problem)
+}
+
+/*
+Функция создания описания ошибки по статусу ответа
+*/
+func newProblem(c *gin.Context, status int, detail string) models.ErrorResponse {
+	title := http.StatusText(status)
+	return models.ErrorResponse{
+		Type:     "/errors/" + strings.ReplaceAll(strings.ToLower(title), " ", "-"),
+		Title:    title,
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Request.RequestURI,
+	}
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"WST_lab6_server/internal/logging"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Заголовок идентификатора запроса
+const RequestIDHeader = "X-Request-ID"
+
+// Ключи значений в gin.Context
+const (
+	RequestIDKey = "requestID"
+	UserKey      = "user"
+)
+
+// Допустимый идентификатор запроса от клиента
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+/*
+Middleware идентификатора запроса и структурированного журнала.
+Принимает X-Request-ID от клиента или создает новый, возвращает его в ответе,
+сохраняет в контексте логгер запроса и пишет одну строку журнала на запрос.
+*/
+func RequestLoggerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := RequestID(c.GetHeader(RequestIDHeader))
+		c.Header(RequestIDHeader, requestID)
+		c.Set(RequestIDKey, requestID)
+
+		//Логгер запроса с идентификатором, маршрутом и трассой
+		fields := []zap.Field{
+			zap.String("request_id", requestID),
+			zap.String("method", c.Request.Method),
+			zap.String("route", c.FullPath()),
+		}
+		if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.HasTraceID() {
+			fields = append(fields, zap.String("trace_id", spanContext.TraceID().String()))
+		}
+		logger := logging.Logger.With(fields...)
+		c.Request = c.Request.WithContext(logging.WithContext(c.Request.Context(), logger))
+
+		c.Next()
+
+		//Строка журнала доступа
+		logger = logging.FromContext(c.Request.Context())
+		status := c.Writer.Status()
+		accessFields := []zap.Field{
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("client_ip", c.ClientIP()),
+			zap.Int("bytes", c.Writer.Size()),
+			zap.String("user_agent", c.Request.UserAgent()),
+		}
+		if len(c.Errors) > 0 {
+			accessFields = append(accessFields, zap.String("errors", c.Errors.String()))
+		}
+		switch {
+		case status >= 500:
+			logger.Error("request", accessFields...)
+		case status >= 400:
+			logger.Warn("request", accessFields...)
+		default:
+			logger.Info("request", accessFields...)
+		}
+	}
+}
+
+/*
+Функция добавления пользователя в логгер запроса (используется и при проверке WS-Security в SOAP)
+*/
+func SetRequestUser(c *gin.Context, username string) {
+	c.Set(UserKey, username)
+	logger := logging.FromContext(c.Request.Context()).With(zap.String("user", username))
+	c.Request = c.Request.WithContext(logging.WithContext(c.Request.Context(), logger))
+}
+
+/*
+Функция выбора идентификатора запроса: значение клиента, если оно допустимо, иначе новый.
+Используется и для запросов gRPC (метаданные x-request-id).
+*/
+func RequestID(value string) string {
+	if requestIDPattern.MatchString(value) {
+		return value
+	}
+	return newRequestID()
+}
+
+/*
+Функция создания случайного идентификатора запроса
+*/
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/openapi"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+/*
+Middleware проверки параметров пути, запроса и тела по документу OpenAPI.
+При нарушениях возвращает Bad Request (400) в формате application/problem+json со списком всех нарушений.
+*/
+func OpenAPIValidationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		violations, found, err := openapi.ValidateRequest(c.Request.Context(), c.Request)
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Error("openapi document is invalid", zap.Error(err))
+			AbortWithProblem(c, http.StatusInternalServerError, "Request validation is unavailable.")
+			return
+		}
+		if found && len(violations) > 0 {
+			//Тело не прочитано до конца из-за ограничения размера, нарушения схемы не показательны
+			if AbortIfBodyTooLarge(c, nil) {
+				return
+			}
+			AbortWithViolations(c, http.StatusBadRequest, "Request does not match the API specification.", violations)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func newValidationEngine() *gin.Engine {
+	logging.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(OpenAPIValidationMiddleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	engine.GET("/api/v1/persons", ok)
+	engine.POST("/api/v1/persons", ok)
+	engine.GET("/api/v1/person/:id", ok)
+	engine.PUT("/api/v1/person/:id", ok)
+	engine.GET("/api/v1/persons/events", ok)
+	engine.GET("/undocumented", ok)
+	return engine
+}
+
+func TestOpenAPIValidationMiddleware(t *testing.T) {
+	engine := newValidationEngine()
+	validPerson := `{"name":"Olga","surname":"Ditr","age":34,"email":"olga@mail.com","telephone":"+70011234576"}`
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		status     int
+		violations []models.Violation
+	}{
+		{"valid query", http.MethodGet, "/api/v1/persons?query=Olga&format=csv", "", http.StatusNoContent, nil},
+		{"valid body", http.MethodPost, "/api/v1/persons", validPerson, http.StatusNoContent, nil},
+		{"undocumented route", http.MethodGet, "/undocumented?id=x", "", http.StatusNoContent, nil},
+		{"path", http.MethodGet, "/api/v1/person/abc", "", http.StatusBadRequest,
+			[]models.Violation{{In: "path", Name: "id"}}},
+		{"query", http.MethodGet, "/api/v1/persons?query=Olga&format=pdf", "", http.StatusBadRequest,
+			[]models.Violation{{In: "query", Name: "format"}}},
+		{"several query", http.MethodGet, "/api/v1/persons/events?type=moved&personId=0", "", http.StatusBadRequest,
+			[]models.Violation{{In: "query", Name: "type"}, {In: "query", Name: "personId"}}},
+		{"body", http.MethodPost, "/api/v1/persons",
+			`{"name":"Olga","surname":"Ditr","age":-1,"email":"olga","telephone":"+70011234576"}`, http.StatusBadRequest,
+			[]models.Violation{{In: "body", Name: "/age"}, {In: "body", Name: "/email"}}},
+		{"missing fields", http.MethodPost, "/api/v1/persons", `{"name":"Olga"}`, http.StatusBadRequest,
+			[]models.Violation{{In: "body", Name: "/surname"}, {In: "body", Name: "/age"}, {In: "body", Name: "/email"}, {In: "body", Name: "/telephone"}}},
+		{"path and body", http.MethodPut, "/api/v1/person/abc",
+			`{"name":"Olga","surname":"Ditr","age":"old","email":"olga@mail.com","telephone":"+70011234576"}`, http.StatusBadRequest,
+			[]models.Violation{{In: "path", Name: "id"}, {In: "body", Name: "/age"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+			if test.body != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, request)
+			if recorder.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", recorder.Code, test.status, recorder.Body)
+			}
+			if test.status != http.StatusBadRequest {
+				return
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != "application/problem+json" {
+				t.Errorf("content type %q", contentType)
+			}
+			var problem models.ErrorResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Status != http.StatusBadRequest || problem.Title != "Bad Request" ||
+				problem.Type != "/errors/bad-request" || problem.Instance != test.target {
+				t.Errorf("problem: %+v", problem)
+			}
+			//Все нарушения возвращаются одним ответом, порядок не важен
+			if len(problem.Errors) != len(test.violations) {
+				t.Fatalf("violations %+v, want %+v", problem.Errors, test.violations)
+			}
+			for _, want := range test.violations {
+				if !hasViolation(problem.Errors, want) {
+					t.Errorf("violation %+v not found in %+v", want, problem.Errors)
+				}
+			}
+		})
+	}
+}
+
+/*
+Функция поиска нарушения по месту и имени
+*/
+func hasViolation(violations []models.Violation, want models.Violation) bool {
+	for _, v := range violations {
+		if v.In == want.In && v.Name == want.Name && v.Message != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,11 @@
+package models
+
+// Условия выборки записей: строковые поля ищутся по вхождению, возраст по диапазону (nil - без ограничения)
+type PersonFilter struct {
+	Name      string
+	Surname   string
+	Email     string
+	Telephone string
+	AgeMin    *int
+	AgeMax    *int
+}
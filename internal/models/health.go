@@ -0,0 +1,36 @@
+package models
+
+// Состояния проверок
+const (
+	HealthStatusUp   = "up"
+	HealthStatusDown = "down"
+)
+
+// Структура отчета о состоянии сервера и его зависимостей
+type HealthReport struct {
+	Status       string                 `json:"status"`
+	Uptime       string                 `json:"uptime"`
+	ShuttingDown bool                   `json:"shuttingDown"`
+	Checks       map[string]CheckResult `json:"checks"`
+}
+
+// Структура результата проверки одной зависимости
+type CheckResult struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+// Структура статистики пула соединений
+type PoolStats struct {
+	MaxOpenConnections int    `json:"maxOpenConnections"`
+	OpenConnections    int    `json:"openConnections"`
+	InUse              int    `json:"inUse"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"waitCount"`
+	WaitDuration       string `json:"waitDuration"`
+	MaxIdleClosed      int64  `json:"maxIdleClosed"`
+	MaxIdleTimeClosed  int64  `json:"maxIdleTimeClosed"`
+	MaxLifetimeClosed  int64  `json:"maxLifetimeClosed"`
+}
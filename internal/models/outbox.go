@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+/*
+Событие outbox: записывается в одной транзакции с изменением записи,
+поэтому событие не теряется при сбое между записью и публикацией.
+Доставленное событие получает DispatchedAt и удаляется по истечении срока хранения.
+*/
+type OutboxEvent struct {
+	ID       uint64 `gorm:"primaryKey; index:idx_outbox_events_pending,priority:2,where:dispatched_at IS NULL"`
+	Type     string `gorm:"type:varchar(50); not null"`
+	PersonID uint   `gorm:"not null; index:idx_outbox_events_pending,priority:1"`
+	//Состояние записи после изменения (JSON), для удаления пусто
+	Payload  json.RawMessage `gorm:"type:bytea"`
+	Attempts int             `gorm:"not null"`
+	//Следующая попытка: пауза после ошибки или закрепление за экземпляром сервера
+	NextAttemptAt time.Time `gorm:"not null"`
+	LastError     string    `gorm:"type:text"`
+	//Получатели, уже принявшие событие: при повторе они пропускаются
+	CompletedSinks []string `gorm:"serializer:json"`
+	CreatedAt      time.Time
+	//Время доставки всем получателям или отказа от доставки
+	DispatchedAt *time.Time `gorm:"index"`
+	//Доставка прекращена после outbox.maxAttempts попыток, причина в LastError
+	Dead bool `gorm:"not null; default:false"`
+}
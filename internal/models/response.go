@@ -6,4 +6,11 @@ type ErrorResponse struct {
     Status   int    `json:"status"`
     Detail   string `json:"detail"`
     Instance string `json:"instance"`
-}
\ No newline at end of file
+    Errors   []Violation `json:"errors,omitempty"`
+}
+// Нарушение правил проверки запроса: место (path, query, header, body), имя поля и описание
+type Violation struct {
+	In      string `json:"in" xml:"in"`
+	Name    string `json:"name,omitempty" xml:"name,omitempty"`
+	Message string `json:"message" xml:"message"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+/*
+Пользователь API, созданный командой user add.
+Пользователи из файла конфигурации (auth.users) в таблицу не попадают.
+*/
+type User struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Username     string    `gorm:"type:varchar(200); uniqueIndex; not null" json:"username"`
+	PasswordHash string    `gorm:"type:varchar(200); not null" json:"-"`
+	Role         string    `gorm:"type:varchar(50); not null" json:"role"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+/*
+Маркер изменений таблицы: версия увеличивается в транзакции каждого изменения.
+По нему формируются ETag и Last-Modified списков без чтения самих записей.
+*/
+type TableVersion struct {
+	Name      string    `gorm:"primaryKey; type:varchar(50)"`
+	Version   uint64    `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
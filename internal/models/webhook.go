@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Состояния доставки webhook
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+/*
+Подписка webhook: адрес получателя, типы событий (пусто - все) и секрет подписи HMAC.
+Секрет возвращается только при создании.
+*/
+type Webhook struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	URL       string    `gorm:"type:varchar(2000); not null" json:"url"`
+	Events    []string  `gorm:"serializer:json" json:"events"`
+	Secret    string    `gorm:"type:varchar(200); not null" json:"secret,omitempty"`
+	Active    bool      `gorm:"not null" json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+/*
+Метод проверки подписки на тип события
+*/
+func (w *Webhook) Accepts(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, name := range w.Events {
+		if name == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Доставка события подписчику. Тело запроса сохраняется при постановке в очередь,
+поэтому повторная отправка передает те же данные.
+*/
+type WebhookDelivery struct {
+	ID             uint            `gorm:"primaryKey" json:"id"`
+	WebhookID      uint            `gorm:"not null; index" json:"webhookId"`
+	Webhook        *Webhook        `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	EventID        uint64          `gorm:"not null" json:"eventId"`
+	EventType      string          `gorm:"type:varchar(50); not null" json:"eventType"`
+	Payload        json.RawMessage `gorm:"type:bytea; not null" json:"payload"`
+	Status         string          `gorm:"type:varchar(20); not null; index:idx_webhook_deliveries_due,priority:1" json:"status"`
+	Attempts       int             `gorm:"not null" json:"attempts"`
+	NextAttemptAt  time.Time       `gorm:"not null; index:idx_webhook_deliveries_due,priority:2" json:"nextAttemptAt"`
+	LastStatusCode int             `json:"lastStatusCode,omitempty"`
+	LastError      string          `gorm:"type:text" json:"lastError,omitempty"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	UpdatedAt      time.Time       `json:"updatedAt"`
+	//Журнал попыток, заполняется при запросе одной доставки
+	AttemptLog []WebhookAttempt `gorm:"foreignKey:DeliveryID; constraint:OnDelete:CASCADE" json:"attemptLog,omitempty"`
+}
+
+/*
+Попытка доставки: статус ответа получателя или ошибка соединения
+*/
+type WebhookAttempt struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	DeliveryID   uint      `gorm:"not null; index" json:"deliveryId"`
+	Attempt      int       `gorm:"not null" json:"attempt"`
+	StatusCode   int       `json:"statusCode,omitempty"`
+	Error        string    `gorm:"type:text" json:"error,omitempty"`
+	ResponseBody string    `gorm:"type:text" json:"responseBody,omitempty"`
+	DurationMs   int64     `json:"durationMs"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
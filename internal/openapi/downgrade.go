@@ -0,0 +1,86 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Версия копии документа для kin-openapi, который проверяет документы OpenAPI 3.0
+const validatorVersion = "3.0.3"
+
+/*
+Функция получения копии документа OpenAPI 3.1 в формате 3.0 для проверки запросов.
+Клиентам отдается исходный документ (Spec); копия используется только kin-openapi.
+Преобразуются конструкции 3.1, которые использует документ:
+тип ["x", "null"] становится type: x и nullable: true, contentMediaType - format: binary.
+*/
+func downgrade(spec []byte) ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+	version, _ := doc["openapi"].(string)
+	if !strings.HasPrefix(version, "3.1.") {
+		return nil, fmt.Errorf("openapi %q: expected OpenAPI 3.1 document", version)
+	}
+	doc["openapi"] = validatorVersion
+	if err := downgradeValue(doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+/*
+Функция рекурсивного преобразования схем документа
+*/
+func downgradeValue(value any) error {
+	switch v := value.(type) {
+	case map[string]any:
+		if types, ok := v["type"].([]any); ok {
+			if err := downgradeType(v, types); err != nil {
+				return err
+			}
+		}
+		if _, ok := v["contentMediaType"]; ok {
+			delete(v, "contentMediaType")
+			v["format"] = "binary"
+		}
+		for _, item := range v {
+			if err := downgradeValue(item); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err := downgradeValue(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/*
+Функция замены списка типов: в OpenAPI 3.0 допускается один тип и признак nullable
+*/
+func downgradeType(schema map[string]any, types []any) error {
+	var rest []string
+	nullable := false
+	for _, t := range types {
+		name, _ := t.(string)
+		if name == "null" {
+			nullable = true
+			continue
+		}
+		rest = append(rest, name)
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("type %v: OpenAPI 3.0 allows a single type", types)
+	}
+	schema["type"] = rest[0]
+	if nullable {
+		schema["nullable"] = true
+	}
+	return nil
+}
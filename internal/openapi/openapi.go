@@ -0,0 +1,65 @@
+package openapi
+
+import (
+	_ "embed"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// Документ OpenAPI, описывающий все маршруты сервера
+//
+//go:embed openapi.json
+var Spec []byte
+
+// Путь документа OpenAPI
+const SpecPath = "/openapi.json"
+
+// Настройка Swagger UI на документ сервера
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "` + SpecPath + `",
+    dom_id: '#swagger-ui',
+    deepLinking: true,
+    presets: [
+      SwaggerUIBundle.presets.apis,
+      SwaggerUIStandalonePreset
+    ],
+    plugins: [
+      SwaggerUIBundle.plugins.DownloadUrl
+    ],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+/*
+Обработчик запроса документа OpenAPI
+*/
+func SpecHandler(context *gin.Context) {
+	context.Data(http.StatusOK, "application/json; charset=utf-8", Spec)
+}
+
+/*
+Обработчик Swagger UI (/docs/*any), файлы интерфейса встроены в бинарный файл
+*/
+func UIHandler(context *gin.Context) {
+	file := strings.TrimPrefix(context.Param("any"), "/")
+	switch file {
+	case "", "index.html":
+		//Страница отдается напрямую: http.FileServer перенаправляет запросы к index.html
+		page, err := fs.ReadFile(swaggerFiles.FS, "index.html")
+		if err != nil {
+			context.Status(http.StatusNotFound)
+			return
+		}
+		context.Data(http.StatusOK, "text/html; charset=utf-8", page)
+	case "swagger-initializer.js":
+		context.Data(http.StatusOK, "application/javascript; charset=utf-8", []byte(swaggerInitializer))
+	default:
+		context.FileFromFS(file, http.FS(swaggerFiles.FS))
+	}
+}
@@ -0,0 +1,86 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+/*
+Клиентам отдается документ OpenAPI 3.1, его копия для kin-openapi должна быть корректным документом 3.0
+*/
+func TestSpecValid(t *testing.T) {
+	var served struct {
+		OpenAPI string `json:"openapi"`
+	}
+	if err := json.Unmarshal(Spec, &served); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(served.OpenAPI, "3.1.") {
+		t.Fatalf("served openapi %q, want 3.1", served.OpenAPI)
+	}
+	if err := load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := document.Validate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDowngrade(t *testing.T) {
+	spec := []byte(`{"openapi": "3.1.0", "components": {"schemas": {"A": {"properties": {
+		"data": {"type": ["object", "null"]},
+		"name": {"type": ["string"]},
+		"file": {"type": "string", "contentMediaType": "text/csv"}}}}}}`)
+	data, err := downgrade(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		OpenAPI    string `json:"openapi"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	properties := doc.Components.Schemas["A"].Properties
+	if doc.OpenAPI != validatorVersion || properties["data"]["type"] != "object" || properties["data"]["nullable"] != true ||
+		properties["name"]["type"] != "string" || properties["name"]["nullable"] != nil ||
+		properties["file"]["format"] != "binary" || properties["file"]["contentMediaType"] != nil {
+		t.Errorf("downgraded: %s", data)
+	}
+	//Несколько типов и документы 3.0 не поддерживаются
+	for _, spec := range []string{
+		`{"openapi": "3.1.0", "components": {"schemas": {"A": {"type": ["string", "integer"]}}}}`,
+		`{"openapi": "3.0.3"}`,
+	} {
+		if _, err := downgrade([]byte(spec)); err == nil {
+			t.Errorf("%s: expected error", spec)
+		}
+	}
+}
+
+func TestGraphQLResponseNullableData(t *testing.T) {
+	if err := load(); err != nil {
+		t.Fatal(err)
+	}
+	schema := document.Components.Schemas["GraphQLResponse"].Value
+	for _, value := range []any{
+		map[string]any{"data": nil, "errors": []any{map[string]any{"message": "syntax error"}}},
+		map[string]any{"data": map[string]any{"person": map[string]any{"id": 1.0}}},
+	} {
+		if err := schema.VisitJSON(value); err != nil {
+			t.Errorf("%v: %v", value, err)
+		}
+	}
+	if err := schema.VisitJSON(map[string]any{"data": "text"}, openapi3.MultiErrors()); err == nil {
+		t.Error("string data accepted")
+	}
+}
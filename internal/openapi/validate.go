@@ -0,0 +1,151 @@
+package openapi
+
+import (
+	"WST_lab6_server/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+var (
+	loadOnce sync.Once
+	document *openapi3.T
+	router   routers.Router
+	loadErr  error
+)
+
+/*
+Функция загрузки документа OpenAPI и построения маршрутизатора (выполняется один раз).
+Загружается копия документа в формате 3.0 (downgrade), которую проверяет kin-openapi.
+*/
+func load() error {
+	loadOnce.Do(func() {
+		var spec []byte
+		spec, loadErr = downgrade(Spec)
+		if loadErr != nil {
+			return
+		}
+		loader := openapi3.NewLoader()
+		document, loadErr = loader.LoadFromData(spec)
+		if loadErr != nil {
+			return
+		}
+		//Без серверов маршрутизатор сопоставляет только пути, независимо от хоста
+		doc := *document
+		doc.Servers = nil
+		router, loadErr = gorillamux.NewRouter(&doc)
+	})
+	return loadErr
+}
+
+/*
+Функция проверки запроса по документу OpenAPI.
+Возвращает список нарушений; found=false если операция не описана в документе.
+Тело запроса после проверки остается доступным обработчику.
+*/
+func ValidateRequest(ctx context.Context, request *http.Request) (violations []models.Violation, found bool, err error) {
+	if err := load(); err != nil {
+		return nil, false, err
+	}
+	route, pathParams, err := router.FindRoute(request)
+	if err != nil {
+		return nil, false, nil
+	}
+	input := &openapi3filter.RequestValidationInput{
+		Request:    request,
+		PathParams: pathParams,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			MultiError: true,
+			//Учетные данные проверяет BasicAuthMiddleware
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	}
+	if err := openapi3filter.ValidateRequest(ctx, input); err != nil {
+		return collectViolations(err, nil), true, nil
+	}
+	return nil, true, nil
+}
+
+/*
+Функция проверки значения по схеме из components/schemas (например PersonCreate).
+Используется другими транспортами, чтобы правила проверки были описаны один раз.
+*/
+func ValidateSchema(name string, value any) ([]models.Violation, error) {
+	if err := load(); err != nil {
+		return nil, err
+	}
+	schemaRef, ok := document.Components.Schemas[name]
+	if !ok || schemaRef.Value == nil {
+		return nil, fmt.Errorf("schema %q not found", name)
+	}
+	//Приводим значение к представлению JSON (map, []any, float64)
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	if err := schemaRef.Value.VisitJSON(decoded, openapi3.MultiErrors()); err != nil {
+		body := &openapi3filter.RequestError{RequestBody: &openapi3.RequestBody{}}
+		return collectViolations(err, body), nil
+	}
+	return nil, nil
+}
+
+/*
+Функция преобразования ошибок kin-openapi в плоский список нарушений
+*/
+func collectViolations(err error, parent *openapi3filter.RequestError) []models.Violation {
+	//Только сам список: errors.As нашел бы список внутри RequestError и потерял бы параметр
+	if multi, ok := err.(openapi3.MultiError); ok {
+		var violations []models.Violation
+		for _, e := range multi {
+			violations = append(violations, collectViolations(e, parent)...)
+		}
+		return violations
+	}
+	var requestErr *openapi3filter.RequestError
+	if errors.As(err, &requestErr) && requestErr != parent {
+		if requestErr.Err != nil {
+			return collectViolations(requestErr.Err, requestErr)
+		}
+		return []models.Violation{violation(requestErr, "", requestErr.Reason)}
+	}
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		pointer := "/" + strings.Join(schemaErr.JSONPointer(), "/")
+		return []models.Violation{violation(parent, pointer, schemaErr.Reason)}
+	}
+	var parseErr *openapi3filter.ParseError
+	if errors.As(err, &parseErr) {
+		return []models.Violation{violation(parent, "", parseErr.Error())}
+	}
+	return []models.Violation{violation(parent, "", err.Error())}
+}
+
+/*
+Функция создания нарушения с указанием места: параметр (path, query, header) или тело
+*/
+func violation(requestErr *openapi3filter.RequestError, pointer string, message string) models.Violation {
+	result := models.Violation{In: "body", Name: pointer, Message: message}
+	if requestErr != nil && requestErr.Parameter != nil {
+		result.In = requestErr.Parameter.In
+		result.Name = requestErr.Parameter.Name + strings.TrimSuffix(pointer, "/")
+	}
+	if result.Name == "/" {
+		result.Name = ""
+	}
+	return result
+}
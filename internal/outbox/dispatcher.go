@@ -0,0 +1,255 @@
+package outbox
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/events"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/metrics"
+	"WST_lab6_server/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Значения по умолчанию
+const (
+	defaultPollInterval   = time.Second
+	defaultBatchSize      = 100
+	defaultLease          = time.Minute
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 5 * time.Minute
+	defaultMaxAttempts    = 20
+	//Ограничение времени передачи события одному получателю
+	handleTimeout = 10 * time.Second
+	//Интервал удаления доставленных событий старше retention
+	purgeInterval = time.Hour
+	//Ограничение времени записи результата доставки
+	recordTimeout = 5 * time.Second
+)
+
+/*
+Хранилище событий outbox (postgres.Storage)
+*/
+type Store interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error)
+	CompleteOutboxEvent(ctx context.Context, id uint64) error
+	RetryOutboxEvent(ctx context.Context, event *models.OutboxEvent) error
+	FailOutboxEvent(ctx context.Context, event *models.OutboxEvent) error
+	PurgeOutboxEvents(ctx context.Context, before time.Time) (int64, error)
+}
+
+/*
+Диспетчер outbox: передает записанные в транзакциях события получателям.
+Событие считается доставленным, когда его приняли все получатели; при ошибке получателя
+событие повторяется позже только для него, а следующие события той же записи ждут.
+После maxAttempts неудачных попыток событие отмечается dead и следующие события записи доставляются дальше.
+*/
+type Dispatcher struct {
+	store          Store
+	sinks          []Sink
+	pollInterval   time.Duration
+	batchSize      int
+	lease          time.Duration
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	maxAttempts    int
+	retention      time.Duration
+	wake           chan struct{}
+}
+
+/*
+Функция создания диспетчера по конфигурации outbox
+*/
+func NewDispatcher(store Store, sinks ...Sink) *Dispatcher {
+	cfg := config.OutboxSetting
+	return &Dispatcher{
+		store:          store,
+		sinks:          sinks,
+		pollInterval:   valueOr(cfg.PollInterval, defaultPollInterval),
+		batchSize:      valueOr(cfg.BatchSize, defaultBatchSize),
+		lease:          valueOr(cfg.Lease, defaultLease),
+		initialBackoff: valueOr(cfg.InitialBackoff, defaultInitialBackoff),
+		maxBackoff:     valueOr(cfg.MaxBackoff, defaultMaxBackoff),
+		maxAttempts:    valueOr(cfg.MaxAttempts, defaultMaxAttempts),
+		retention:      cfg.Retention,
+		wake:           make(chan struct{}, 1),
+	}
+}
+
+func valueOr[T int | time.Duration](value T, fallback T) T {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
+
+/*
+Метод пробуждения диспетчера после записи события (postgres.Storage.OutboxWritten)
+*/
+func (d *Dispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+/*
+Метод работы диспетчера до отмены контекста.
+Недоставленные события остаются в таблице и будут доставлены после перезапуска.
+*/
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+	var lastPurge time.Time
+	for {
+		d.dispatch(ctx)
+		if d.retention > 0 && time.Since(lastPurge) >= purgeInterval {
+			lastPurge = time.Now()
+			d.purge(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+/*
+Метод доставки выбранных событий, пока в таблице есть события, время которых наступило
+*/
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	for ctx.Err() == nil {
+		outboxEvents, err := d.store.ClaimOutboxEvents(ctx, d.batchSize, d.lease)
+		if err != nil {
+			if ctx.Err() == nil {
+				logging.Logger.Error("error claiming outbox events", zap.Error(err))
+			}
+			return
+		}
+		if len(outboxEvents) == 0 {
+			return
+		}
+		//Выбраны только первые события разных записей, порядок между ними не важен
+		for i := range outboxEvents {
+			d.deliver(ctx, &outboxEvents[i])
+		}
+	}
+}
+
+/*
+Метод передачи события получателям, которые его еще не приняли, и записи результата
+*/
+func (d *Dispatcher) deliver(ctx context.Context, outboxEvent *models.OutboxEvent) {
+	logger := logging.Logger.With(
+		zap.Uint64("event_id", outboxEvent.ID),
+		zap.String("event_type", outboxEvent.Type),
+		zap.Uint("person_id", outboxEvent.PersonID))
+	event, err := toEvent(outboxEvent)
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		for _, sink := range d.sinks {
+			if slices.Contains(outboxEvent.CompletedSinks, sink.Name()) {
+				continue
+			}
+			handleCtx, cancel := context.WithTimeout(ctx, handleTimeout)
+			err := sink.Handle(handleCtx, event)
+			cancel()
+			if err != nil {
+				metrics.OutboxFailures.WithLabelValues(sink.Name()).Inc()
+				errs = append(errs, errors.New(sink.Name()+": "+err.Error()))
+				continue
+			}
+			metrics.OutboxDelivered.WithLabelValues(sink.Name()).Inc()
+			outboxEvent.CompletedSinks = append(outboxEvent.CompletedSinks, sink.Name())
+		}
+	}
+
+	//Результат записывается и при остановке сервера, иначе получатели получат событие повторно
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordTimeout)
+	defer cancel()
+	if len(errs) == 0 {
+		metrics.OutboxLag.Observe(time.Since(outboxEvent.CreatedAt).Seconds())
+		if err := d.store.CompleteOutboxEvent(recordCtx, outboxEvent.ID); err != nil {
+			//Событие будет доставлено повторно по истечении lease
+			logger.Error("error completing outbox event", zap.Error(err))
+		}
+		return
+	}
+	outboxEvent.Attempts++
+	outboxEvent.LastError = errors.Join(errs...).Error()
+	if outboxEvent.Attempts >= d.maxAttempts {
+		//Событие больше не задерживает следующие события записи
+		metrics.OutboxDead.Inc()
+		logger.Error("outbox event delivery failed permanently",
+			zap.Int("attempts", outboxEvent.Attempts),
+			zap.Strings("completed_sinks", outboxEvent.CompletedSinks),
+			zap.Errors("errors", errs))
+		if err := d.store.FailOutboxEvent(recordCtx, outboxEvent); err != nil {
+			logger.Error("error recording dead outbox event", zap.Error(err))
+		}
+		return
+	}
+	outboxEvent.NextAttemptAt = time.Now().Add(d.backoff(outboxEvent.Attempts))
+	logger.Warn("outbox event delivery failed",
+		zap.Int("attempt", outboxEvent.Attempts),
+		zap.Time("next_attempt_at", outboxEvent.NextAttemptAt),
+		zap.Errors("errors", errs))
+	if err := d.store.RetryOutboxEvent(recordCtx, outboxEvent); err != nil {
+		logger.Error("error recording outbox retry", zap.Error(err))
+	}
+}
+
+/*
+Функция преобразования строки outbox в событие; ID и время события совпадают с outbox
+*/
+func toEvent(outboxEvent *models.OutboxEvent) (events.Event, error) {
+	event := events.Event{
+		ID:       outboxEvent.ID,
+		Type:     outboxEvent.Type,
+		PersonID: outboxEvent.PersonID,
+		Time:     outboxEvent.CreatedAt.UTC(),
+	}
+	if len(outboxEvent.Payload) > 0 {
+		var person models.Person
+		if err := json.Unmarshal(outboxEvent.Payload, &person); err != nil {
+			return event, err
+		}
+		event.Person = &person
+	}
+	return event, nil
+}
+
+/*
+Метод удаления доставленных событий старше срока хранения
+*/
+func (d *Dispatcher) purge(ctx context.Context) {
+	deleted, err := d.store.PurgeOutboxEvents(ctx, time.Now().Add(-d.retention))
+	if err != nil {
+		if ctx.Err() == nil {
+			logging.Logger.Error("error purging outbox events", zap.Error(err))
+		}
+		return
+	}
+	if deleted > 0 {
+		logging.Logger.Info("outbox events purged", zap.Int64("deleted", deleted))
+	}
+}
+
+/*
+Метод расчета паузы перед повтором: initialBackoff * 2^(попытка-1), не более maxBackoff
+*/
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.initialBackoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.maxBackoff)
+}
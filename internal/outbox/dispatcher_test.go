@@ -0,0 +1,234 @@
+package outbox
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/events"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+/*
+Таблица outbox в памяти вместо postgres.Storage: выбирается только первое необработанное событие записи
+*/
+type memoryStore struct {
+	mu     sync.Mutex
+	events []*models.OutboxEvent
+}
+
+func (s *memoryStore) add(eventType string, personID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payload, _ := json.Marshal(models.Person{ID: personID, Name: "Ivan"})
+	s.events = append(s.events, &models.OutboxEvent{
+		ID:            uint64(len(s.events) + 1),
+		Type:          eventType,
+		PersonID:      personID,
+		Payload:       payload,
+		NextAttemptAt: time.Now(),
+		CreatedAt:     time.Now(),
+	})
+}
+
+func (s *memoryStore) ClaimOutboxEvents(_ context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	heads := map[uint]bool{}
+	var claimed []models.OutboxEvent
+	for _, event := range s.events {
+		if event.DispatchedAt != nil || heads[event.PersonID] {
+			continue
+		}
+		heads[event.PersonID] = true
+		if len(claimed) < limit && !event.NextAttemptAt.After(now) {
+			event.NextAttemptAt = now.Add(lease)
+			claimed = append(claimed, *event)
+		}
+	}
+	return claimed, nil
+}
+
+func (s *memoryStore) CompleteOutboxEvent(_ context.Context, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.events[id-1].DispatchedAt = &now
+	s.events[id-1].LastError = ""
+	return nil
+}
+
+func (s *memoryStore) RetryOutboxEvent(_ context.Context, event *models.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.events[event.ID-1]
+	stored.Attempts = event.Attempts
+	stored.NextAttemptAt = event.NextAttemptAt
+	stored.LastError = event.LastError
+	stored.CompletedSinks = slices.Clone(event.CompletedSinks)
+	return nil
+}
+
+func (s *memoryStore) FailOutboxEvent(_ context.Context, event *models.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	stored := s.events[event.ID-1]
+	stored.Attempts = event.Attempts
+	stored.LastError = event.LastError
+	stored.CompletedSinks = slices.Clone(event.CompletedSinks)
+	stored.DispatchedAt = &now
+	stored.Dead = true
+	return nil
+}
+
+func (s *memoryStore) PurgeOutboxEvents(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *memoryStore) event(id uint64) models.OutboxEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.events[id-1]
+}
+
+/*
+Получатель, запоминающий принятые события; первые failures вызовов завершаются ошибкой
+*/
+type recordingSink struct {
+	name     string
+	failures int
+	mu       sync.Mutex
+	calls    int
+	received []events.Event
+}
+
+func (s *recordingSink) Name() string {
+	return s.name
+}
+
+func (s *recordingSink) Handle(_ context.Context, event events.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.calls <= s.failures {
+		return errors.New("unavailable")
+	}
+	s.received = append(s.received, event)
+	return nil
+}
+
+/*
+Функция создания диспетчера с короткими паузами между попытками
+*/
+func newTestDispatcher(t *testing.T, store Store, sinks ...Sink) *Dispatcher {
+	t.Helper()
+	logging.Logger = zap.NewNop()
+	saved := *config.OutboxSetting
+	t.Cleanup(func() { *config.OutboxSetting = saved })
+	*config.OutboxSetting = config.OutboxConfig{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		MaxAttempts:    3,
+	}
+	return NewDispatcher(store, sinks...)
+}
+
+/*
+Функция повторения dispatch, пока все события не обработаны (доставлены или dead)
+*/
+func dispatchAll(t *testing.T, dispatcher *Dispatcher, store *memoryStore) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		dispatcher.dispatch(context.Background())
+		store.mu.Lock()
+		pending := slices.ContainsFunc(store.events, func(event *models.OutboxEvent) bool { return event.DispatchedAt == nil })
+		store.mu.Unlock()
+		if !pending {
+			return
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	t.Fatal("outbox events were not dispatched")
+}
+
+func TestRetrySkipsCompletedSinks(t *testing.T) {
+	store := &memoryStore{}
+	store.add(events.TypeCreated, 1)
+	accepting := &recordingSink{name: "events"}
+	failing := &recordingSink{name: "webhooks", failures: 1}
+	dispatcher := newTestDispatcher(t, store, accepting, failing)
+	dispatcher.dispatch(context.Background())
+	event := store.event(1)
+	if event.DispatchedAt != nil || event.Attempts != 1 || !slices.Equal(event.CompletedSinks, []string{"events"}) || event.LastError == "" {
+		t.Fatalf("after failed attempt: %+v", event)
+	}
+	dispatchAll(t, dispatcher, store)
+	if accepting.calls != 1 || failing.calls != 2 {
+		t.Fatalf("accepting sink called %d times, failing sink %d times", accepting.calls, failing.calls)
+	}
+	if event := store.event(1); event.Dead || event.LastError != "" {
+		t.Errorf("after retry: %+v", event)
+	}
+}
+
+func TestEventsOfPersonInOrder(t *testing.T) {
+	store := &memoryStore{}
+	store.add(events.TypeCreated, 1)
+	store.add(events.TypeUpdated, 1)
+	store.add(events.TypeCreated, 2)
+	store.add(events.TypeDeleted, 1)
+	//Первое событие записи 1 доставляется со второй попытки, событие записи 2 не ждет его
+	sink := &recordingSink{name: "events", failures: 1}
+	dispatcher := newTestDispatcher(t, store, sink)
+	dispatchAll(t, dispatcher, store)
+	var order []uint64
+	for _, event := range sink.received {
+		if event.PersonID == 1 {
+			order = append(order, event.ID)
+		}
+	}
+	if !slices.Equal(order, []uint64{1, 2, 4}) || sink.received[0].PersonID != 2 {
+		t.Fatalf("delivery order %+v", sink.received)
+	}
+	if sink.received[1].Person == nil || sink.received[1].Person.ID != 1 || sink.received[1].Type != events.TypeCreated {
+		t.Errorf("event payload %+v", sink.received[1])
+	}
+}
+
+func TestDeadAfterMaxAttempts(t *testing.T) {
+	store := &memoryStore{}
+	store.add(events.TypeCreated, 1)
+	store.add(events.TypeUpdated, 1)
+	//Первое событие отклоняется 3 раза (maxAttempts), второе доставляется
+	sink := &recordingSink{name: "events", failures: 3}
+	dispatcher := newTestDispatcher(t, store, sink)
+	dispatchAll(t, dispatcher, store)
+	if event := store.event(1); !event.Dead || event.Attempts != 3 || event.LastError != "events: unavailable" {
+		t.Fatalf("first event: %+v", event)
+	}
+	if event := store.event(2); event.Dead || event.Attempts != 0 {
+		t.Fatalf("second event: %+v", event)
+	}
+	if len(sink.received) != 1 || sink.received[0].ID != 2 {
+		t.Fatalf("received %+v", sink.received)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	dispatcher := &Dispatcher{initialBackoff: time.Second, maxBackoff: 10 * time.Second}
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 50: 10 * time.Second} {
+		if got := dispatcher.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
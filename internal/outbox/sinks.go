@@ -0,0 +1,104 @@
+package outbox
+
+import (
+	"WST_lab6_server/internal/events"
+	"WST_lab6_server/internal/logging"
+	"context"
+
+	"go.uber.org/zap"
+)
+
+/*
+Получатель событий outbox. Ошибка Handle означает повтор доставки позже,
+поэтому получатель должен допускать повторное получение события с тем же ID.
+*/
+type Sink interface {
+	Name() string
+	Handle(ctx context.Context, event events.Event) error
+}
+
+/*
+Получатель, записывающий события в журнал сервера
+*/
+type LogSink struct{}
+
+func (LogSink) Name() string {
+	return "log"
+}
+
+func (LogSink) Handle(ctx context.Context, event events.Event) error {
+	logging.Logger.Info("domain event",
+		zap.Uint64("event_id", event.ID),
+		zap.String("event_type", event.Type),
+		zap.Uint("person_id", event.PersonID),
+		zap.Time("event_time", event.Time))
+	return nil
+}
+
+/*
+Получатель, публикующий события в ленту изменений (SSE и WebSocket).
+Брокер находится в памяти процесса: событие получают только подписчики экземпляра сервера,
+выбравшего его из outbox, поэтому лента изменений рассчитана на один экземпляр сервера.
+*/
+type BrokerSink struct {
+	Broker *events.Broker
+}
+
+func (s BrokerSink) Name() string {
+	return "events"
+}
+
+func (s BrokerSink) Handle(ctx context.Context, event events.Event) error {
+	//Идентификаторы ленты изменений назначает брокер (Last-Event-ID подписчиков)
+	event.ID = 0
+	s.Broker.Publish(event)
+	return nil
+}
+
+/*
+Получатель, передающий события в канал для потребителя в том же процессе.
+Доставка ждет, пока потребитель примет событие, или отменяется по контексту с повтором позже.
+*/
+type ChannelSink struct {
+	SinkName string
+	C        chan<- events.Event
+}
+
+func (s ChannelSink) Name() string {
+	if s.SinkName == "" {
+		return "channel"
+	}
+	return s.SinkName
+}
+
+func (s ChannelSink) Handle(ctx context.Context, event events.Event) error {
+	select {
+	case s.C <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/*
+Постановка события в очередь доставки webhook (webhooks.Worker)
+*/
+type Enqueuer interface {
+	Enqueue(ctx context.Context, event events.Event) error
+}
+
+/*
+Получатель, ставящий события в очередь доставок подписок webhook.
+ID события совпадает с ID outbox, по нему получатели webhook отбрасывают повторы.
+*/
+type WebhookSink struct {
+	Queue Enqueuer
+}
+
+func (s WebhookSink) Name() string {
+	return "webhooks"
+}
+
+func (s WebhookSink) Handle(ctx context.Context, event events.Event) error {
+	return s.Queue.Enqueue(ctx, event)
+}
@@ -0,0 +1,139 @@
+package pii
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/models"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Поля записи, которые могут быть скрыты в ответах
+const (
+	FieldEmail     = "email"
+	FieldTelephone = "telephone"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
+	phonePattern = regexp.MustCompile(`\+?\d{10,15}`)
+)
+
+/*
+Функция маскирования email: видны первый символ имени и домен (o***@mail.com)
+*/
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return maskMiddle(email, 1, 0)
+	}
+	//Первый символ, а не байт: имя может начинаться с кириллицы
+	first, _ := utf8.DecodeRuneInString(email)
+	return string(first) + "***" + email[at:]
+}
+
+/*
+Функция маскирования телефона: видны код страны и три последние цифры (+7*******576)
+*/
+func MaskPhone(phone string) string {
+	return maskMiddle(phone, 2, 3)
+}
+
+/*
+Функция маскирования всех email и телефонов внутри произвольной строки
+*/
+func MaskString(value string) string {
+	value = emailPattern.ReplaceAllStringFunc(value, MaskEmail)
+	return phonePattern.ReplaceAllStringFunc(value, MaskPhone)
+}
+
+/*
+Функция замены середины строки символами '*'
+*/
+func maskMiddle(value string, keepStart, keepEnd int) string {
+	runes := []rune(value)
+	if len(runes) <= keepStart+keepEnd {
+		return strings.Repeat("*", len(runes))
+	}
+	for i := keepStart; i < len(runes)-keepEnd; i++ {
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+/*
+Функция проверки включенного маскирования в журнале
+*/
+func MaskLogs() bool {
+	return config.PIISetting.MaskLogs
+}
+
+/*
+Функция поля журнала с записью, email и телефон маскируются согласно настройке
+*/
+func PersonField(key string, person models.Person) zap.Field {
+	return zap.Object(key, loggedPerson(person))
+}
+
+// Запись для журнала
+type loggedPerson models.Person
+
+func (p loggedPerson) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	email, telephone := p.Email, p.Telephone
+	if MaskLogs() {
+		email, telephone = MaskEmail(email), MaskPhone(telephone)
+	}
+	enc.AddUint("id", p.ID)
+	enc.AddString("name", p.Name)
+	enc.AddString("surname", p.Surname)
+	enc.AddInt("age", p.Age)
+	enc.AddString("email", email)
+	enc.AddString("telephone", telephone)
+	return nil
+}
+
+/*
+Функция получения полей, скрытых от роли (PIISetting.Redaction).
+По скрытым полям роль не может искать и фильтровать: иначе значение восстанавливается
+перебором по наличию результатов.
+*/
+func HiddenFields(role string) []string {
+	var hidden []string
+	for _, field := range config.PIISetting.Redaction[role] {
+		if field == FieldEmail || field == FieldTelephone {
+			hidden = append(hidden, field)
+		}
+	}
+	return hidden
+}
+
+/*
+Функция удаления из условий выборки полей, скрытых от роли
+*/
+func RedactFilter(filter *models.PersonFilter, role string) {
+	for _, field := range HiddenFields(role) {
+		switch field {
+		case FieldEmail:
+			filter.Email = ""
+		case FieldTelephone:
+			filter.Telephone = ""
+		}
+	}
+}
+
+/*
+Функция скрытия полей записи в ответе по роли пользователя (PIISetting.Redaction)
+*/
+func RedactPerson(person *models.Person, role string) {
+	for _, field := range config.PIISetting.Redaction[role] {
+		switch field {
+		case FieldEmail:
+			person.Email = MaskEmail(person.Email)
+		case FieldTelephone:
+			person.Telephone = MaskPhone(person.Telephone)
+		}
+	}
+}
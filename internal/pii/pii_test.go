@@ -0,0 +1,51 @@
+package pii
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/models"
+	"slices"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestMaskEmail(t *testing.T) {
+	tests := map[string]string{
+		"olga@mail.com":  "o***@mail.com",
+		"ольга@почта.рф": "о***@почта.рф",
+		"Ёжик@mail.com":  "Ё***@mail.com",
+		"a@b.c":          "a***@b.c",
+		"не-email":       "н*******",
+		"@mail.com":      "@********",
+	}
+	for email, want := range tests {
+		got := MaskEmail(email)
+		if got != want || !utf8.ValidString(got) {
+			t.Errorf("MaskEmail(%q) = %q, want %q", email, got, want)
+		}
+	}
+}
+
+func TestHiddenFieldsAndFilter(t *testing.T) {
+	saved := config.PIISetting.Redaction
+	t.Cleanup(func() { config.PIISetting.Redaction = saved })
+	config.PIISetting.Redaction = map[string][]string{
+		"viewer": {FieldEmail, FieldTelephone},
+		"editor": {FieldTelephone},
+	}
+	if hidden := HiddenFields("viewer"); !slices.Equal(hidden, []string{"email", "telephone"}) {
+		t.Errorf("viewer: %v", hidden)
+	}
+	if hidden := HiddenFields("admin"); len(hidden) != 0 {
+		t.Errorf("admin: %v", hidden)
+	}
+	age := 30
+	filter := models.PersonFilter{Name: "Olga", Email: "olga@", Telephone: "+7999", AgeMin: &age}
+	RedactFilter(&filter, "editor")
+	if filter.Email != "olga@" || filter.Telephone != "" || filter.Name != "Olga" || filter.AgeMin != &age {
+		t.Errorf("editor filter %+v", filter)
+	}
+	RedactFilter(&filter, "viewer")
+	if filter.Email != "" {
+		t.Errorf("viewer filter %+v", filter)
+	}
+}
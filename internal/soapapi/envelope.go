@@ -0,0 +1,220 @@
+package soapapi
+
+import (
+	"WST_lab6_server/internal/models"
+	"encoding/xml"
+	"mime"
+	"net/http"
+)
+
+// Пространства имен конвертов SOAP и сервиса
+const (
+	soap11Namespace   = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace   = "http://www.w3.org/2003/05/soap-envelope"
+	serviceNamespace  = "http://wst-lab6/persons/v1"
+	wsseNamespace     = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+	soap11ContentType = "text/xml"
+	soap12ContentType = "application/soap+xml"
+)
+
+/*
+Версия протокола SOAP запроса: пространство имен конверта, тип содержимого и коды ошибок
+*/
+type version struct {
+	namespace   string
+	contentType string
+	//Коды ошибок отправителя и получателя (Client/Server в 1.1, Sender/Receiver в 1.2)
+	sender   string
+	receiver string
+}
+
+var (
+	soap11 = &version{namespace: soap11Namespace, contentType: soap11ContentType, sender: "Client", receiver: "Server"}
+	soap12 = &version{namespace: soap12Namespace, contentType: soap12ContentType, sender: "Sender", receiver: "Receiver"}
+)
+
+/*
+Функция определения версии SOAP по типу содержимого запроса
+*/
+func versionOf(request *http.Request) *version {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+	switch mediaType {
+	case soap11ContentType:
+		return soap11
+	case soap12ContentType:
+		return soap12
+	}
+	return nil
+}
+
+/*
+Заголовок конверта запроса
+*/
+type requestHeader struct {
+	Entries []headerEntry `xml:",any"`
+}
+
+/*
+Блок заголовка SOAP. Из блоков разбирается только токен wsse:Security.
+*/
+type headerEntry struct {
+	XMLName        xml.Name
+	MustUnderstand string         `xml:"mustUnderstand,attr"`
+	UsernameToken  *usernameToken `xml:"UsernameToken"`
+}
+
+/*
+Метод проверки атрибута mustUnderstand (1.1: "1", 1.2: "true" или "1")
+*/
+func (h *headerEntry) mustUnderstand() bool {
+	return h.MustUnderstand == "1" || h.MustUnderstand == "true"
+}
+
+/*
+Конверт ответа. Префиксы задаются в именах элементов, чтобы ответ был привычного вида (soap:Envelope).
+*/
+type responseEnvelope struct {
+	XMLName   xml.Name `xml:"soap:Envelope"`
+	Namespace string   `xml:"xmlns:soap,attr"`
+	Body      struct {
+		Content any
+	} `xml:"soap:Body"`
+}
+
+/*
+Ошибка SOAP 1.1
+*/
+type fault11 struct {
+	XMLName xml.Name     `xml:"soap:Fault"`
+	Wsse    string       `xml:"xmlns:wsse,attr,omitempty"`
+	Code    string       `xml:"faultcode"`
+	String  string       `xml:"faultstring"`
+	Detail  *faultDetail `xml:"detail,omitempty"`
+}
+
+/*
+Ошибка SOAP 1.2
+*/
+type fault12 struct {
+	XMLName xml.Name `xml:"soap:Fault"`
+	Wsse    string   `xml:"xmlns:wsse,attr,omitempty"`
+	Code    struct {
+		Value   string `xml:"soap:Value"`
+		Subcode *struct {
+			Value string `xml:"soap:Value"`
+		} `xml:"soap:Subcode,omitempty"`
+	} `xml:"soap:Code"`
+	Reason struct {
+		Text struct {
+			Lang  string `xml:"xml:lang,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"soap:Text"`
+	} `xml:"soap:Reason"`
+	Detail *faultDetail `xml:"soap:Detail,omitempty"`
+}
+
+/*
+Подробности ошибки сервиса: код (как extensions.code в GraphQL) и нарушения правил проверки
+*/
+type faultDetail struct {
+	Fault personFault
+}
+
+type personFault struct {
+	XMLName    xml.Name    `xml:"http://wst-lab6/persons/v1 personFault"`
+	Code       string      `xml:"code"`
+	Violations *violations `xml:"violations,omitempty"`
+}
+
+type violations struct {
+	Items []models.Violation `xml:"violation"`
+}
+
+/*
+Ошибка обработки запроса, возвращаемая клиенту как SOAP Fault
+*/
+type soapFault struct {
+	//Ошибка клиента (Client/Sender), иначе ошибка сервера
+	client bool
+	//Код конверта (VersionMismatch, MustUnderstand) вместо кода отправителя или получателя
+	envelopeCode string
+	//Код WS-Security (wsse:FailedAuthentication и т.п.), заменяет код сервиса
+	securityCode string
+	code         string
+	message      string
+	violations   []models.Violation
+}
+
+func (f *soapFault) Error() string {
+	return f.message
+}
+
+func clientFault(code string, message string) *soapFault {
+	return &soapFault{client: true, code: code, message: message}
+}
+
+func serverFault(code string, message string) *soapFault {
+	return &soapFault{code: code, message: message}
+}
+
+func envelopeFault(envelopeCode string, message string) *soapFault {
+	return &soapFault{client: true, envelopeCode: envelopeCode, message: message}
+}
+
+func securityFault(securityCode string, message string) *soapFault {
+	return &soapFault{client: true, securityCode: securityCode, message: message}
+}
+
+/*
+Метод формирования элемента Fault для версии протокола.
+Ошибки WS-Security передаются кодом wsse (1.1) или подкодом (1.2) без подробностей.
+*/
+func (f *soapFault) element(v *version) any {
+	code := v.receiver
+	if f.client {
+		code = v.sender
+	}
+	if f.envelopeCode != "" {
+		code = f.envelopeCode
+	}
+	var detail *faultDetail
+	if f.securityCode == "" && f.envelopeCode == "" {
+		detail = &faultDetail{Fault: personFault{Code: f.code}}
+		if len(f.violations) > 0 {
+			detail.Fault.Violations = &violations{Items: f.violations}
+		}
+	}
+	if v == soap11 {
+		fault := &fault11{Code: "soap:" + code, String: f.message, Detail: detail}
+		if f.securityCode != "" {
+			fault.Wsse = wsseNamespace
+			fault.Code = "wsse:" + f.securityCode
+		}
+		return fault
+	}
+	fault := &fault12{Detail: detail}
+	fault.Code.Value = "soap:" + code
+	if f.securityCode != "" {
+		fault.Wsse = wsseNamespace
+		fault.Code.Subcode = &struct {
+			Value string `xml:"soap:Value"`
+		}{Value: "wsse:" + f.securityCode}
+	}
+	fault.Reason.Text.Lang = "en"
+	fault.Reason.Text.Value = f.message
+	return fault
+}
+
+/*
+Метод выбора статуса HTTP ответа с ошибкой:
+SOAP 1.1 всегда 500, SOAP 1.2 - 400 для ошибок отправителя и 500 для остальных
+*/
+func (f *soapFault) status(v *version) int {
+	if v == soap12 && f.client && f.envelopeCode == "" {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
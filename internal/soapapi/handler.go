@@ -0,0 +1,290 @@
+package soapapi
+
+import (
+	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/middleware"
+	"WST_lab6_server/internal/models"
+	"WST_lab6_server/internal/pii"
+	"WST_lab6_server/internal/tracing"
+	"bytes"
+	_ "embed"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+// Путь сервиса SOAP
+const Path = "/soap"
+
+// Максимальный размер конверта запроса
+const maxEnvelopeSize = 1 << 20
+
+// Описание сервиса WSDL, адрес сервиса подставляется из запроса
+//
+//go:embed persons.wsdl
+var wsdlSource string
+
+var wsdlTemplate = template.Must(template.New("wsdl").Parse(wsdlSource))
+
+/*
+Обработчик SOAP 1.1/1.2 сервиса записей
+*/
+type Handler struct {
+	Storage *postgres.Storage
+}
+
+/*
+Функция создания обработчика
+*/
+func NewHandler(storage *postgres.Storage) *Handler {
+	return &Handler{Storage: storage}
+}
+
+/*
+Метод выдачи описания WSDL (GET /soap?wsdl)
+*/
+func (h *Handler) WSDL(context *gin.Context) {
+	scheme := "http"
+	if context.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := context.GetHeader("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	//Адрес экранируется: заголовок Host передает клиент
+	var location bytes.Buffer
+	_ = xml.EscapeText(&location, []byte(scheme+"://"+context.Request.Host+Path))
+	var buf bytes.Buffer
+	data := struct {
+		Location   string
+		Operations []string
+	}{Location: location.String(), Operations: operationNames}
+	if err := wsdlTemplate.Execute(&buf, data); err != nil {
+		logging.FromContext(context.Request.Context()).Error("error rendering wsdl", zap.Error(err))
+		middleware.AbortWithProblem(context, http.StatusInternalServerError, "Could not render WSDL.")
+		return
+	}
+	context.Data(http.StatusOK, "text/xml; charset=utf-8", buf.Bytes())
+}
+
+/*
+Метод обработки конверта SOAP.
+Версия протокола определяется по типу содержимого, операция - по элементу тела (SOAPAction не используется).
+*/
+func (h *Handler) Serve(context *gin.Context) {
+	v := versionOf(context.Request)
+	if v == nil {
+		middleware.AbortWithProblem(context, http.StatusUnsupportedMediaType, "Content type must be text/xml (SOAP 1.1) or application/soap+xml (SOAP 1.2).")
+		return
+	}
+	context.Request.Body = http.MaxBytesReader(context.Writer, context.Request.Body, maxEnvelopeSize)
+
+	//Конверт читается потоком: пространства имен, объявленные в Envelope, действуют и для тела
+	decoder := xml.NewDecoder(context.Request.Body)
+	element, err := firstElement(decoder)
+	if err != nil {
+		writeFault(context, v, parseFault(err))
+		return
+	}
+	if element.Name.Local != "Envelope" || element.Name.Space != v.namespace {
+		writeFault(context, v, envelopeFault("VersionMismatch", "Envelope namespace does not match the content type."))
+		return
+	}
+	if element, err = firstElement(decoder); err != nil {
+		writeFault(context, v, parseFault(err))
+		return
+	}
+	var header requestHeader
+	if element.Name.Space == v.namespace && element.Name.Local == "Header" {
+		if err := decoder.DecodeElement(&header, &element); err != nil {
+			writeFault(context, v, parseFault(err))
+			return
+		}
+		if element, err = firstElement(decoder); err != nil {
+			writeFault(context, v, parseFault(err))
+			return
+		}
+	}
+	if element.Name.Space != v.namespace || element.Name.Local != "Body" {
+		writeFault(context, v, clientFault("BAD_REQUEST", "Envelope has no Body."))
+		return
+	}
+	var securityHeader *headerEntry
+	for i, entry := range header.Entries {
+		if entry.XMLName.Space == wsseNamespace && entry.XMLName.Local == "Security" {
+			securityHeader = &header.Entries[i]
+			continue
+		}
+		if entry.mustUnderstand() {
+			writeFault(context, v, envelopeFault("MustUnderstand", "Header {"+entry.XMLName.Space+"}"+entry.XMLName.Local+" is not understood."))
+			return
+		}
+	}
+
+	start, err := firstElement(decoder)
+	if err != nil {
+		writeFault(context, v, clientFault("BAD_REQUEST", "Body has no operation element."))
+		return
+	}
+	op, ok := operations[start.Name.Local]
+	if !ok || start.Name.Space != serviceNamespace {
+		writeFault(context, v, clientFault("UNKNOWN_OPERATION", "Unknown operation {"+start.Name.Space+"}"+start.Name.Local+"."))
+		return
+	}
+
+	ctx, span := tracing.Tracer().Start(context.Request.Context(), "soap."+start.Name.Local)
+	defer span.End()
+	context.Request = context.Request.WithContext(ctx)
+	span.SetAttributes(attribute.String("soap.version", v.namespace))
+
+	if fault := authenticate(context, securityHeader, op.write); fault != nil {
+		writeFault(context, v, fault)
+		return
+	}
+	response, fault := op.call(h, context, func(request any) error {
+		return decoder.DecodeElement(request, &start)
+	})
+	if fault != nil {
+		if !fault.client {
+			span.SetStatus(otelcodes.Error, fault.message)
+		}
+		writeFault(context, v, fault)
+		return
+	}
+	if stream, ok := response.(*personStream); ok {
+		h.writeStream(context, v, stream)
+		return
+	}
+	writeEnvelope(context, v, http.StatusOK, response)
+}
+
+/*
+Ответ со списком записей, который пишется потоком по мере чтения из базы данных (EachPerson)
+*/
+type personStream struct {
+	//Элемент ответа операции
+	element string
+	//Строка поиска, пустая - все записи
+	query string
+}
+
+/*
+Метод потоковой записи конверта со списком записей: в памяти находится не больше одной порции записей.
+Конверт начинается с первой прочитанной записью, поэтому ошибка до нее возвращается как SOAP Fault,
+после нее передача прерывается.
+*/
+func (h *Handler) writeStream(context *gin.Context, v *version, stream *personStream) {
+	ctx := context.Request.Context()
+	role := middleware.RequestRole(context)
+	encoder := xml.NewEncoder(context.Writer)
+	//Открывающие элементы конверта, закрываются в обратном порядке
+	elements := []xml.StartElement{
+		{Name: xml.Name{Local: "soap:Envelope"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns:soap"}, Value: v.namespace}}},
+		{Name: xml.Name{Local: "soap:Body"}},
+		{Name: xml.Name{Space: serviceNamespace, Local: stream.element}},
+	}
+	started := false
+	start := func() error {
+		started = true
+		context.Header("Content-Type", v.contentType+"; charset=utf-8")
+		context.Status(http.StatusOK)
+		if _, err := io.WriteString(context.Writer, xml.Header); err != nil {
+			return err
+		}
+		for _, element := range elements {
+			if err := encoder.EncodeToken(element); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	//Поля, скрытые от роли, в поиске не участвуют и скрываются в ответе
+	err := h.Storage.EachPerson(ctx, stream.query, pii.HiddenFields(role), func(person *models.Person) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		pii.RedactPerson(person, role)
+		return encoder.EncodeElement(person, xml.StartElement{Name: xml.Name{Local: "person"}})
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	for i := len(elements) - 1; err == nil && i >= 0; i-- {
+		err = encoder.EncodeToken(elements[i].End())
+	}
+	if err == nil {
+		err = encoder.Flush()
+	}
+	if err == nil {
+		return
+	}
+	if !started {
+		writeFault(context, v, storageFault(ctx, err, "Could not fetch persons. Try again later."))
+		return
+	}
+	//Клиент отключился или чтение прервано после начала ответа
+	logging.FromContext(ctx).Error("soap stream failed", zap.String("operation", stream.element), zap.Error(err))
+	context.Abort()
+}
+
+/*
+Функция поиска следующего открывающего элемента
+*/
+func firstElement(decoder *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				return xml.StartElement{}, io.ErrUnexpectedEOF
+			}
+			return xml.StartElement{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start, nil
+		}
+	}
+}
+
+/*
+Функция ошибки разбора конверта
+*/
+func parseFault(err error) *soapFault {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return clientFault("BAD_REQUEST", "Envelope is too large.")
+	}
+	return clientFault("BAD_REQUEST", "Could not parse SOAP envelope.")
+}
+
+/*
+Функция ответа с конвертом SOAP
+*/
+func writeEnvelope(context *gin.Context, v *version, status int, content any) {
+	envelope := responseEnvelope{Namespace: v.namespace}
+	envelope.Body.Content = content
+	data, err := xml.Marshal(envelope)
+	if err != nil {
+		logging.FromContext(context.Request.Context()).Error("error encoding soap envelope", zap.Error(err))
+		context.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	context.Data(status, v.contentType+"; charset=utf-8", append([]byte(xml.Header), data...))
+}
+
+/*
+Функция ответа с ошибкой SOAP Fault
+*/
+func writeFault(context *gin.Context, v *version, fault *soapFault) {
+	writeEnvelope(context, v, fault.status(v), fault.element(v))
+	context.Abort()
+}
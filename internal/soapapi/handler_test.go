@@ -0,0 +1,347 @@
+package soapapi
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/database/dbtest"
+	"WST_lab6_server/internal/database/postgres"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/models"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+/*
+Функция настройки пользователей (пароль secret) и скрытия полей для роли viewer на время теста
+*/
+func setupConfig(t *testing.T) {
+	t.Helper()
+	logging.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedAuth, savedPII := *config.AuthSetting, *config.PIISetting
+	t.Cleanup(func() { *config.AuthSetting, *config.PIISetting = savedAuth, savedPII })
+	config.AuthSetting.Users = []config.UserConfig{
+		{Username: "viewer", PasswordHash: string(hash), Role: "viewer"},
+		{Username: "editor", PasswordHash: string(hash), Role: "editor"},
+	}
+	config.AuthSetting.AnonymousRole = "viewer"
+	config.PIISetting.Redaction = map[string][]string{"viewer": {"email", "telephone"}}
+}
+
+/*
+Функция создания маршрутизатора с /soap (как в routes) поверх тестовой базы данных с count записями
+*/
+func newTestEngine(t *testing.T, count int) *gin.Engine {
+	t.Helper()
+	storage := &postgres.Storage{DB: dbtest.Open(t, postgres.Tables...)}
+	for i := 1; i <= count; i++ {
+		person := &models.Person{Name: "Olga", Surname: fmt.Sprintf("Ditr%d", i), Age: 30 + i,
+			Email: fmt.Sprintf("olga%d@mail.com", i), Telephone: fmt.Sprintf("+7001123457%d", i%10)}
+		if _, err := storage.AddPerson(context.Background(), person); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := NewHandler(storage)
+	engine := gin.New()
+	engine.GET(Path, handler.WSDL)
+	engine.POST(Path, handler.Serve)
+	return engine
+}
+
+/*
+Функция построения заголовка wsse:Security с UsernameToken
+*/
+func securityHeader(username, password, passwordType string, created time.Time) string {
+	typeAttr := ""
+	if passwordType != "" {
+		typeAttr = ` Type="` + passwordType + `"`
+	}
+	return `<wsse:Security xmlns:wsse="` + wsseNamespace + `" soap:mustUnderstand="1"><wsse:UsernameToken>` +
+		`<wsse:Username>` + username + `</wsse:Username><wsse:Password` + typeAttr + `>` + password + `</wsse:Password>` +
+		`<wsu:Created xmlns:wsu="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">` +
+		created.UTC().Format(time.RFC3339) + `</wsu:Created></wsse:UsernameToken></wsse:Security>`
+}
+
+/*
+Функция отправки конверта версии v с заголовком header и операцией body
+*/
+func call(t *testing.T, engine *gin.Engine, v *version, header string, body string) (*httptest.ResponseRecorder, envelopeResult) {
+	t.Helper()
+	envelope := `<?xml version="1.0" encoding="UTF-8"?><soap:Envelope xmlns:soap="` + v.namespace + `" xmlns:p="` + serviceNamespace + `">`
+	if header != "" {
+		envelope += `<soap:Header>` + header + `</soap:Header>`
+	}
+	envelope += `<soap:Body>` + body + `</soap:Body></soap:Envelope>`
+	request := httptest.NewRequest(http.MethodPost, Path, strings.NewReader(envelope))
+	request.Header.Set("Content-Type", v.contentType+"; charset=utf-8")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	var result envelopeResult
+	if err := xml.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatalf("%d %s: %v", recorder.Code, recorder.Body, err)
+	}
+	return recorder, result
+}
+
+/*
+Разобранный конверт ответа (элементы сопоставляются по локальным именам)
+*/
+type envelopeResult struct {
+	XMLName xml.Name
+	Body    struct {
+		Fault *struct {
+			//SOAP 1.1
+			Code   string `xml:"faultcode"`
+			String string `xml:"faultstring"`
+			//SOAP 1.2
+			Value   string `xml:"Code>Value"`
+			Subcode string `xml:"Code>Subcode>Value"`
+			Reason  string `xml:"Reason>Text"`
+			//Код сервиса в detail (1.1) или Detail (1.2)
+			Detail   string `xml:"detail>personFault>code"`
+			Detail12 string `xml:"Detail>personFault>code"`
+		} `xml:"Fault"`
+		All    []models.Person `xml:"getAllPersonsResponse>person"`
+		Search *struct {
+			Persons []models.Person `xml:"person"`
+		} `xml:"searchPersonResponse"`
+		Person *models.Person `xml:"getPersonResponse>person"`
+		ID     uint           `xml:"addPersonResponse>id"`
+	} `xml:"Body"`
+}
+
+func TestEnvelopeVersions(t *testing.T) {
+	setupConfig(t)
+	engine := newTestEngine(t, 3)
+	for _, v := range []*version{soap11, soap12} {
+		recorder, result := call(t, engine, v, "", `<p:getAllPersons/>`)
+		if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), v.contentType) ||
+			result.XMLName.Space != v.namespace || len(result.Body.All) != 3 {
+			t.Errorf("%s getAllPersons: %d %s", v.namespace, recorder.Code, recorder.Body)
+		}
+		//Ошибка отправителя: 500 и soap:Client в 1.1, 400 и soap:Sender в 1.2
+		recorder, result = call(t, engine, v, "", `<p:getPerson><p:id>0</p:id></p:getPerson>`)
+		fault := result.Body.Fault
+		if fault == nil || fault.Code+fault.Value != "soap:"+v.sender || fault.Detail+fault.Detail12 != "BAD_REQUEST" ||
+			recorder.Code != map[*version]int{soap11: http.StatusInternalServerError, soap12: http.StatusBadRequest}[v] {
+			t.Errorf("%s getPerson fault: %d %s", v.namespace, recorder.Code, recorder.Body)
+		}
+	}
+	//Пространство имен конверта не соответствует типу содержимого
+	mismatch := &version{namespace: soap12Namespace, contentType: soap11ContentType}
+	_, result := call(t, engine, mismatch, "", `<p:getAllPersons/>`)
+	if result.Body.Fault == nil || result.Body.Fault.Code != "soap:VersionMismatch" {
+		t.Errorf("version mismatch: %+v", result.Body.Fault)
+	}
+	request := httptest.NewRequest(http.MethodPost, Path, strings.NewReader(`{}`))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("json request: %d", recorder.Code)
+	}
+}
+
+func TestUsernameToken(t *testing.T) {
+	setupConfig(t)
+	engine := newTestEngine(t, 0)
+	add := `<p:addPerson><p:person><p:name>Ivan</p:name><p:surname>Ivanov</p:surname><p:age>30</p:age>` +
+		`<p:email>ivan%d@mail.com</p:email><p:telephone>+79990000001</p:telephone></p:person></p:addPerson>`
+	now := time.Now()
+	tests := []struct {
+		name    string
+		header  string
+		code    string
+		detail  string
+		message string
+	}{
+		{"missing", "", "wsse:FailedAuthentication", "", "is required"},
+		{"wrong password", securityHeader("editor", "wrong", passwordText, now), "wsse:FailedAuthentication", "", "Invalid username or password"},
+		{"expired", securityHeader("editor", "secret", passwordText, now.Add(-10*time.Minute)), "wsse:FailedAuthentication", "", "expired"},
+		{"digest", securityHeader("editor", "c2VjcmV0", passwordDigest, now), "wsse:UnsupportedSecurityToken", "", "PasswordDigest"},
+		{"viewer", securityHeader("viewer", "secret", passwordText, now), "soap:Client", "FORBIDDEN", "not allowed"},
+		{"editor", securityHeader("editor", "secret", passwordText, now), "", "", ""},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder, result := call(t, engine, soap11, test.header, fmt.Sprintf(add, i))
+			fault := result.Body.Fault
+			if test.code == "" {
+				if fault != nil || result.Body.ID == 0 {
+					t.Errorf("%d %s", recorder.Code, recorder.Body)
+				}
+				return
+			}
+			if fault == nil || fault.Code != test.code || fault.Detail != test.detail || !strings.Contains(fault.String, test.message) {
+				t.Errorf("%d %s", recorder.Code, recorder.Body)
+			}
+		})
+	}
+	//В SOAP 1.2 код WS-Security передается подкодом
+	_, result := call(t, engine, soap12, securityHeader("editor", "wrong", "", now), fmt.Sprintf(add, 0))
+	if fault := result.Body.Fault; fault == nil || fault.Value != "soap:Sender" || fault.Subcode != "wsse:FailedAuthentication" {
+		t.Errorf("soap 1.2 fault: %+v", fault)
+	}
+	//Изменяющие операции без роли editor отклоняются, чтение доступно
+	for _, body := range []string{
+		`<p:updatePerson><p:id>1</p:id><p:person><p:name>Petr</p:name></p:person></p:updatePerson>`,
+		`<p:deletePerson><p:id>1</p:id></p:deletePerson>`,
+	} {
+		_, result := call(t, engine, soap11, securityHeader("viewer", "secret", passwordText, now), body)
+		if fault := result.Body.Fault; fault == nil || fault.Detail != "FORBIDDEN" {
+			t.Errorf("viewer %s: %+v", body, fault)
+		}
+	}
+	if _, result := call(t, engine, soap11, securityHeader("viewer", "secret", passwordText, now), `<p:getPerson><p:id>1</p:id></p:getPerson>`); result.Body.Person == nil {
+		t.Errorf("viewer getPerson: %+v", result.Body.Fault)
+	}
+}
+
+func TestMustUnderstand(t *testing.T) {
+	setupConfig(t)
+	engine := newTestEngine(t, 1)
+	for _, v := range []*version{soap11, soap12} {
+		recorder, result := call(t, engine, v, `<t:Trace xmlns:t="urn:trace" soap:mustUnderstand="1">abc</t:Trace>`, `<p:getAllPersons/>`)
+		fault := result.Body.Fault
+		if fault == nil || fault.Code+fault.Value != "soap:MustUnderstand" || recorder.Code != http.StatusInternalServerError {
+			t.Errorf("%s: %d %s", v.namespace, recorder.Code, recorder.Body)
+		}
+		//Необязательный заголовок пропускается
+		_, result = call(t, engine, v, `<t:Trace xmlns:t="urn:trace">abc</t:Trace>`, `<p:getAllPersons/>`)
+		if result.Body.Fault != nil || len(result.Body.All) != 1 {
+			t.Errorf("%s optional header: %+v", v.namespace, result.Body.Fault)
+		}
+	}
+}
+
+func TestSearchRedaction(t *testing.T) {
+	setupConfig(t)
+	engine := newTestEngine(t, 2)
+	_, result := call(t, engine, soap11, "", `<p:searchPerson><p:query>Olga</p:query></p:searchPerson>`)
+	if result.Body.Search == nil || len(result.Body.Search.Persons) != 2 {
+		t.Fatalf("search: %+v", result.Body)
+	}
+	for _, person := range result.Body.Search.Persons {
+		if strings.HasPrefix(person.Email, "olga") || person.Telephone == "" || person.Name != "Olga" {
+			t.Errorf("person not redacted: %+v", person)
+		}
+	}
+	//Скрытые поля в поиске не участвуют: пустой ответ, а не ошибка
+	_, result = call(t, engine, soap11, "", `<p:searchPerson><p:query>olga1@</p:query></p:searchPerson>`)
+	if result.Body.Fault != nil || result.Body.Search == nil || len(result.Body.Search.Persons) != 0 {
+		t.Errorf("search by hidden email: %+v", result.Body)
+	}
+	_, result = call(t, engine, soap11, securityHeader("editor", "secret", passwordText, time.Now()), `<p:searchPerson><p:query>olga1@</p:query></p:searchPerson>`)
+	if result.Body.Search == nil || len(result.Body.Search.Persons) != 1 || result.Body.Search.Persons[0].Email != "olga1@mail.com" {
+		t.Errorf("editor search by email: %+v", result.Body)
+	}
+}
+
+/*
+Описание WSDL (только проверяемые элементы)
+*/
+type wsdlDefinitions struct {
+	Elements []struct {
+		Name string `xml:"name,attr"`
+	} `xml:"types>schema>element"`
+	Messages []struct {
+		Name string `xml:"name,attr"`
+		Part struct {
+			Element string `xml:"element,attr"`
+		} `xml:"part"`
+	} `xml:"message"`
+	PortType struct {
+		Operations []struct {
+			Name   string    `xml:"name,attr"`
+			Input  wsdlIORef `xml:"input"`
+			Output wsdlIORef `xml:"output"`
+		} `xml:"operation"`
+	} `xml:"portType"`
+	Bindings []struct {
+		Operations []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"operation"`
+	} `xml:"binding"`
+	Ports []struct {
+		Address struct {
+			Location string `xml:"location,attr"`
+		} `xml:"address"`
+	} `xml:"service>port"`
+}
+
+// Ссылка операции на сообщение
+type wsdlIORef struct {
+	Message string `xml:"message,attr"`
+}
+
+func TestWSDLMatchesOperations(t *testing.T) {
+	setupConfig(t)
+	engine := newTestEngine(t, 0)
+	request := httptest.NewRequest(http.MethodGet, Path+"?wsdl", nil)
+	request.Host = "persons.example:8095"
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	var wsdl wsdlDefinitions
+	if err := xml.Unmarshal(recorder.Body.Bytes(), &wsdl); err != nil {
+		t.Fatalf("%d: %v", recorder.Code, err)
+	}
+	var names []string
+	for name := range operations {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if sorted := slices.Sorted(slices.Values(operationNames)); !slices.Equal(sorted, names) {
+		t.Fatalf("operationNames %v, operations %v", operationNames, names)
+	}
+	elements := map[string]bool{}
+	for _, element := range wsdl.Elements {
+		elements[element.Name] = true
+	}
+	messages := map[string]string{}
+	for _, message := range wsdl.Messages {
+		messages["tns:"+message.Name] = message.Part.Element
+	}
+	var portOperations []string
+	for _, op := range wsdl.PortType.Operations {
+		portOperations = append(portOperations, op.Name)
+		//Запрос - элемент с именем операции, ответ - <операция>Response
+		input, output := messages[op.Input.Message], messages[op.Output.Message]
+		if input != "tns:"+op.Name || output != "tns:"+op.Name+"Response" || !elements[op.Name] || !elements[op.Name+"Response"] {
+			t.Errorf("operation %s: input %s, output %s", op.Name, input, output)
+		}
+	}
+	if !slices.Equal(portOperations, operationNames) {
+		t.Errorf("portType operations %v, want %v", portOperations, operationNames)
+	}
+	if len(wsdl.Bindings) != 2 {
+		t.Fatalf("%d bindings", len(wsdl.Bindings))
+	}
+	for _, binding := range wsdl.Bindings {
+		var bound []string
+		for _, op := range binding.Operations {
+			bound = append(bound, op.Name)
+		}
+		if !slices.Equal(bound, operationNames) {
+			t.Errorf("binding operations %v, want %v", bound, operationNames)
+		}
+	}
+	for _, port := range wsdl.Ports {
+		if port.Address.Location != "http://persons.example:8095"+Path {
+			t.Errorf("location %q", port.Address.Location)
+		}
+	}
+}
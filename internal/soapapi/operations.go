@@ -0,0 +1,226 @@
+package soapapi
+
+import (
+	"WST_lab6_server/internal/database"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/metrics"
+	"WST_lab6_server/internal/middleware"
+	"WST_lab6_server/internal/models"
+	"WST_lab6_server/internal/openapi"
+	"WST_lab6_server/internal/pii"
+	"context"
+	"encoding/xml"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+/*
+Операция сервиса: изменяющие операции требуют WS-Security, как изменяющие маршруты REST API
+*/
+type operation struct {
+	write bool
+	call  func(h *Handler, context *gin.Context, decode func(request any) error) (any, *soapFault)
+}
+
+// Операции сервиса по имени элемента тела запроса
+var operations = map[string]operation{
+	"searchPerson":  {call: (*Handler).searchPerson},
+	"getAllPersons": {call: (*Handler).getAllPersons},
+	"getPerson":     {call: (*Handler).getPerson},
+	"addPerson":     {write: true, call: (*Handler).addPerson},
+	"updatePerson":  {write: true, call: (*Handler).updatePerson},
+	"deletePerson":  {write: true, call: (*Handler).deletePerson},
+}
+
+// Имена операций в порядке описания WSDL
+var operationNames = []string{"searchPerson", "getAllPersons", "getPerson", "addPerson", "updatePerson", "deletePerson"}
+
+// Запросы и ответы операций (элементы схемы WSDL)
+type (
+	searchPersonRequest struct {
+		Query string `xml:"query"`
+	}
+	personIDRequest struct {
+		ID uint `xml:"id"`
+	}
+	getPersonResponse struct {
+		XMLName xml.Name       `xml:"http://wst-lab6/persons/v1 getPersonResponse"`
+		Person  *models.Person `xml:"person"`
+	}
+	addPersonRequest struct {
+		Person *models.Person `xml:"person"`
+	}
+	addPersonResponse struct {
+		XMLName xml.Name `xml:"http://wst-lab6/persons/v1 addPersonResponse"`
+		ID      uint     `xml:"id"`
+	}
+	updatePersonRequest struct {
+		ID     uint           `xml:"id"`
+		Person *models.Person `xml:"person"`
+	}
+	updatePersonResponse struct {
+		XMLName xml.Name `xml:"http://wst-lab6/persons/v1 updatePersonResponse"`
+	}
+	deletePersonResponse struct {
+		XMLName xml.Name `xml:"http://wst-lab6/persons/v1 deletePersonResponse"`
+	}
+)
+
+/*
+Функция преобразования ошибок пакета database в SOAP Fault
+*/
+func storageFault(ctx context.Context, err error, message string) *soapFault {
+	switch {
+	case errors.Is(err, database.ErrPersonNotFound):
+		return clientFault("NOT_FOUND", "Person not found.")
+	case errors.Is(err, database.ErrEmailExists):
+		return clientFault("CONFLICT", "Email already in use.")
+	case errors.Is(err, database.ErrInvalidInput), errors.Is(err, database.ErrEmptyQuery), errors.Is(err, database.ErrQueryTooLong):
+		return clientFault("BAD_REQUEST", err.Error())
+	case errors.Is(err, database.ErrQueryTimeout):
+		return serverFault("TIMEOUT", "Database query timed out.")
+	case errors.Is(err, database.ErrUnavailable):
+		return serverFault("UNAVAILABLE", "Database is unavailable.")
+	}
+	logging.FromContext(ctx).Error("storage error", zap.Error(err))
+	return serverFault("INTERNAL_SERVER_ERROR", message)
+}
+
+/*
+Функция проверки записи по схеме документа OpenAPI (PersonCreate, PersonUpdate)
+*/
+func validatePerson(schema string, person *models.Person) *soapFault {
+	violations, err := openapi.ValidateSchema(schema, person)
+	if err != nil {
+		return serverFault("INTERNAL_SERVER_ERROR", "Request validation is unavailable.")
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	fault := clientFault("BAD_REQUEST", "Request does not match the API specification.")
+	fault.violations = violations
+	return fault
+}
+
+/*
+Функция разбора элемента операции
+*/
+func decodeRequest(decode func(request any) error, request any) *soapFault {
+	if err := decode(request); err != nil {
+		return clientFault("BAD_REQUEST", "Could not parse request data.")
+	}
+	return nil
+}
+
+/*
+Поиск по всем полям. Как и в gRPC, пустая выборка возвращается как пустой список.
+Результат пишется в ответ потоком (personStream).
+*/
+func (h *Handler) searchPerson(context *gin.Context, decode func(request any) error) (any, *soapFault) {
+	var request searchPersonRequest
+	if fault := decodeRequest(decode, &request); fault != nil {
+		return nil, fault
+	}
+	if request.Query == "" {
+		return nil, clientFault("BAD_REQUEST", "Search query is required.")
+	}
+	return &personStream{element: "searchPersonResponse", query: request.Query}, nil
+}
+
+/*
+Все записи, пишутся в ответ потоком (personStream)
+*/
+func (h *Handler) getAllPersons(context *gin.Context, decode func(request any) error) (any, *soapFault) {
+	return &personStream{element: "getAllPersonsResponse"}, nil
+}
+
+func (h *Handler) getPerson(context *gin.Context, decode func(request any) error) (any, *soapFault) {
+	var request personIDRequest
+	if fault := decodeRequest(decode, &request); fault != nil {
+		return nil, fault
+	}
+	if request.ID == 0 {
+		return nil, clientFault("BAD_REQUEST", "Person id is required.")
+	}
+	person, err := h.Storage.GetPerson(context.Request.Context(), request.ID)
+	if err != nil {
+		return nil, storageFault(context.Request.Context(), err, "Could not fetch person.")
+	}
+	pii.RedactPerson(person, middleware.RequestRole(context))
+	return &getPersonResponse{Person: person}, nil
+}
+
+func (h *Handler) addPerson(context *gin.Context, decode func(request any) error) (any, *soapFault) {
+	var request addPersonRequest
+	if fault := decodeRequest(decode, &request); fault != nil {
+		return nil, fault
+	}
+	if request.Person == nil {
+		return nil, clientFault("BAD_REQUEST", "Person is required.")
+	}
+	if request.Person.ID != 0 {
+		return nil, clientFault("BAD_REQUEST", "Person id is assigned by the server.")
+	}
+	if fault := validatePerson("PersonCreate", request.Person); fault != nil {
+		return nil, fault
+	}
+	id, err := h.Storage.AddPerson(context.Request.Context(), request.Person)
+	if err != nil {
+		return nil, storageFault(context.Request.Context(), err, "Could not create person.")
+	}
+	metrics.PersonsCreated.Inc()
+	return &addPersonResponse{ID: id}, nil
+}
+
+func (h *Handler) updatePerson(context *gin.Context, decode func(request any) error) (any, *soapFault) {
+	var request updatePersonRequest
+	if fault := decodeRequest(decode, &request); fault != nil {
+		return nil, fault
+	}
+	if request.ID == 0 {
+		return nil, clientFault("BAD_REQUEST", "Person id is required.")
+	}
+	if request.Person == nil {
+		return nil, clientFault("BAD_REQUEST", "Person is required.")
+	}
+	person := request.Person
+	person.ID = 0
+	if fault := validatePerson("PersonUpdate", person); fault != nil {
+		return nil, fault
+	}
+	person.ID = request.ID
+	ctx := context.Request.Context()
+	//Проверяем уникальность email с исключением текущего ID
+	if _, err := h.Storage.CheckPersonByEmail(ctx, person.Email, person.ID); err == nil {
+		return nil, clientFault("CONFLICT", "Email already in use.")
+	} else if !errors.Is(err, database.ErrPersonNotFound) {
+		return nil, storageFault(ctx, err, "Could not update person.")
+	}
+	if err := h.Storage.UpdatePerson(ctx, person); err != nil {
+		return nil, storageFault(ctx, err, "Could not update person.")
+	}
+	metrics.PersonsUpdated.Inc()
+	return &updatePersonResponse{}, nil
+}
+
+func (h *Handler) deletePerson(context *gin.Context, decode func(request any) error) (any, *soapFault) {
+	var request personIDRequest
+	if fault := decodeRequest(decode, &request); fault != nil {
+		return nil, fault
+	}
+	if request.ID == 0 {
+		return nil, clientFault("BAD_REQUEST", "Person id is required.")
+	}
+	ctx := context.Request.Context()
+	//Проверяем наличие записи, чтобы вернуть NOT_FOUND
+	if _, err := h.Storage.GetPerson(ctx, request.ID); err != nil {
+		return nil, storageFault(ctx, err, "Could not fetch the person.")
+	}
+	if err := h.Storage.DeletePerson(ctx, &models.Person{ID: request.ID}); err != nil {
+		return nil, storageFault(ctx, err, "Could not delete person.")
+	}
+	metrics.PersonsDeleted.Inc()
+	return &deletePersonResponse{}, nil
+}
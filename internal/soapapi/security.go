@@ -0,0 +1,96 @@
+package soapapi
+
+import (
+	"WST_lab6_server/internal/metrics"
+	"WST_lab6_server/internal/middleware"
+	"WST_lab6_server/internal/tracing"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Типы пароля UsernameToken
+const (
+	passwordText   = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordText"
+	passwordDigest = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest"
+)
+
+// Допустимое отклонение времени создания токена (wsu:Created)
+const tokenMaxAge = 5 * time.Minute
+
+/*
+Токен wsse:UsernameToken заголовка wsse:Security
+*/
+type usernameToken struct {
+	Username string `xml:"Username"`
+	Password struct {
+		Type  string `xml:"Type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"Password"`
+	Created string `xml:"Created"`
+}
+
+/*
+Функция проверки заголовка WS-Security по тем же пользователям, что и BasicAuthMiddleware.
+Без заголовка запрос выполняется с анонимной ролью, изменяющие операции его требуют (роль editor или admin).
+Пароли хранятся в виде bcrypt, поэтому поддерживается только PasswordText (запросы по TLS).
+*/
+func authenticate(context *gin.Context, header *headerEntry, write bool) *soapFault {
+	if header == nil {
+		if write {
+			metrics.AuthFailures.WithLabelValues("missing_header").Inc()
+			return securityFault("FailedAuthentication", "Security header with UsernameToken is required")
+		}
+		context.Set(middleware.RoleKey, middleware.AnonymousRole())
+		return nil
+	}
+	//Спан охватывает только проверку учетных данных
+	_, span := tracing.Tracer().Start(context.Request.Context(), "soap.UsernameToken")
+	defer span.End()
+	fail := func(reason string, securityCode string, message string) *soapFault {
+		metrics.AuthFailures.WithLabelValues(reason).Inc()
+		span.SetStatus(codes.Error, reason)
+		return securityFault(securityCode, message)
+	}
+
+	token := header.UsernameToken
+	if token == nil {
+		return fail("invalid_format", "InvalidSecurity", "Security header must contain UsernameToken")
+	}
+	switch token.Password.Type {
+	case "", passwordText:
+	case passwordDigest:
+		return fail("invalid_format", "UnsupportedSecurityToken", "PasswordDigest is not supported, use PasswordText")
+	default:
+		return fail("invalid_format", "UnsupportedSecurityToken", "Unknown password type")
+	}
+	if token.Created != "" {
+		created, err := time.Parse(time.RFC3339, strings.TrimSpace(token.Created))
+		if err != nil {
+			return fail("invalid_format", "InvalidSecurityToken", "Invalid Created timestamp")
+		}
+		if age := time.Since(created); age > tokenMaxAge || age < -tokenMaxAge {
+			return fail("expired_token", "FailedAuthentication", "Security token has expired")
+		}
+	}
+
+	username := strings.TrimSpace(token.Username)
+	span.SetAttributes(attribute.String("enduser.id", username))
+	role, ok := middleware.Authenticate(context.Request.Context(), username, token.Password.Value)
+	if !ok {
+		return fail("invalid_credentials", "FailedAuthentication", "Invalid username or password")
+	}
+	span.SetAttributes(attribute.String("enduser.role", role))
+	//Изменяющие операции доступны ролям editor и admin
+	if write && !middleware.HasRole(role, middleware.WriteRoles...) {
+		metrics.AuthFailures.WithLabelValues("forbidden").Inc()
+		span.SetStatus(codes.Error, "forbidden")
+		return clientFault("FORBIDDEN", "Role "+role+" is not allowed to change persons.")
+	}
+	context.Set(middleware.RoleKey, role)
+	middleware.SetRequestUser(context, username)
+	return nil
+}
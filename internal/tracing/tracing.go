@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"WST_lab6_server/config"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Имя инструментирующей библиотеки
+const instrumentationName = "WST_lab6_server"
+
+// Имя сервиса по умолчанию
+const defaultServiceName = "wst-lab6-server"
+
+/*
+Функция получения трассировщика сервера
+*/
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+/*
+Функция инициализации трассировки по настройкам TracingSetting.
+Возвращает функцию завершения, которая выгружает накопленные спаны.
+При выключенной трассировке используется глобальный трассировщик без экспорта.
+*/
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	//Распространение контекста по заголовкам W3C traceparent/tracestate и baggage
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	setting := config.TracingSetting
+	if !setting.Enabled || setting.Exporter == "" || setting.Exporter == "none" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, closeOutput, err := newExporter(ctx, setting)
+	if err != nil {
+		return nil, err
+	}
+	serviceName := setting.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.DeploymentEnvironment(config.GeneralServerSetting.Env),
+	))
+	if err != nil {
+		return nil, err
+	}
+	//Доля сохраняемых трасс, решение родителя имеет приоритет
+	sampler := sdktrace.ParentBased(sdktrace.TraceIDRatioBased(setting.SampleRatio))
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	)
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeOutput != nil {
+			if closeErr := closeOutput.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+/*
+Функция создания экспортера спанов: otlp-grpc, otlp-http, stdout или file
+*/
+func newExporter(ctx context.Context, setting *config.TracingConfig) (sdktrace.SpanExporter, io.Closer, error) {
+	switch strings.ToLower(setting.Exporter) {
+	case "otlp", "otlp-grpc":
+		options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(setting.Endpoint)}
+		if setting.Insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(ctx, options...)
+		return exporter, nil, err
+	case "otlp-http":
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(setting.Endpoint)}
+		if setting.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, options...)
+		return exporter, nil, err
+	case "stdout":
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return exporter, nil, err
+	case "file":
+		file, err := os.OpenFile(setting.FilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return exporter, file, nil
+	}
+	return nil, nil, fmt.Errorf("unknown tracing exporter %q", setting.Exporter)
+}
@@ -0,0 +1,45 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+/*
+Функция проверки адреса получателя: запросы к loopback, частным, link-local и служебным адресам
+запрещены, чтобы подписка не открывала доступ к внутренней сети (SSRF)
+*/
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast() &&
+		!cgnatPrefix.Contains(addr)
+}
+
+// Общий адресный блок операторов связи (RFC 6598), не относится к IsPrivate
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+/*
+Функция создания DialContext, проверяющего адрес после разрешения имени.
+Проверка в Control выполняется для каждого адреса, к которому устанавливается соединение,
+поэтому ее не обойти подменой DNS между проверкой и подключением.
+*/
+func newDialContext(timeout time.Duration, allowPrivate bool) func(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddress(addrPort.Addr()) {
+				return fmt.Errorf("webhook target %s is not a public address", addrPort.Addr())
+			}
+			return nil
+		}
+	}
+	return dialer.DialContext
+}
@@ -0,0 +1,64 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Заголовки запроса доставки
+const (
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Префикс подписи (алгоритм HMAC)
+const signaturePrefix = "sha256="
+
+/*
+Функция подписи тела запроса: HMAC-SHA256 от "<timestamp>.<тело>" с секретом подписки.
+Метка времени входит в подпись, чтобы получатель мог отклонять повторно отправленные старые запросы.
+*/
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+/*
+Функция проверки подписи на стороне получателя (X-Webhook-Timestamp и X-Webhook-Signature).
+Запросы старше tolerance отклоняются.
+*/
+func Verify(secret string, timestampHeader string, signatureHeader string, body []byte, tolerance time.Duration) bool {
+	seconds, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return false
+	}
+	timestamp := time.Unix(seconds, 0)
+	if age := time.Since(timestamp); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return false
+	}
+	if !strings.HasPrefix(signatureHeader, signaturePrefix) {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signatureHeader))
+}
+
+/*
+Функция создания секрета подписки
+*/
+func NewSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,313 @@
+package webhooks
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/events"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/metrics"
+	"WST_lab6_server/internal/models"
+	"WST_lab6_server/internal/pii"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Значения по умолчанию
+const (
+	defaultMaxAttempts    = 8
+	defaultInitialBackoff = 5 * time.Second
+	defaultMaxBackoff     = time.Hour
+	defaultTimeout        = 10 * time.Second
+	defaultWorkers        = 4
+	defaultPollInterval   = time.Second
+	defaultPayloadRole    = "viewer"
+	//Сохраняемая в журнале часть ответа получателя
+	maxResponseBody = 1024
+	//Ограничение времени записи результата попытки
+	recordTimeout = 5 * time.Second
+)
+
+// User-Agent запросов доставки
+const userAgent = "WST_lab6_server-webhooks/1.0"
+
+/*
+Хранилище подписок и очереди доставок (postgres.Storage)
+*/
+type Store interface {
+	ActiveWebhooks(ctx context.Context) ([]models.Webhook, error)
+	AddWebhookDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt *models.WebhookAttempt) error
+}
+
+/*
+Отправитель webhook: ставит события в очередь доставок и отправляет их с повторами.
+События поступают от диспетчера outbox (outbox.WebhookSink); очередь хранится в базе данных,
+поэтому доставки переживают перезапуск сервера.
+*/
+type Worker struct {
+	store Store
+	//HTTP клиент доставки (в тестах можно заменить)
+	Client         *http.Client
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	timeout        time.Duration
+	workers        int
+	pollInterval   time.Duration
+	//Роль, по правилам которой скрываются поля записи в теле доставки
+	payloadRole string
+	//Сигнал о новых доставках, чтобы не ждать следующей проверки очереди
+	wake chan struct{}
+}
+
+/*
+Функция создания отправителя по конфигурации webhooks
+*/
+func NewWorker(store Store) *Worker {
+	cfg := config.WebhooksSetting
+	w := &Worker{
+		store:          store,
+		maxAttempts:    valueOr(cfg.MaxAttempts, defaultMaxAttempts),
+		initialBackoff: valueOr(cfg.InitialBackoff, defaultInitialBackoff),
+		maxBackoff:     valueOr(cfg.MaxBackoff, defaultMaxBackoff),
+		timeout:        valueOr(cfg.Timeout, defaultTimeout),
+		workers:        valueOr(cfg.Workers, defaultWorkers),
+		pollInterval:   valueOr(cfg.PollInterval, defaultPollInterval),
+		payloadRole:    cfg.PayloadRole,
+		wake:           make(chan struct{}, 1),
+	}
+	if w.payloadRole == "" {
+		w.payloadRole = defaultPayloadRole
+	}
+	w.Client = &http.Client{
+		Timeout: w.timeout,
+		//Без прокси: адрес получателя проверяется при подключении
+		Transport: &http.Transport{
+			DialContext:         newDialContext(w.timeout, cfg.AllowPrivateTargets),
+			TLSHandshakeTimeout: w.timeout,
+			MaxIdleConnsPerHost: w.workers,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		//Перенаправление считается неудачной попыткой: POST не должен превращаться в GET
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return w
+}
+
+func valueOr[T int | time.Duration](value T, fallback T) T {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
+
+/*
+Метод работы отправителя до отмены контекста.
+Начатые отправки завершаются (не дольше timeout), новые не выбираются.
+*/
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+	for {
+		w.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+/*
+Метод постановки события в очередь доставок всех активных подписок на этот тип.
+Поля записи скрываются по правилам pii.redaction для роли webhooks.payloadRole.
+*/
+func (w *Worker) Enqueue(ctx context.Context, event events.Event) error {
+	webhooks, err := w.store.ActiveWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+	if event.Person != nil {
+		person := *event.Person
+		pii.RedactPerson(&person, w.payloadRole)
+		event.Person = &person
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var deliveries []models.WebhookDelivery
+	for _, webhook := range webhooks {
+		if !webhook.Accepts(event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       payload,
+			Status:        models.DeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := w.store.AddWebhookDeliveries(ctx, deliveries); err != nil {
+		return err
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+/*
+Метод отправки доставок, время которых наступило, порциями по числу одновременных отправок
+*/
+func (w *Worker) dispatch(ctx context.Context) {
+	for ctx.Err() == nil {
+		//Доставка порции занимает не больше timeout, запас на запись результата
+		deliveries, err := w.store.ClaimWebhookDeliveries(ctx, w.workers, 2*w.timeout+recordTimeout)
+		if err != nil {
+			if ctx.Err() == nil {
+				logging.Logger.Error("error claiming webhook deliveries", zap.Error(err))
+			}
+			return
+		}
+		var wg sync.WaitGroup
+		for i := range deliveries {
+			wg.Add(1)
+			go func(delivery *models.WebhookDelivery) {
+				defer wg.Done()
+				w.deliver(delivery)
+			}(&deliveries[i])
+		}
+		wg.Wait()
+		if len(deliveries) < w.workers {
+			return
+		}
+	}
+}
+
+/*
+Метод одной попытки доставки и записи ее результата.
+Успех - ответ 2xx; иначе повтор через initialBackoff * 2^(попытка-1), после maxAttempts - состояние dead.
+*/
+func (w *Worker) deliver(delivery *models.WebhookDelivery) {
+	//Подписка удалена после выбора доставки
+	if delivery.Webhook == nil {
+		return
+	}
+	logger := logging.Logger.With(
+		zap.Uint("webhook_id", delivery.WebhookID),
+		zap.Uint("delivery_id", delivery.ID),
+		zap.String("event_type", delivery.EventType))
+	start := time.Now()
+	statusCode, responseBody, err := w.send(delivery, start)
+	duration := time.Since(start)
+	metrics.WebhookAttemptDuration.Observe(duration.Seconds())
+
+	delivery.Attempts++
+	attempt := &models.WebhookAttempt{
+		DeliveryID:   delivery.ID,
+		Attempt:      delivery.Attempts,
+		StatusCode:   statusCode,
+		ResponseBody: responseBody,
+		DurationMs:   duration.Milliseconds(),
+	}
+	delivery.LastStatusCode = statusCode
+	if err == nil && (statusCode < 200 || statusCode > 299) {
+		err = fmt.Errorf("unexpected status %d", statusCode)
+	}
+	result := "delivered"
+	if err == nil {
+		now := time.Now()
+		delivery.Status = models.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	} else {
+		attempt.Error = err.Error()
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= w.maxAttempts {
+			delivery.Status = models.DeliveryDead
+			result = "dead"
+		} else {
+			delivery.Status = models.DeliveryPending
+			delivery.NextAttemptAt = time.Now().Add(w.backoff(delivery.Attempts))
+			result = "retry"
+		}
+	}
+	metrics.WebhookAttempts.WithLabelValues(result).Inc()
+	switch result {
+	case "dead":
+		logger.Error("webhook delivery failed permanently", zap.Int("attempts", delivery.Attempts), zap.Error(err))
+	case "retry":
+		logger.Warn("webhook delivery failed", zap.Int("attempt", delivery.Attempts), zap.Time("next_attempt_at", delivery.NextAttemptAt), zap.Error(err))
+	default:
+		logger.Debug("webhook delivered", zap.Int("attempt", delivery.Attempts), zap.Duration("latency", duration))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+	if err := w.store.RecordWebhookAttempt(ctx, delivery, attempt); err != nil {
+		//Доставка будет повторена по истечении lease
+		logger.Error("error recording webhook attempt", zap.Error(err))
+	}
+}
+
+/*
+Метод отправки запроса получателю: статус и начало тела ответа
+*/
+func (w *Worker) send(delivery *models.WebhookDelivery, now time.Time) (int, string, error) {
+	//Контекст не связан с остановкой сервера: начатая попытка завершается
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", userAgent)
+	request.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	request.Header.Set(HeaderEvent, delivery.EventType)
+	request.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	request.Header.Set(HeaderSignature, Sign(delivery.Webhook.Secret, now, delivery.Payload))
+	response, err := w.Client.Do(request)
+	if err != nil {
+		return 0, "", err
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxResponseBody))
+	//Дочитываем ответ, чтобы соединение вернулось в пул
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	return response.StatusCode, string(body), nil
+}
+
+/*
+Метод расчета паузы перед повтором. Пауза уменьшается на случайную величину до 10%,
+чтобы повторы разных доставок не совпадали и не превышали maxBackoff.
+*/
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.initialBackoff
+	for i := 1; i < attempts && delay < w.maxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, w.maxBackoff)
+	return delay - time.Duration(rand.Int64N(int64(delay)/10+1))
+}
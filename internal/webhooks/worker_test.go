@@ -0,0 +1,279 @@
+package webhooks
+
+import (
+	"WST_lab6_server/config"
+	"WST_lab6_server/internal/events"
+	"WST_lab6_server/internal/logging"
+	"WST_lab6_server/internal/models"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+/*
+Очередь доставок в памяти вместо postgres.Storage
+*/
+type memoryStore struct {
+	mu         sync.Mutex
+	webhooks   []models.Webhook
+	deliveries []*models.WebhookDelivery
+	attempts   []models.WebhookAttempt
+}
+
+func (s *memoryStore) ActiveWebhooks(context.Context) ([]models.Webhook, error) {
+	return s.webhooks, nil
+}
+
+func (s *memoryStore) AddWebhookDeliveries(_ context.Context, deliveries []models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range deliveries {
+		delivery := deliveries[i]
+		delivery.ID = uint(len(s.deliveries) + 1)
+		for j := range s.webhooks {
+			if s.webhooks[j].ID == delivery.WebhookID {
+				delivery.Webhook = &s.webhooks[j]
+			}
+		}
+		s.deliveries = append(s.deliveries, &delivery)
+	}
+	return nil
+}
+
+func (s *memoryStore) ClaimWebhookDeliveries(_ context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var claimed []models.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if len(claimed) == limit {
+			break
+		}
+		if delivery.Status == models.DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			delivery.NextAttemptAt = now.Add(lease)
+			claimed = append(claimed, *delivery)
+		}
+	}
+	return claimed, nil
+}
+
+func (s *memoryStore) RecordWebhookAttempt(_ context.Context, delivery *models.WebhookDelivery, attempt *models.WebhookAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*s.deliveries[delivery.ID-1] = *delivery
+	s.attempts = append(s.attempts, *attempt)
+	return nil
+}
+
+func (s *memoryStore) delivery(id uint) models.WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.deliveries[id-1]
+}
+
+/*
+Функция создания отправителя с короткими паузами и получателем httptest (loopback разрешен)
+*/
+func newTestWorker(t *testing.T, handler http.HandlerFunc) (*Worker, *memoryStore) {
+	t.Helper()
+	logging.Logger = zap.NewNop()
+	saved := *config.WebhooksSetting
+	t.Cleanup(func() { *config.WebhooksSetting = saved })
+	*config.WebhooksSetting = config.WebhooksConfig{
+		MaxAttempts:         3,
+		InitialBackoff:      time.Millisecond,
+		MaxBackoff:          2 * time.Millisecond,
+		Timeout:             2 * time.Second,
+		Workers:             2,
+		PayloadRole:         "admin",
+		AllowPrivateTargets: true,
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	store := &memoryStore{webhooks: []models.Webhook{{ID: 1, URL: server.URL, Secret: "secret", Active: true}}}
+	return NewWorker(store), store
+}
+
+/*
+Функция доставки одного события до завершения (delivered или dead)
+*/
+func deliverEvent(t *testing.T, worker *Worker, store *memoryStore) models.WebhookDelivery {
+	t.Helper()
+	event := events.Event{ID: 1, Type: events.TypeCreated, PersonID: 7, Person: &models.Person{ID: 7, Name: "Ivan"}, Time: time.Now()}
+	if err := worker.Enqueue(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		worker.dispatch(context.Background())
+		if delivery := store.delivery(1); delivery.Status != models.DeliveryPending {
+			return delivery
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	t.Fatal("delivery did not finish")
+	return models.WebhookDelivery{}
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"type":"person.created"}`)
+	now := time.Now()
+	signature := Sign("secret", now, body)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	if !Verify("secret", timestamp, signature, body, time.Minute) {
+		t.Fatal("valid signature rejected")
+	}
+	if Verify("other", timestamp, signature, body, time.Minute) {
+		t.Error("signature accepted with another secret")
+	}
+	if Verify("secret", timestamp, signature, []byte(`{}`), time.Minute) {
+		t.Error("signature accepted for another body")
+	}
+	old := now.Add(-time.Hour)
+	if Verify("secret", strconv.FormatInt(old.Unix(), 10), Sign("secret", old, body), body, time.Minute) {
+		t.Error("expired signature accepted")
+	}
+}
+
+func TestDeliverySigned(t *testing.T) {
+	var received atomic.Bool
+	worker, store := newTestWorker(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(HeaderEvent) != events.TypeCreated || r.Header.Get(HeaderDelivery) != "1" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		if !Verify("secret", r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body, time.Minute) {
+			t.Error("receiver could not verify signature")
+		}
+		received.Store(true)
+	})
+	delivery := deliverEvent(t, worker, store)
+	if !received.Load() || delivery.Status != models.DeliveryDelivered || delivery.Attempts != 1 {
+		t.Fatalf("delivery %s after %d attempts", delivery.Status, delivery.Attempts)
+	}
+}
+
+func TestRetryOnServerError(t *testing.T) {
+	var calls atomic.Int32
+	worker, store := newTestWorker(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	delivery := deliverEvent(t, worker, store)
+	if delivery.Status != models.DeliveryDelivered || delivery.Attempts != 2 || calls.Load() != 2 {
+		t.Fatalf("delivery %s after %d attempts, %d calls", delivery.Status, delivery.Attempts, calls.Load())
+	}
+	if store.attempts[0].StatusCode != http.StatusServiceUnavailable || store.attempts[0].Error == "" {
+		t.Errorf("failed attempt not logged: %+v", store.attempts[0])
+	}
+}
+
+func TestNoRetryAfterSuccess(t *testing.T) {
+	var calls atomic.Int32
+	worker, store := newTestWorker(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	deliverEvent(t, worker, store)
+	worker.dispatch(context.Background())
+	if calls.Load() != 1 || len(store.attempts) != 1 {
+		t.Fatalf("%d calls, %d attempts after 2xx", calls.Load(), len(store.attempts))
+	}
+}
+
+func TestDeadAfterMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	worker, store := newTestWorker(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	delivery := deliverEvent(t, worker, store)
+	if delivery.Status != models.DeliveryDead || delivery.Attempts != 3 || calls.Load() != 3 {
+		t.Fatalf("delivery %s after %d attempts, %d calls", delivery.Status, delivery.Attempts, calls.Load())
+	}
+	//Повторная отправка (redeliver) возвращает доставку в очередь
+	store.mu.Lock()
+	store.deliveries[0].Status = models.DeliveryPending
+	store.deliveries[0].NextAttemptAt = time.Now()
+	store.mu.Unlock()
+	worker.dispatch(context.Background())
+	if calls.Load() != 4 {
+		t.Errorf("redelivered delivery was not sent: %d calls", calls.Load())
+	}
+}
+
+func TestRedirectIsFailure(t *testing.T) {
+	var redirected atomic.Bool
+	worker, store := newTestWorker(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			redirected.Store(true)
+			return
+		}
+		http.Redirect(w, r, "/moved", http.StatusFound)
+	})
+	delivery := deliverEvent(t, worker, store)
+	if redirected.Load() {
+		t.Error("redirect was followed")
+	}
+	if delivery.Status != models.DeliveryDead || delivery.LastStatusCode != http.StatusFound {
+		t.Fatalf("delivery %s with status %d", delivery.Status, delivery.LastStatusCode)
+	}
+}
+
+func TestPayloadRedacted(t *testing.T) {
+	worker, store := newTestWorker(t, func(w http.ResponseWriter, r *http.Request) {})
+	savedPII := config.PIISetting.Redaction
+	t.Cleanup(func() { config.PIISetting.Redaction = savedPII })
+	config.PIISetting.Redaction = map[string][]string{"viewer": {"email"}}
+	worker.payloadRole = "viewer"
+	event := events.Event{ID: 1, Type: events.TypeCreated, Person: &models.Person{Email: "olga@mail.com"}}
+	if err := worker.Enqueue(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	var sent events.Event
+	if err := json.Unmarshal(store.delivery(1).Payload, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Person.Email != "o***@mail.com" || event.Person.Email != "olga@mail.com" {
+		t.Fatalf("payload email %q, event email %q", sent.Person.Email, event.Person.Email)
+	}
+}
+
+func TestPrivateTargetsRefused(t *testing.T) {
+	for address, public := range map[string]bool{
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"192.168.0.10":     false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::1":              false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+	} {
+		if got := publicAddress(netip.MustParseAddr(address)); got != public {
+			t.Errorf("publicAddress(%s) = %v", address, got)
+		}
+	}
+	logging.Logger = zap.NewNop()
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{DialContext: newDialContext(time.Second, false)}}
+	if response, err := client.Post(server.URL, "application/json", nil); err == nil {
+		response.Body.Close()
+		t.Fatal("request to loopback receiver was sent")
+	}
+}
@@ -0,0 +1,4 @@
+// Код сервиса PersonService, сгенерированный из api/proto/persons/v1/persons.proto
+package personsv1
+
+//go:generate sh -c "cd ../../.. && buf generate"
@@ -0,0 +1,309 @@
+/*
+Типизированный клиент API персон (/api/v1).
+Пути, параметры и коды ответов соответствуют документу internal/openapi/openapi.json.
+*/
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Значения по умолчанию
+*/
+const (
+	defaultTimeout      = 30 * time.Second
+	defaultMaxAttempts  = 3
+	defaultInitialDelay = 200 * time.Millisecond
+	defaultMaxDelay     = 5 * time.Second
+	defaultUserAgent    = "wst-persons-client/1"
+	// Заголовок ключа API по умолчанию
+	DefaultAPIKeyHeader = "X-API-Key"
+)
+
+/*
+Способ аутентификации: добавляет учетные данные в запрос.
+Сам сервер проверяет Basic (BasicAuth); Bearer и ключ API нужны, когда перед сервером стоит шлюз или прокси.
+*/
+type Authenticator interface {
+	Authenticate(request *http.Request)
+}
+
+// Аутентификация Basic (имя пользователя и пароль)
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a BasicAuth) Authenticate(request *http.Request) {
+	request.SetBasicAuth(a.Username, a.Password)
+}
+
+// Аутентификация Bearer токеном
+type BearerToken string
+
+func (t BearerToken) Authenticate(request *http.Request) {
+	request.Header.Set("Authorization", "Bearer "+string(t))
+}
+
+// Аутентификация ключом API в заголовке
+type APIKey struct {
+	Header string
+	Key    string
+}
+
+func (k APIKey) Authenticate(request *http.Request) {
+	header := k.Header
+	if header == "" {
+		header = DefaultAPIKeyHeader
+	}
+	request.Header.Set(header, k.Key)
+}
+
+/*
+Политика повторов.
+Повторяются ответы 429 и 5xx, а также сетевые ошибки; POST повторяется только при 429 и 503,
+когда сервер гарантированно не обработал запрос.
+*/
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+/*
+Клиент API персон
+*/
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	auth       Authenticator
+	retry      RetryPolicy
+	userAgent  string
+}
+
+// Настройка клиента
+type Option func(*Client)
+
+// Свой http.Client (транспорт, прокси, TLS, таймаут)
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// Basic аутентификация
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) { c.auth = BasicAuth{Username: username, Password: password} }
+}
+
+// Bearer аутентификация
+func WithBearerToken(token string) Option {
+	return func(c *Client) { c.auth = BearerToken(token) }
+}
+
+// Аутентификация ключом API; пустой header означает X-API-Key
+func WithAPIKey(header, key string) Option {
+	return func(c *Client) { c.auth = APIKey{Header: header, Key: key} }
+}
+
+// Произвольный способ аутентификации
+func WithAuthenticator(auth Authenticator) Option {
+	return func(c *Client) { c.auth = auth }
+}
+
+// Политика повторов; MaxAttempts=1 отключает повторы
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) { c.retry = policy }
+}
+
+// Заголовок User-Agent
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+/*
+Функция создания клиента.
+baseURL - адрес сервера без /api/v1, например http://localhost:8095
+*/
+func New(baseURL string, options ...Option) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid base url %q: scheme and host are required", baseURL)
+	}
+	c := &Client{
+		baseURL:    parsed,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		retry: RetryPolicy{
+			MaxAttempts:  defaultMaxAttempts,
+			InitialDelay: defaultInitialDelay,
+			MaxDelay:     defaultMaxDelay,
+		},
+		userAgent: defaultUserAgent,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if c.retry.MaxAttempts < 1 {
+		c.retry.MaxAttempts = 1
+	}
+	return c, nil
+}
+
+/*
+Метод выполнения запроса с повторами.
+Тело запроса кодируется один раз и отправляется заново при каждой попытке,
+при out != nil успешный ответ декодируется из JSON, а если out - io.Writer, тело копируется как есть.
+*/
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, in any, out any) error {
+	var body []byte
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		body = data
+	}
+	endpoint := c.baseURL.JoinPath(path)
+	endpoint.RawQuery = query.Encode()
+
+	delay := c.retry.InitialDelay
+	for attempt := 1; ; attempt++ {
+		response, err := c.send(ctx, method, endpoint.String(), body)
+		if err != nil {
+			//Отмена контекста не повторяется
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if attempt >= c.retry.MaxAttempts || method == http.MethodPost {
+				return err
+			}
+			if err := sleep(ctx, backoff(delay, c.retry.MaxDelay)); err != nil {
+				return err
+			}
+			delay *= 2
+			continue
+		}
+		if response.StatusCode < 300 {
+			defer response.Body.Close()
+			if out == nil {
+				_, _ = io.Copy(io.Discard, response.Body)
+				return nil
+			}
+			if w, ok := out.(io.Writer); ok {
+				_, err := io.Copy(w, response.Body)
+				return err
+			}
+			if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+				return fmt.Errorf("decode response: %w", err)
+			}
+			return nil
+		}
+		apiErr := decodeError(response)
+		if attempt >= c.retry.MaxAttempts || !retryable(method, response.StatusCode) {
+			return apiErr
+		}
+		//Заголовок Retry-After имеет приоритет над расчетной задержкой
+		wait := backoff(delay, c.retry.MaxDelay)
+		if after := retryAfter(response.Header.Get("Retry-After")); after > 0 {
+			wait = min(after, c.retry.MaxDelay)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+		delay *= 2
+	}
+}
+
+/*
+Метод отправки одной попытки запроса
+*/
+func (c *Client) send(ctx context.Context, method string, endpoint string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.userAgent != "" {
+		request.Header.Set("User-Agent", c.userAgent)
+	}
+	if c.auth != nil {
+		c.auth.Authenticate(request)
+	}
+	return c.httpClient.Do(request)
+}
+
+/*
+Функция проверки, можно ли повторить запрос с этим статусом
+*/
+func retryable(method string, status int) bool {
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		return true
+	}
+	return status >= 500 && method != http.MethodPost
+}
+
+/*
+Функция расчета задержки с джиттером в пределах [delay/2, delay]
+*/
+func backoff(delay time.Duration, maxDelay time.Duration) time.Duration {
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+/*
+Функция разбора заголовка Retry-After (секунды или дата HTTP)
+*/
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+/*
+Функция ожидания с учетом отмены контекста
+*/
+func sleep(ctx context.Context, wait time.Duration) error {
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,251 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/*
+Функция создания клиента для тестового сервера с короткими паузами между попытками
+*/
+func newTestClient(t *testing.T, handler http.HandlerFunc, options ...Option) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	options = append([]Option{WithRetry(RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: 50 * time.Millisecond})}, options...)
+	c, err := New(server.URL, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+/*
+Обработчик, отвечающий статусами из statuses по очереди, затем 200 со списком из одной записи
+*/
+func statusSequence(calls *atomic.Int32, statuses ...int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		call := int(calls.Add(1))
+		if call <= len(statuses) {
+			w.WriteHeader(statuses[call-1])
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `[{"id":1,"name":"Olga"}]`)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, baseURL := range []string{"localhost:8095", "/api", "http://%zz"} {
+		if _, err := New(baseURL); err == nil {
+			t.Errorf("New(%q) accepted", baseURL)
+		}
+	}
+}
+
+func TestRequest(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "root" || password != "password" || r.Header.Get("User-Agent") != defaultUserAgent {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		var person map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&person); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request body: %v", err)
+		}
+		//ID назначает сервер, клиент его не отправляет
+		if _, ok := person["id"]; ok || r.Method != http.MethodPost || r.URL.Path != "/api/v1/persons" {
+			t.Errorf("%s %s %v", r.Method, r.URL.Path, person)
+		}
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id":42}`)
+	}, WithBasicAuth("root", "password"))
+	id, err := c.Create(context.Background(), &Person{ID: 7, Name: "Olga"})
+	if err != nil || id != 42 {
+		t.Fatalf("Create = %d, %v", id, err)
+	}
+}
+
+func TestAuthenticators(t *testing.T) {
+	tests := []struct {
+		name   string
+		option Option
+		header string
+		want   string
+	}{
+		{"bearer", WithBearerToken("t0ken"), "Authorization", "Bearer t0ken"},
+		{"api key", WithAPIKey("", "k3y"), DefaultAPIKeyHeader, "k3y"},
+		{"api key header", WithAPIKey("X-Gateway-Key", "k3y"), "X-Gateway-Key", "k3y"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get(test.header); got != test.want {
+					t.Errorf("%s = %q, want %q", test.header, got, test.want)
+				}
+				if _, _, ok := r.BasicAuth(); ok {
+					t.Error("unexpected Basic credentials")
+				}
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, `{"id":1,"name":"Olga"}`)
+			}, test.option)
+			if _, err := c.Get(context.Background(), 1); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRetryOnServerError(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, statusSequence(&calls, http.StatusInternalServerError, http.StatusBadGateway))
+	persons, err := c.List(context.Background())
+	if err != nil || len(persons) != 1 || persons[0].Name != "Olga" || calls.Load() != 3 {
+		t.Fatalf("List = %+v, %v after %d calls", persons, err, calls.Load())
+	}
+	//Попытки закончились: возвращается ошибка последнего ответа
+	calls.Store(0)
+	c = newTestClient(t, statusSequence(&calls, 500, 500, 500, 500))
+	if _, err := c.List(context.Background()); !errors.Is(err, ErrServer) || calls.Load() != 3 {
+		t.Fatalf("List: %v after %d calls", err, calls.Load())
+	}
+	//Ошибки клиента не повторяются
+	calls.Store(0)
+	c = newTestClient(t, statusSequence(&calls, http.StatusBadRequest))
+	if _, err := c.List(context.Background()); !errors.Is(err, ErrBadRequest) || calls.Load() != 1 {
+		t.Fatalf("List: %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, `[]`)
+	})
+	//Retry-After (1 с) важнее расчетной паузы (1 мс) и ограничен MaxDelay (50 мс)
+	started := time.Now()
+	if _, err := c.List(context.Background()); err != nil || calls.Load() != 2 {
+		t.Fatalf("List: %v after %d calls", err, calls.Load())
+	}
+	if elapsed := time.Since(started); elapsed < 40*time.Millisecond || elapsed > 900*time.Millisecond {
+		t.Errorf("waited %s", elapsed)
+	}
+	if got := retryAfter("7"); got != 7*time.Second {
+		t.Errorf("retryAfter(7) = %s", got)
+	}
+	if got := retryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); got < 58*time.Second || got > time.Minute {
+		t.Errorf("retryAfter(date) = %s", got)
+	}
+	if got := retryAfter("soon"); got != 0 {
+		t.Errorf("retryAfter(soon) = %s", got)
+	}
+}
+
+func TestPostRetriedOnlyWhenNotProcessed(t *testing.T) {
+	tests := []struct {
+		status int
+		calls  int32
+	}{
+		{http.StatusTooManyRequests, 2},
+		{http.StatusServiceUnavailable, 2},
+		{http.StatusInternalServerError, 1},
+		{http.StatusGatewayTimeout, 1},
+	}
+	for _, test := range tests {
+		var calls atomic.Int32
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(test.status)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id":1}`)
+		})
+		c.Create(context.Background(), &Person{Name: "Olga"})
+		if calls.Load() != test.calls {
+			t.Errorf("POST after %d: %d calls, want %d", test.status, calls.Load(), test.calls)
+		}
+	}
+	//Сетевая ошибка после отправки POST не повторяется: запрос мог быть обработан
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	})
+	if _, err := c.Create(context.Background(), &Person{Name: "Olga"}); err == nil || calls.Load() != 1 {
+		t.Errorf("POST after connection reset: %v, %d calls", err, calls.Load())
+	}
+	calls.Store(0)
+	if _, err := c.List(context.Background()); err == nil || calls.Load() != 3 {
+		t.Errorf("GET after connection reset: %v, %d calls", err, calls.Load())
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/person/1":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Request is not valid.",
+				"errors":[{"in":"body","name":"/telephone","message":"invalid"}]}`)
+		case "/api/v1/person/2":
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"message":"email already exists"}`)
+		case "/api/v1/persons":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `not json`)
+		}
+	})
+	ctx := context.Background()
+	err := c.Update(ctx, 1, &Person{Name: "Olga"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrBadRequest) || errors.Is(err, ErrNotFound) {
+		t.Fatalf("Update: %v", err)
+	}
+	if violations := apiErr.Violations(); len(violations) != 1 || violations[0].Name != "/telephone" || apiErr.Problem.Detail != "Request is not valid." {
+		t.Errorf("problem %+v", apiErr.Problem)
+	}
+	err = c.Delete(ctx, 2)
+	if !errors.Is(err, ErrConflict) || !strings.Contains(err.Error(), "409 email already exists") {
+		t.Errorf("Delete: %v", err)
+	}
+	if _, err := c.Get(ctx, 3); !errors.As(err, &apiErr) || !errors.Is(err, ErrForbidden) ||
+		apiErr.Problem.Status != http.StatusForbidden || apiErr.Problem.Title != "Forbidden" {
+		t.Errorf("Get: %v", err)
+	}
+	//Пустая выборка поиска (404) - пустой список
+	if persons, err := c.Search(ctx, "nobody"); err != nil || persons == nil || len(persons) != 0 {
+		t.Errorf("Search = %v, %v", persons, err)
+	}
+}
+
+func TestContextCanceled(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, WithRetry(RetryPolicy{MaxAttempts: 5, MaxDelay: time.Minute}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.List(ctx); !errors.Is(err, context.DeadlineExceeded) || calls.Load() != 1 {
+		t.Fatalf("List: %v after %d calls", err, calls.Load())
+	}
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"WST_lab6_server/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Максимальный размер тела ответа с ошибкой, который читает клиент
+const maxErrorBody = 64 << 10
+
+/*
+Ошибки по классам ответов сервера, проверяются через errors.Is
+*/
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrUnavailable  = errors.New("service unavailable")
+	ErrTimeout      = errors.New("gateway timeout")
+	ErrServer       = errors.New("server error")
+)
+
+// Описание ошибки в формате application/problem+json (та же структура, что отдает сервер)
+type Problem = models.ErrorResponse
+
+// Нарушение правил проверки запроса: место (path, query, header, body), имя поля и описание
+type Violation = models.Violation
+
+/*
+Ошибка ответа API.
+Problem заполняется из application/problem+json,
+для ответов вида {"message": "..."} заполняются Status и Detail.
+*/
+type Error struct {
+	StatusCode int
+	Problem    Problem
+}
+
+func (e *Error) Error() string {
+	detail := e.Problem.Detail
+	if detail == "" {
+		detail = e.Problem.Title
+	}
+	if detail == "" {
+		return fmt.Sprintf("persons api: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("persons api: %d %s", e.StatusCode, detail)
+}
+
+/*
+Метод сопоставления с ошибками классов ответов
+*/
+func (e *Error) Is(target error) bool {
+	return statusError(e.StatusCode) == target
+}
+
+// Нарушения правил проверки запроса (для 400 от проверки по документу OpenAPI)
+func (e *Error) Violations() []Violation {
+	return e.Problem.Errors
+}
+
+/*
+Функция определения класса ошибки по статусу ответа
+*/
+func statusError(status int) error {
+	switch {
+	case status == http.StatusBadRequest:
+		return ErrBadRequest
+	case status == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case status == http.StatusForbidden:
+		return ErrForbidden
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status == http.StatusConflict:
+		return ErrConflict
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusServiceUnavailable:
+		return ErrUnavailable
+	case status == http.StatusGatewayTimeout:
+		return ErrTimeout
+	case status >= 500:
+		return ErrServer
+	}
+	return nil
+}
+
+/*
+Функция чтения ответа с ошибкой.
+Тело закрывается, чтобы соединение можно было переиспользовать при повторе.
+*/
+func decodeError(response *http.Response) *Error {
+	defer response.Body.Close()
+	apiErr := &Error{StatusCode: response.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+	_, _ = io.Copy(io.Discard, response.Body)
+	var body struct {
+		Problem
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &body) == nil {
+		apiErr.Problem = body.Problem
+		if apiErr.Problem.Detail == "" {
+			apiErr.Problem.Detail = body.Message
+		}
+	}
+	if apiErr.Problem.Status == 0 {
+		apiErr.Problem.Status = response.StatusCode
+	}
+	if apiErr.Problem.Title == "" {
+		apiErr.Problem.Title = http.StatusText(response.StatusCode)
+	}
+	return apiErr
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"WST_lab6_server/internal/models"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Запись о персоне (та же структура, что использует сервер)
+type Person = models.Person
+
+/*
+Метод получения всех записей (GET /api/v1/persons/list)
+*/
+func (c *Client) List(ctx context.Context) ([]Person, error) {
+	var persons []Person
+	if err := c.do(ctx, http.MethodGet, "/api/v1/persons/list", nil, nil, &persons); err != nil {
+		return nil, err
+	}
+	return persons, nil
+}
+
+/*
+Метод выгрузки всех записей в формате сервера (json, csv, xlsx, ndjson, yaml).
+Тело ответа пишется в w без преобразования.
+*/
+func (c *Client) Export(ctx context.Context, format string, w io.Writer) error {
+	return c.do(ctx, http.MethodGet, "/api/v1/persons/list", url.Values{"format": {format}}, nil, w)
+}
+
+/*
+Метод поиска по всем полям (GET /api/v1/persons?query=).
+Пустая выборка возвращается как пустой список, а не ошибка.
+*/
+func (c *Client) Search(ctx context.Context, query string) ([]Person, error) {
+	var persons []Person
+	err := c.do(ctx, http.MethodGet, "/api/v1/persons", url.Values{"query": {query}}, nil, &persons)
+	if errors.Is(err, ErrNotFound) {
+		return []Person{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return persons, nil
+}
+
+/*
+Метод получения записи по id (GET /api/v1/person/{id})
+*/
+func (c *Client) Get(ctx context.Context, id uint) (*Person, error) {
+	var person Person
+	if err := c.do(ctx, http.MethodGet, personPath(id), nil, nil, &person); err != nil {
+		return nil, err
+	}
+	return &person, nil
+}
+
+/*
+Метод добавления записи (POST /api/v1/persons), возвращает id новой записи.
+Поле ID не отправляется.
+*/
+func (c *Client) Create(ctx context.Context, person *Person) (uint, error) {
+	body := *person
+	body.ID = 0
+	var created struct {
+		ID uint `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/persons", nil, &body, &created); err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+/*
+Метод изменения записи (PUT /api/v1/person/{id})
+*/
+func (c *Client) Update(ctx context.Context, id uint, person *Person) error {
+	body := *person
+	body.ID = 0
+	return c.do(ctx, http.MethodPut, personPath(id), nil, &body, nil)
+}
+
+/*
+Метод удаления записи (DELETE /api/v1/person/{id})
+*/
+func (c *Client) Delete(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, personPath(id), nil, nil, nil)
+}
+
+func personPath(id uint) string {
+	return "/api/v1/person/" + strconv.FormatUint(uint64(id), 10)
+}